@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-
 	apiPkg "github.com/legertom/dnsprop/api/internal/api"
 	"github.com/legertom/dnsprop/api/internal/cache"
 	"github.com/legertom/dnsprop/api/internal/config"
+	"github.com/legertom/dnsprop/api/internal/email"
+	"github.com/legertom/dnsprop/api/internal/history"
 	"github.com/legertom/dnsprop/api/internal/logging"
+	"github.com/legertom/dnsprop/api/internal/monitor"
+	"github.com/legertom/dnsprop/api/internal/ratelimit"
+	"github.com/legertom/dnsprop/api/internal/watch"
+	"github.com/legertom/dnsprop/api/internal/webhook"
 )
 
 func main() {
@@ -23,13 +33,110 @@ func main() {
 	// Initialize logging
 	logging.Init(cfg.LogLevel)
 
+	// Cancelled on SIGINT/SIGTERM, which starts the shutdown below
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize resolver cache
 	resolverCache, err := cache.NewLRU(cfg.CacheMaxEntries, cfg.CacheTTL)
 	if err != nil {
 		log.Fatalf("cache init: %v", err)
 	}
 
-	r := apiPkg.NewRouter(cfg, resolverCache)
+	// Check history; a nil store disables it
+	var store history.Store
+	if cfg.HistoryDB != "" {
+		db, err := history.OpenSQLite(cfg.HistoryDB)
+		if err != nil {
+			log.Fatalf("history: %v", err)
+		}
+		defer db.Close()
+		store = db
+		// Expired checks are also hidden on read; this just keeps the file from growing
+		go history.Expire(ctx, store, cfg.CheckExpiry, time.Hour)
+	}
+
+	// Monitors and webhooks live in the history database. Monitors record their checks to
+	// history, and webhooks are notified of the changes they find.
+	var (
+		monitors *monitor.Manager
+		webhooks *webhook.Dispatcher
+	)
+	if cfg.HistoryDB != "" {
+		hooks, err := webhook.OpenSQLite(cfg.HistoryDB)
+		if err != nil {
+			log.Fatalf("webhooks: %v", err)
+		}
+		defer hooks.Close()
+		webhooks = webhook.NewDispatcher(hooks, cfg.WebhookMaxCount, cfg.WebhookMaxAttempts, cfg.WebhookRetryBackoff, cfg.WebhookTimeout, cfg.WebhookAllowPrivate)
+		defer webhooks.Close()
+
+		db, err := monitor.OpenSQLite(cfg.HistoryDB)
+		if err != nil {
+			log.Fatalf("monitors: %v", err)
+		}
+		defer db.Close()
+		monitors = monitor.NewManager(db, cfg.MonitorMaxCount, cfg.RequestTimeout)
+		monitors.OnResult(apiPkg.RecordMonitorChecks(store))
+		monitors.OnResult(webhooks.HandleMonitorEvent)
+
+		// Email alerts on state changes and a daily digest, for stakeholders who only read email
+		if cfg.SMTPHost != "" {
+			notifier := email.NewNotifier(email.NewMailer(email.Options{
+				Host:     cfg.SMTPHost,
+				Port:     cfg.SMTPPort,
+				Username: cfg.SMTPUsername,
+				Password: cfg.SMTPPassword,
+				StartTLS: cfg.SMTPStartTLS,
+				From:     cfg.SMTPFrom,
+				To:       cfg.SMTPTo,
+				Timeout:  cfg.SMTPTimeout,
+			}), monitors)
+			monitors.OnResult(notifier.HandleMonitorEvent)
+			if cfg.DigestTime != "" {
+				at, _ := time.Parse("15:04", cfg.DigestTime) // checked by Validate
+				notifier.StartDigests(time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute)
+			}
+			defer notifier.Close()
+		}
+		if err := monitors.Start(context.Background()); err != nil {
+			log.Fatalf("monitors: %v", err)
+		}
+		// Old results are rolled up by hour, then by day, so frequent monitors stay bounded. The
+		// history checks and webhook deliveries they produce follow the raw retention.
+		monitors.PruneChecks(apiPkg.PruneMonitorChecks(store))
+		monitors.PruneDeliveries(webhooks.PruneDeliveries)
+		monitors.StartCompaction(monitor.Retention{
+			Raw:    cfg.ResultRetention,
+			Hourly: cfg.HourlyRetention,
+			Daily:  cfg.DailyRetention,
+		}, cfg.CompactInterval)
+		defer monitors.Close()
+	}
+
+	// One limiter and history store are shared by the HTTP and gRPC listeners
+	limiter := ratelimit.NewLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst, cfg.RateLimitTTL)
+
+	// Watch jobs live in memory and are cancelled on shutdown
+	watches := watch.NewManager(cfg.WatchMaxJobs, cfg.RequestTimeout)
+	defer watches.Close()
+
+	r := apiPkg.NewRouter(cfg, resolverCache, limiter, store, monitors, webhooks, watches)
+
+	if cfg.GRPCPort != "" {
+		lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+		if err != nil {
+			log.Fatalf("grpc listen: %v", err)
+		}
+		gs := apiPkg.NewGRPCServer(cfg, resolverCache, limiter, store)
+		go func() {
+			log.Printf("dnsprop grpc listening on :%s", cfg.GRPCPort)
+			if err := gs.Serve(lis); err != nil {
+				log.Fatalf("grpc server error: %v", err)
+			}
+		}()
+		defer gs.GracefulStop()
+	}
 
 	srv := &http.Server{
 		Addr:         ":" + cfg.Port,
@@ -39,8 +146,24 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// On SIGINT/SIGTERM stop accepting requests and wait for in-flight ones to finish before
+	// returning, so the deferred Close calls stop watch jobs, monitors and webhook retries and
+	// close the databases only once no handler is using them.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}()
+
 	log.Printf("dnsprop api listening on :%s", cfg.Port)
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("server error: %v", err)
 	}
+	<-done
+	log.Printf("dnsprop api shutting down")
 }
@@ -0,0 +1,124 @@
+// Package dnsrpc is a typed client for the dnsprop gRPC service. Messages are JSON-encoded, so
+// no generated code is needed; the types are the same as the HTTP API's.
+package dnsrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/legertom/dnsprop/api/internal/api"
+	"github.com/legertom/dnsprop/api/internal/dnsresolver"
+	"github.com/legertom/dnsprop/api/internal/grpcjson"
+)
+
+type (
+	ResolveRequest       = api.ResolveRequest
+	ResolveResponse      = api.ResolveResponse
+	ResolveStreamMessage = api.ResolveStreamMessage
+	Result               = api.Result
+	StreamSummary        = api.StreamSummary
+	TraceRequest         = api.TraceRequest
+	TraceHop             = dnsresolver.TraceHop
+)
+
+// Client calls the DNSProp service over an existing connection.
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+var streamDesc = &grpc.StreamDesc{ServerStreams: true}
+
+// Resolve queries every requested resolver and returns all results at once.
+func (c *Client) Resolve(ctx context.Context, req *ResolveRequest, opts ...grpc.CallOption) (*ResolveResponse, error) {
+	out := new(ResolveResponse)
+	if err := c.cc.Invoke(ctx, api.GRPCMethodResolve, req, out, withCodec(opts)...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ResolveStream calls onResult as each resolver answers and returns the final summary.
+func (c *Client) ResolveStream(ctx context.Context, req *ResolveRequest, onResult func(Result), opts ...grpc.CallOption) (*StreamSummary, error) {
+	var summary *StreamSummary
+	err := c.serverStream(ctx, api.GRPCMethodResolveStream, req, opts, func(recv func(any) error) error {
+		var msg ResolveStreamMessage
+		if err := recv(&msg); err != nil {
+			return err
+		}
+		if msg.Result != nil {
+			onResult(*msg.Result)
+		}
+		if msg.Summary != nil {
+			summary = msg.Summary
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// Trace follows referrals from the root for req.Name, calling onHop for every query made.
+func (c *Client) Trace(ctx context.Context, req *TraceRequest, onHop func(TraceHop), opts ...grpc.CallOption) error {
+	return c.serverStream(ctx, api.GRPCMethodTrace, req, opts, func(recv func(any) error) error {
+		var hop TraceHop
+		if err := recv(&hop); err != nil {
+			return err
+		}
+		onHop(hop)
+		return nil
+	})
+}
+
+// serverStream sends req and calls next until the server closes the stream.
+func (c *Client) serverStream(ctx context.Context, method string, req any, opts []grpc.CallOption, next func(recv func(any) error) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.cc.NewStream(ctx, streamDesc, method, withCodec(opts)...)
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	for {
+		if err := next(stream.RecvMsg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func withCodec(opts []grpc.CallOption) []grpc.CallOption {
+	return append([]grpc.CallOption{grpc.ForceCodec(grpcjson.Codec{})}, opts...)
+}
+
+// ErrorCode returns the stable error code (e.g. "invalid_domain", "rate_limited") carried by an
+// error from this client, or "" if there is none. The codes match the HTTP API's problem codes.
+func ErrorCode(err error) string {
+	st, ok := status.FromError(err)
+	if !ok {
+		return ""
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.Domain == api.GRPCErrorDomain {
+			return info.Reason
+		}
+	}
+	return ""
+}
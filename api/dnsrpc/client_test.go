@@ -0,0 +1,99 @@
+package dnsrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/legertom/dnsprop/api/internal/api"
+	"github.com/legertom/dnsprop/api/internal/config"
+	"github.com/legertom/dnsprop/api/internal/ratelimit"
+)
+
+func testConfig() *config.Config {
+	return &config.Config{
+		Resolvers:      []string{"127.0.0.1", "127.0.0.2"},
+		RequestTimeout: 200 * time.Millisecond,
+		CheckTimeout:   500 * time.Millisecond,
+		RateLimitRPS:   100,
+		RateLimitBurst: 100,
+		RateLimitTTL:   time.Minute,
+	}
+}
+
+// newTestClient serves the gRPC API over an in-memory listener.
+func newTestClient(t *testing.T, cfg *config.Config) *Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := api.NewGRPCServer(cfg, nil, ratelimit.NewLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst, cfg.RateLimitTTL), nil)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	cc, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return NewClient(cc)
+}
+
+func TestResolve(t *testing.T) {
+	c := newTestClient(t, testConfig())
+	resp, err := c.Resolve(context.Background(), &ResolveRequest{Name: "example.com", Type: "A"})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if resp.Name != "example.com" || len(resp.Results) != 2 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestResolveStream(t *testing.T) {
+	c := newTestClient(t, testConfig())
+	var results []Result
+	summary, err := c.ResolveStream(context.Background(), &ResolveRequest{Name: "example.com", Type: "A"}, func(r Result) {
+		results = append(results, r)
+	})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if len(results) != 2 || summary == nil || summary.Total != 2 {
+		t.Fatalf("expected 2 results and a summary, got %d, %+v", len(results), summary)
+	}
+}
+
+func TestInvalidArgumentCarriesCode(t *testing.T) {
+	c := newTestClient(t, testConfig())
+	_, err := c.Resolve(context.Background(), &ResolveRequest{Name: "example.com", Type: "PTR"})
+	if status.Code(err) != codes.InvalidArgument || ErrorCode(err) != "unsupported_type" {
+		t.Fatalf("expected InvalidArgument/unsupported_type, got %v (%q)", err, ErrorCode(err))
+	}
+	err = c.Trace(context.Background(), &TraceRequest{Name: "not a domain"}, func(TraceHop) {})
+	if status.Code(err) != codes.InvalidArgument || ErrorCode(err) != "invalid_domain" {
+		t.Fatalf("expected InvalidArgument/invalid_domain, got %v (%q)", err, ErrorCode(err))
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	cfg := testConfig()
+	cfg.RateLimitRPS, cfg.RateLimitBurst = 0.001, 1
+	c := newTestClient(t, cfg)
+	req := &ResolveRequest{Name: "example.com", Type: "A", Servers: []string{"127.0.0.1"}}
+	if _, err := c.Resolve(context.Background(), req); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	_, err := c.Resolve(context.Background(), req)
+	if status.Code(err) != codes.ResourceExhausted || ErrorCode(err) != "rate_limited" {
+		t.Fatalf("expected ResourceExhausted/rate_limited, got %v", err)
+	}
+}
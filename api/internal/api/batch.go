@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/legertom/dnsprop/api/internal/config"
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+	"github.com/legertom/dnsprop/api/internal/problem"
+	"github.com/legertom/dnsprop/api/internal/ratelimit"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+// BatchRequest resolves several name/type pairs in one call. Servers and DNSSEC apply to every
+// item that does not set its own.
+type BatchRequest struct {
+	Items   []BatchQuery `json:"items"`
+	Servers []string     `json:"servers,omitempty"`
+	DNSSEC  bool         `json:"dnssec,omitempty"`
+}
+
+// BatchQuery is one batch entry. DNSSEC is a pointer so an item can turn it off when the batch
+// default is on; nil means the batch default.
+type BatchQuery struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Servers []string `json:"servers,omitempty"`
+	DNSSEC  *bool    `json:"dnssec,omitempty"`
+}
+
+// BatchItem is the outcome of one batch entry. Index is the entry's position in the request;
+// Error and Code are set instead of Results when the entry failed validation.
+type BatchItem struct {
+	Index    int            `json:"index"`
+	Name     string         `json:"name"`
+	Type     string         `json:"type"`
+	Error    string         `json:"error,omitempty"`
+	Code     string         `json:"code,omitempty"`
+	Results  []Result       `json:"results,omitempty"`
+	Statuses map[string]int `json:"statuses,omitempty"`
+}
+
+type BatchResponse struct {
+	Items []BatchItem `json:"items"`
+}
+
+// BatchHandler serves POST /api/resolve/batch. All batches draw upstream queries from budget so
+// large batches cannot monopolize the resolvers, and each client pays for them from limiter, one
+// token per upstream query (items x servers); a batch the limiter could never grant at once is
+// rejected outright. With "Accept: application/x-ndjson" items are streamed one per line as they
+// finish, otherwise they are returned together in request order.
+func BatchHandler(cfg *config.Config, cache resolver.Cache, limiter *ratelimit.Limiter, budget resolver.Budget) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req BatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "invalid json")
+			return
+		}
+		if len(req.Items) == 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "items must not be empty")
+			return
+		}
+		if len(req.Items) > cfg.BatchMaxItems {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeTooManyItems, fmt.Sprintf("at most %d items per batch", cfg.BatchMaxItems))
+			return
+		}
+
+		prepared, queries := prepareBatch(cfg, req)
+		if queries > limiter.Burst() {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBatchTooLarge,
+				fmt.Sprintf("batch needs %d upstream queries, at most %d per batch", queries, limiter.Burst()))
+			return
+		}
+		if wait, _ := limiter.ReserveN(ratelimit.ClientIP(r), queries); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			problem.Write(w, r, http.StatusTooManyRequests, problem.CodeRateLimited, "rate limited")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.BatchTimeout)
+		defer cancel()
+
+		items := make(chan BatchItem)
+		go func() {
+			runBatch(ctx, cfg, cache, budget, prepared, items)
+			close(items)
+		}()
+
+		if strings.Contains(r.Header.Get("Accept"), ndjsonContentType) {
+			w.Header().Set("content-type", ndjsonContentType)
+			rc := http.NewResponseController(w)
+			enc := json.NewEncoder(w)
+			for item := range items {
+				if err := enc.Encode(item); err != nil {
+					cancel() // client went away; drain remaining items
+					continue
+				}
+				rc.Flush()
+			}
+			return
+		}
+
+		out := BatchResponse{Items: make([]BatchItem, len(req.Items))}
+		for item := range items {
+			out.Items[item.Index] = item
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// batchEntry is a validated batch item. Item carries the error instead when validation failed.
+type batchEntry struct {
+	req     ResolveRequest
+	servers []string
+	item    BatchItem
+}
+
+// prepareBatch applies the batch defaults to every item and validates it, returning the entries
+// and the number of upstream queries the valid ones will make.
+func prepareBatch(cfg *config.Config, req BatchRequest) ([]batchEntry, int) {
+	entries := make([]batchEntry, len(req.Items))
+	queries := 0
+	for i, q := range req.Items {
+		item := ResolveRequest{Name: q.Name, Type: q.Type, Servers: q.Servers, DNSSEC: req.DNSSEC}
+		if len(item.Servers) == 0 {
+			item.Servers = req.Servers
+		}
+		if q.DNSSEC != nil {
+			item.DNSSEC = *q.DNSSEC
+		}
+		e := batchEntry{item: BatchItem{Index: i, Name: item.Name, Type: item.Type}}
+		servers, err := normalizeResolveRequest(cfg, &item)
+		if err != nil {
+			e.item.Error = err.Error()
+			e.item.Code = problem.CodeOf(err, problem.CodeInvalidRequest)
+		} else {
+			e.req, e.servers = item, servers
+			e.item.Name, e.item.Type = item.Name, item.Type
+			queries += len(servers)
+		}
+		entries[i] = e
+	}
+	return entries, queries
+}
+
+// runBatch resolves every valid entry concurrently and sends each finished item on out.
+func runBatch(ctx context.Context, cfg *config.Config, cache resolver.Cache, budget resolver.Budget, entries []batchEntry, out chan<- BatchItem) {
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out <- resolveBatchItem(ctx, cfg, cache, budget, e)
+		}()
+	}
+	wg.Wait()
+}
+
+func resolveBatchItem(ctx context.Context, cfg *config.Config, cache resolver.Cache, budget resolver.Budget, e batchEntry) BatchItem {
+	item := e.item
+	if item.Error != "" {
+		return item
+	}
+	item.Results = make([]Result, 0, len(e.servers))
+	item.Statuses = map[string]int{}
+	budget.ResolveStream(ctx, e.req.Name, e.req.Type, e.servers, e.req.DNSSEC, cfg.RequestTimeout, cache, cfg.CacheTTL, func(rr resolver.Result) {
+		item.Results = append(item.Results, toResult(rr))
+		item.Statuses[rr.Status]++
+	})
+	return item
+}
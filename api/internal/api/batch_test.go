@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/legertom/dnsprop/api/internal/config"
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+	"github.com/legertom/dnsprop/api/internal/ratelimit"
+	"github.com/legertom/dnsprop/api/internal/watch"
+)
+
+const batchBody = `{"servers":["127.0.0.1","127.0.0.2"],"items":[{"name":"example.com","type":"A"},{"name":"ex@mple.com","type":"A"},{"name":"example.org","type":"MX","servers":["127.0.0.1"]}]}`
+
+func newBatchHandler(burst int) http.HandlerFunc {
+	cfg := testConfig()
+	return BatchHandler(cfg, nil, ratelimit.NewLimiter(1, burst, time.Minute), resolver.NewBudget(cfg.BatchConcurrency))
+}
+
+func TestBatchHandler_ReturnsItemsInOrder(t *testing.T) {
+	w := httptest.NewRecorder()
+	newBatchHandler(10).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/resolve/batch", strings.NewReader(batchBody)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp BatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Items) != 3 {
+		t.Fatalf("expected 3 items, got %d", len(resp.Items))
+	}
+	for i, item := range resp.Items {
+		if item.Index != i {
+			t.Fatalf("item %d has index %d", i, item.Index)
+		}
+	}
+	if len(resp.Items[0].Results) != 2 || resp.Items[0].Error != "" {
+		t.Fatalf("expected 2 results for first item, got %+v", resp.Items[0])
+	}
+	if resp.Items[1].Error == "" || len(resp.Items[1].Results) != 0 {
+		t.Fatalf("expected validation error for second item, got %+v", resp.Items[1])
+	}
+	if len(resp.Items[2].Results) != 1 || resp.Items[2].Type != "MX" {
+		t.Fatalf("expected per-item servers to override defaults, got %+v", resp.Items[2])
+	}
+}
+
+func TestBatchHandler_StreamsNDJSON(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/resolve/batch", strings.NewReader(batchBody))
+	r.Header.Set("Accept", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	newBatchHandler(10).ServeHTTP(w, r)
+
+	if ct := w.Header().Get("content-type"); ct != "application/x-ndjson" {
+		t.Fatalf("unexpected content-type %q", ct)
+	}
+	seen := map[int]bool{}
+	sc := bufio.NewScanner(w.Body)
+	for sc.Scan() {
+		var item BatchItem
+		if err := json.Unmarshal(sc.Bytes(), &item); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		seen[item.Index] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected one line per item, got %v", seen)
+	}
+}
+
+func TestBatchHandler_Rejects(t *testing.T) {
+	cases := []struct {
+		name  string
+		body  string
+		burst int
+		want  int
+		code  string
+	}{
+		{"empty", `{"items":[]}`, 10, http.StatusBadRequest, "invalid_request"},
+		{"too many", `{"items":[{"name":"a.com","type":"A"},{"name":"b.com","type":"A"},{"name":"c.com","type":"A"},{"name":"d.com","type":"A"}]}`, 10, http.StatusBadRequest, "too_many_items"},
+		// batchBody makes three upstream queries; the invalid item costs nothing.
+		{"larger than the bucket", batchBody, 2, http.StatusBadRequest, "batch_too_large"},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		newBatchHandler(tc.burst).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/resolve/batch", strings.NewReader(tc.body)))
+		if w.Code != tc.want {
+			t.Fatalf("%s: expected %d, got %d", tc.name, tc.want, w.Code)
+		}
+		assertProblem(t, w, tc.want, tc.code)
+	}
+}
+
+func TestBatchHandler_ChargesPerUpstreamQuery(t *testing.T) {
+	h := newBatchHandler(4)
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/resolve/batch", strings.NewReader(batchBody)))
+		return w
+	}
+	if w := post(); w.Code != http.StatusOK {
+		t.Fatalf("expected the first batch to fit the bucket, got %d: %s", w.Code, w.Body.String())
+	}
+	// One token is left and refills at one per second, so three take two more seconds.
+	w := post()
+	assertProblem(t, w, http.StatusTooManyRequests, "rate_limited")
+	if ra := w.Header().Get("Retry-After"); ra != "2" {
+		t.Fatalf("expected Retry-After 2, got %q", ra)
+	}
+}
+
+func TestBatch_DefaultLimitsAllowLargeBatches(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.RequestTimeout = 200 * time.Millisecond
+	items := make([]string, 20)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"name":"host%d.example.com","type":"A"}`, i)
+	}
+	body := `{"servers":["127.0.0.1","127.0.0.2"],"items":[` + strings.Join(items, ",") + `]}`
+
+	h := NewRouter(cfg, nil, ratelimit.NewLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst, cfg.RateLimitTTL), nil, nil, nil, watch.NewManager(cfg.WatchMaxJobs, cfg.RequestTimeout))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/resolve/batch", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected a 20-item batch to pass the default limits, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPrepareBatch_ItemDNSSECOverridesDefault(t *testing.T) {
+	var req BatchRequest
+	body := `{"dnssec":true,"servers":["127.0.0.1"],"items":[{"name":"example.com","type":"A","dnssec":false},{"name":"example.com","type":"A"}]}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := prepareBatch(testConfig(), req)
+	if entries[0].req.DNSSEC || !entries[1].req.DNSSEC {
+		t.Fatalf("expected dnssec off for the first item and inherited for the second, got %v and %v", entries[0].req.DNSSEC, entries[1].req.DNSSEC)
+	}
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/legertom/dnsprop/api/internal/config"
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+	"github.com/legertom/dnsprop/api/internal/history"
+	"github.com/legertom/dnsprop/api/internal/problem"
+	"github.com/legertom/dnsprop/api/internal/validation"
+)
+
+// Bundle identification. BundleVersion changes whenever the bundle shape does; import accepts
+// every version up to the current one.
+const (
+	BundleFormat  = "dnsprop-check"
+	BundleVersion = 1
+)
+
+// Import limits.
+const (
+	maxBundleBytes   = 1 << 20
+	maxBundleResults = 500
+)
+
+// BundleCheck describes the stored check a bundle was exported from.
+type BundleCheck struct {
+	ID         string    `json:"id"`
+	Source     string    `json:"source"`
+	CreatedAt  time.Time `json:"created_at"`
+	DurationMs float64   `json:"duration_ms"`
+}
+
+// BundleSummary counts results by status and by answer set ("" for no answers).
+type BundleSummary struct {
+	Servers     int            `json:"servers"`
+	Responded   int            `json:"responded"`
+	Unreachable int            `json:"unreachable"`
+	Statuses    map[string]int `json:"statuses"`
+	AnswerSets  map[string]int `json:"answer_sets"`
+}
+
+// CheckBundle is a self-contained export of one check, for attaching to tickets and importing
+// later. Servers carries the catalog metadata (location, provider) of the queried resolvers.
+type CheckBundle struct {
+	Format      string                  `json:"format"`
+	Version     int                     `json:"version"`
+	ExportedAt  time.Time               `json:"exported_at"`
+	Check       BundleCheck             `json:"check"`
+	Request     ResolveRequest          `json:"request"`
+	Results     []Result                `json:"results"`
+	Propagation *Propagation            `json:"propagation,omitempty"`
+	Summary     BundleSummary           `json:"summary"`
+	Servers     []resolver.ResolverInfo `json:"servers"`
+}
+
+// CheckExportHandler serves GET /api/checks/{id}/export, the check as a downloadable bundle.
+func CheckExportHandler(cfg *config.Config, store history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, _, ok := loadCheck(w, r, cfg, store)
+		if !ok {
+			return
+		}
+		var resp ResolveResponse
+		if err := json.Unmarshal(c.Response, &resp); err != nil {
+			slog.ErrorContext(r.Context(), "history_decode_failed", slog.String("id", c.ID), slog.String("error", err.Error()))
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "could not read check")
+			return
+		}
+		servers := resolver.Catalog(c.Servers)
+		for i := range servers {
+			servers[i].Health = nil // current health says nothing about the time of the check
+		}
+		out := CheckBundle{
+			Format:      BundleFormat,
+			Version:     BundleVersion,
+			ExportedAt:  time.Now().UTC(),
+			Check:       BundleCheck{ID: c.ID, Source: c.Source, CreatedAt: c.CreatedAt, DurationMs: c.DurationMs},
+			Request:     ResolveRequest{Name: resp.Name, Type: resp.Type, Servers: c.Servers, DNSSEC: c.DNSSEC},
+			Results:     resp.Results,
+			Propagation: resp.Propagation,
+			Summary:     summarizeResults(resp.Results),
+			Servers:     servers,
+		}
+		w.Header().Set("content-type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="dnsprop-%s-%s-%s.json"`, c.Name, c.Type, c.ID))
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// CheckImportHandler serves POST /api/checks/import. The bundle is stored as a new check, with a
+// new ID and the import time, so it gets its own permalink and can be diffed like any other check;
+// the original check ID and time stay in its source. Imported checks are listed separately
+// (GET /api/history?imported=true) and never appear in the timeline, so an import cannot pass for
+// an observation made at the import time.
+func CheckImportHandler(cfg *config.Config, store history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "history is disabled")
+			return
+		}
+		var b CheckBundle
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBundleBytes)).Decode(&b); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				problem.Write(w, r, http.StatusRequestEntityTooLarge, problem.CodeInvalidRequest, fmt.Sprintf("bundle is larger than %d bytes", maxBundleBytes))
+				return
+			}
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "invalid json")
+			return
+		}
+		if err := validateBundle(&b); err != nil {
+			problem.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		c := &history.Check{
+			ID:         history.NewID(),
+			Name:       strings.ToLower(b.Request.Name),
+			Type:       b.Request.Type,
+			Servers:    b.Request.Servers,
+			DNSSEC:     b.Request.DNSSEC,
+			Source:     importSource(b.Check),
+			RequestID:  httpCheckMeta(r).requestID,
+			UserAgent:  r.UserAgent(),
+			DurationMs: b.Check.DurationMs,
+		}
+		resp, err := json.Marshal(ResolveResponse{Name: b.Request.Name, Type: b.Request.Type, Results: b.Results, Propagation: b.Propagation, CheckID: c.ID})
+		if err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		c.Response = resp
+		if err := store.Add(r.Context(), c); err != nil {
+			slog.ErrorContext(r.Context(), "history_import_failed", slog.String("name", c.Name), slog.String("error", err.Error()))
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "could not store check")
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		w.Header().Set("location", strings.TrimSuffix(r.URL.Path, "/import")+"/"+c.ID) // keeps the /api or /api/v1 prefix
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(CheckResponse{Check: *c, ExpiresAt: c.CreatedAt.Add(cfg.CheckExpiry)})
+	}
+}
+
+// validateBundle checks b as strictly as a resolve request and normalizes its name and type.
+func validateBundle(b *CheckBundle) error {
+	if b.Format != BundleFormat {
+		return &validation.Error{Code: problem.CodeInvalidRequest, Message: fmt.Sprintf("format must be %q", BundleFormat)}
+	}
+	if b.Version < 1 || b.Version > BundleVersion {
+		return &validation.Error{Code: problem.CodeInvalidRequest, Message: fmt.Sprintf("unsupported bundle version %d", b.Version)}
+	}
+	var err error
+	if b.Request.Name, err = validation.ValidateDomainName(b.Request.Name); err != nil {
+		return err
+	}
+	b.Request.Type = strings.ToUpper(strings.TrimSpace(b.Request.Type))
+	if err := validation.ValidateRecordType(b.Request.Type); err != nil {
+		return err
+	}
+	if len(b.Results) == 0 || len(b.Results) > maxBundleResults {
+		return &validation.Error{Code: problem.CodeInvalidRequest, Message: fmt.Sprintf("a bundle must have between 1 and %d results", maxBundleResults)}
+	}
+	servers := make([]string, 0, len(b.Results))
+	for _, res := range b.Results {
+		if res.Server == "" || res.Status == "" {
+			return &validation.Error{Code: problem.CodeInvalidRequest, Message: "every result needs a server and a status"}
+		}
+		servers = append(servers, res.Server)
+	}
+	if len(b.Request.Servers) == 0 {
+		b.Request.Servers = dedupe(servers)
+	}
+	if err := validation.ValidateServers(append(servers, b.Request.Servers...), 2*maxBundleResults); err != nil {
+		return err
+	}
+	return nil
+}
+
+func importSource(orig BundleCheck) string {
+	if orig.ID == "" {
+		return history.ImportSource
+	}
+	return fmt.Sprintf("%s %s (%s)", history.ImportSource, orig.ID, orig.CreatedAt.UTC().Format(time.RFC3339))
+}
+
+func summarizeResults(results []Result) BundleSummary {
+	s := BundleSummary{Servers: len(results), Statuses: map[string]int{}, AnswerSets: answerGroups(results)}
+	for _, r := range results {
+		s.Statuses[r.Status]++
+		if r.Status == "timeout" || r.Status == "error" {
+			s.Unreachable++
+		} else {
+			s.Responded++
+		}
+	}
+	return s
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/legertom/dnsprop/api/internal/history"
+)
+
+func TestCheck_ExportImport(t *testing.T) {
+	router := newHistoryRouter(t)
+	doc := loadOpenAPI(t)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/resolve", strings.NewReader(`{"name":"Example.com","type":"A","servers":["127.0.0.1","127.0.0.2"]}`)))
+	var live ResolveResponse
+	json.Unmarshal(w.Body.Bytes(), &live)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/checks/"+live.CheckID+"/export", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: %d %s", w.Code, w.Body.String())
+	}
+	schema, err := doc.responseSchema("/api/checks/{id}/export", "GET", w.Code, w.Header().Get("content-type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.checkJSON(t, schema, w.Body.Bytes(), "export response")
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="dnsprop-example.com-A-`+live.CheckID+`.json"` {
+		t.Fatalf("unexpected Content-Disposition %q", cd)
+	}
+	exported := w.Body.Bytes()
+	var bundle CheckBundle
+	json.Unmarshal(exported, &bundle)
+	if bundle.Format != BundleFormat || bundle.Version != BundleVersion || bundle.Check.ID != live.CheckID ||
+		len(bundle.Results) != 2 || len(bundle.Servers) != 2 || bundle.Summary.Servers != 2 || bundle.Summary.Unreachable != 2 ||
+		strings.Join(bundle.Request.Servers, ",") != "127.0.0.1,127.0.0.2" {
+		t.Fatalf("unexpected bundle: %s", exported)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/checks/import", strings.NewReader(string(exported))))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("import: %d %s", w.Code, w.Body.String())
+	}
+	schema, _ = doc.responseSchema("/api/checks/import", "POST", w.Code, w.Header().Get("content-type"))
+	doc.checkJSON(t, schema, w.Body.Bytes(), "import response")
+	var imported CheckResponse
+	json.Unmarshal(w.Body.Bytes(), &imported)
+	if imported.ID == live.CheckID || !strings.HasPrefix(imported.Source, "import "+live.CheckID) || w.Header().Get("Location") != "/api/checks/"+imported.ID {
+		t.Fatalf("unexpected import: %+v, location %q", imported, w.Header().Get("Location"))
+	}
+
+	// The imported check has a permalink, is listed apart from the checks this server ran and
+	// diffs against the original.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/checks/"+imported.ID, nil))
+	var got CheckResponse
+	json.Unmarshal(w.Body.Bytes(), &got)
+	var stored ResolveResponse
+	if err := json.Unmarshal(got.Response, &stored); err != nil || stored.CheckID != imported.ID || len(stored.Results) != 2 {
+		t.Fatalf("unexpected stored response: %s", got.Response)
+	}
+	listChecks := func(query string) []history.Check {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/history?name=example.com"+query, nil))
+		var page HistoryPage
+		json.Unmarshal(w.Body.Bytes(), &page)
+		return page.Checks
+	}
+	if checks := listChecks(""); len(checks) != 1 || checks[0].ID != live.CheckID {
+		t.Fatalf("expected only the live check in history, got %+v", checks)
+	}
+	if checks := listChecks("&imported=true"); len(checks) != 1 || checks[0].ID != imported.ID {
+		t.Fatalf("expected the import under imported=true, got %+v", checks)
+	}
+	before, _ := json.Marshal(live)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/diff", strings.NewReader(`{"before":`+string(before)+`,"after":`+string(got.Response)+`}`)))
+	var diff DiffResponse
+	json.Unmarshal(w.Body.Bytes(), &diff)
+	if w.Code != http.StatusOK || diff.Summary.Unchanged != 2 {
+		t.Fatalf("unexpected diff: %d %s", w.Code, w.Body.String())
+	}
+	// Stored checks can also be named by ID.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/diff", strings.NewReader(`{"before_id":"`+live.CheckID+`","after_id":"`+imported.ID+`"}`)))
+	diff = DiffResponse{}
+	json.Unmarshal(w.Body.Bytes(), &diff)
+	if w.Code != http.StatusOK || diff.Summary.Unchanged != 2 {
+		t.Fatalf("unexpected diff by ID: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCheck_ImportInvalid(t *testing.T) {
+	router := newHistoryRouter(t)
+	result := `{"server":"127.0.0.1","latitude":0,"longitude":0,"status":"ok","when":"2024-01-01T00:00:00Z"}`
+	bundle := func(format string, version int, name, results string) string {
+		b, _ := json.Marshal(map[string]any{"format": format, "version": version, "request": map[string]string{"name": name, "type": "A"}, "results": json.RawMessage(results)})
+		return string(b)
+	}
+	for body, code := range map[string]string{
+		`{bad`: "invalid_json",
+		bundle("other", 1, "example.com", "["+result+"]"):                                 "invalid_request",
+		bundle(BundleFormat, 2, "example.com", "["+result+"]"):                            "invalid_request",
+		bundle(BundleFormat, 1, "", "["+result+"]"):                                       "invalid_domain",
+		bundle(BundleFormat, 1, "example.com", "[]"):                                      "invalid_request",
+		bundle(BundleFormat, 1, "example.com", `[{"server":"dns.google","status":"ok"}]`): "invalid_server",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/checks/import", strings.NewReader(body)))
+		assertProblem(t, w, http.StatusBadRequest, code)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/checks/import", strings.NewReader(`{"pad":"`+strings.Repeat("x", maxBundleBytes)+`"}`)))
+	assertProblem(t, w, http.StatusRequestEntityTooLarge, "invalid_request")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/checks/0123456789abcdef0123456789abcdef/export", nil))
+	assertProblem(t, w, http.StatusNotFound, "not_found")
+}
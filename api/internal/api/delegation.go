@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/legertom/dnsprop/api/internal/config"
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+	"github.com/legertom/dnsprop/api/internal/problem"
+	"github.com/legertom/dnsprop/api/internal/validation"
+)
+
+// ZoneRequest is the body accepted by the zone diagnostics endpoints.
+type ZoneRequest struct {
+	Name string `json:"name"`
+}
+
+// DelegationHandler compares a zone's parent referral and glue with its own NS RRset.
+func DelegationHandler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, ok := decodeZoneRequest(w, r)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.CheckTimeout)
+		defer cancel()
+
+		report := resolver.CheckDelegation(ctx, name, cfg.Resolvers, cfg.RequestTimeout)
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// NameserversHandler reports the health of each authoritative nameserver of a zone.
+func NameserversHandler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, ok := decodeZoneRequest(w, r)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.CheckTimeout)
+		defer cancel()
+
+		report := resolver.CheckNameservers(ctx, name, cfg.Resolvers, cfg.RequestTimeout)
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// decodeZoneRequest parses and validates a ZoneRequest, writing a 400 on failure.
+func decodeZoneRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req ZoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "invalid json")
+		return "", false
+	}
+	name, err := validation.ValidateDomainName(req.Name)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, err)
+		return "", false
+	}
+	return name, true
+}
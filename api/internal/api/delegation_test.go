@@ -0,0 +1,28 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDelegationHandler_InvalidDomain(t *testing.T) {
+	h := DelegationHandler(testConfig())
+	r := httptest.NewRequest(http.MethodPost, "/api/delegation", bytes.NewBufferString(`{"name":"ex@mple.com"}`))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestNameserversHandler_InvalidJSON(t *testing.T) {
+	h := NameserversHandler(testConfig())
+	r := httptest.NewRequest(http.MethodPost, "/api/nameservers", bytes.NewBufferString("{bad"))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
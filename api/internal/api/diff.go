@@ -0,0 +1,233 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/legertom/dnsprop/api/internal/config"
+	"github.com/legertom/dnsprop/api/internal/history"
+	"github.com/legertom/dnsprop/api/internal/problem"
+)
+
+// Per-server change kinds in a DiffResponse.
+const (
+	ChangeUnchanged = "unchanged"
+	ChangeChanged   = "changed" // status or answer set differs
+	ChangeAdded     = "added"   // server only present in the after snapshot
+	ChangeRemoved   = "removed" // server only present in the before snapshot
+)
+
+// DiffRequest names each side either by snapshot or by the ID of a stored check.
+type DiffRequest struct {
+	Before   *ResolveResponse `json:"before,omitempty"`
+	After    *ResolveResponse `json:"after,omitempty"`
+	BeforeID string           `json:"before_id,omitempty"`
+	AfterID  string           `json:"after_id,omitempty"`
+}
+
+type TTLChange struct {
+	Value  string `json:"value"`
+	Before uint32 `json:"before"`
+	After  uint32 `json:"after"`
+}
+
+type ServerDiff struct {
+	Server         string      `json:"server"`
+	Region         string      `json:"region,omitempty"`
+	Change         string      `json:"change"`
+	StatusBefore   string      `json:"status_before,omitempty"`
+	StatusAfter    string      `json:"status_after,omitempty"`
+	AnswersAdded   []string    `json:"answers_added,omitempty"`
+	AnswersRemoved []string    `json:"answers_removed,omitempty"`
+	TTLChanges     []TTLChange `json:"ttl_changes,omitempty"`
+	RTTDeltaMs     float64     `json:"rtt_delta_ms"`
+}
+
+type DiffSummary struct {
+	Servers        int     `json:"servers"`
+	Unchanged      int     `json:"unchanged"`
+	Changed        int     `json:"changed"`
+	Added          int     `json:"added"`
+	Removed        int     `json:"removed"`
+	StatusChanges  int     `json:"status_changes"`
+	AnswerChanges  int     `json:"answer_changes"`
+	TTLChanges     int     `json:"ttl_changes"`
+	MeanRTTDeltaMs float64 `json:"mean_rtt_delta_ms"`
+	// AnswersBefore/AnswersAfter count servers per distinct answer set ("" for no answers).
+	AnswersBefore map[string]int `json:"answers_before"`
+	AnswersAfter  map[string]int `json:"answers_after"`
+}
+
+type DiffResponse struct {
+	Name    string       `json:"name"`
+	Type    string       `json:"type"`
+	Servers []ServerDiff `json:"servers"`
+	Summary DiffSummary  `json:"summary"`
+}
+
+// DiffHandler compares two resolve snapshots of the same name and type, e.g. taken before and
+// after a DNS change, and reports which resolvers flipped. Either side can be a stored check
+// (including an imported one) named by before_id or after_id instead.
+func DiffHandler(cfg *config.Config, store history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req DiffRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "invalid json")
+			return
+		}
+		if (req.Before == nil) == (req.BeforeID == "") || (req.After == nil) == (req.AfterID == "") {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "give exactly one of before or before_id and one of after or after_id")
+			return
+		}
+		var ok bool
+		if req.BeforeID != "" {
+			if req.Before, ok = loadSnapshot(w, r, cfg, store, req.BeforeID); !ok {
+				return
+			}
+		}
+		if req.AfterID != "" {
+			if req.After, ok = loadSnapshot(w, r, cfg, store, req.AfterID); !ok {
+				return
+			}
+		}
+		if !strings.EqualFold(req.Before.Name, req.After.Name) || !strings.EqualFold(req.Before.Type, req.After.Type) {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "snapshots must be for the same name and type")
+			return
+		}
+
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(diffSnapshots(*req.Before, *req.After))
+	}
+}
+
+// loadSnapshot returns the response stored with check id, writing a problem and returning false
+// when there is no such check.
+func loadSnapshot(w http.ResponseWriter, r *http.Request, cfg *config.Config, store history.Store, id string) (*ResolveResponse, bool) {
+	c, _, ok := loadCheckID(w, r, cfg, store, id)
+	if !ok {
+		return nil, false
+	}
+	var resp ResolveResponse
+	if err := json.Unmarshal(c.Response, &resp); err != nil {
+		slog.ErrorContext(r.Context(), "history_decode_failed", slog.String("id", c.ID), slog.String("error", err.Error()))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "could not read check")
+		return nil, false
+	}
+	return &resp, true
+}
+
+// diffSnapshots matches results by server. Servers keep the order of the before snapshot,
+// followed by servers that only appear after.
+func diffSnapshots(before, after ResolveResponse) DiffResponse {
+	out := DiffResponse{
+		Name:    after.Name,
+		Type:    after.Type,
+		Servers: []ServerDiff{},
+		Summary: DiffSummary{AnswersBefore: answerGroups(before.Results), AnswersAfter: answerGroups(after.Results)},
+	}
+	afterBy := make(map[string]Result, len(after.Results))
+	for _, res := range after.Results {
+		afterBy[res.Server] = res
+	}
+	seen := map[string]struct{}{}
+	rttSum, rttCount := 0.0, 0
+
+	for _, b := range before.Results {
+		seen[b.Server] = struct{}{}
+		a, ok := afterBy[b.Server]
+		if !ok {
+			out.Servers = append(out.Servers, ServerDiff{Server: b.Server, Region: b.Region, Change: ChangeRemoved, StatusBefore: b.Status})
+			out.Summary.Removed++
+			continue
+		}
+		d := diffResult(b, a)
+		out.Servers = append(out.Servers, d)
+		rttSum += d.RTTDeltaMs
+		rttCount++
+		if d.Change == ChangeChanged {
+			out.Summary.Changed++
+		} else {
+			out.Summary.Unchanged++
+		}
+		if d.StatusBefore != d.StatusAfter {
+			out.Summary.StatusChanges++
+		}
+		if len(d.AnswersAdded) > 0 || len(d.AnswersRemoved) > 0 {
+			out.Summary.AnswerChanges++
+		}
+		if len(d.TTLChanges) > 0 {
+			out.Summary.TTLChanges++
+		}
+	}
+	for _, a := range after.Results {
+		if _, ok := seen[a.Server]; ok {
+			continue
+		}
+		out.Servers = append(out.Servers, ServerDiff{Server: a.Server, Region: a.Region, Change: ChangeAdded, StatusAfter: a.Status})
+		out.Summary.Added++
+	}
+	out.Summary.Servers = len(out.Servers)
+	if rttCount > 0 {
+		out.Summary.MeanRTTDeltaMs = rttSum / float64(rttCount)
+	}
+	return out
+}
+
+func diffResult(b, a Result) ServerDiff {
+	d := ServerDiff{
+		Server:       a.Server,
+		Region:       a.Region,
+		Change:       ChangeUnchanged,
+		StatusBefore: b.Status,
+		StatusAfter:  a.Status,
+		RTTDeltaMs:   a.RTTMs - b.RTTMs,
+	}
+	beforeTTL := answerTTLs(b.Answers)
+	afterTTL := answerTTLs(a.Answers)
+	for _, v := range sortedKeys(afterTTL) {
+		ttl, ok := beforeTTL[v]
+		switch {
+		case !ok:
+			d.AnswersAdded = append(d.AnswersAdded, v)
+		case ttl != afterTTL[v]:
+			d.TTLChanges = append(d.TTLChanges, TTLChange{Value: v, Before: ttl, After: afterTTL[v]})
+		}
+	}
+	for _, v := range sortedKeys(beforeTTL) {
+		if _, ok := afterTTL[v]; !ok {
+			d.AnswersRemoved = append(d.AnswersRemoved, v)
+		}
+	}
+	if b.Status != a.Status || len(d.AnswersAdded) > 0 || len(d.AnswersRemoved) > 0 {
+		d.Change = ChangeChanged
+	}
+	return d
+}
+
+func answerTTLs(ans []Answer) map[string]uint32 {
+	out := make(map[string]uint32, len(ans))
+	for _, a := range ans {
+		out[a.Value] = a.TTL
+	}
+	return out
+}
+
+func answerGroups(results []Result) map[string]int {
+	out := map[string]int{}
+	for _, res := range results {
+		out[strings.Join(sortedKeys(answerTTLs(res.Answers)), ", ")]++
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	before := ResolveResponse{Name: "example.com", Type: "A", Results: []Result{
+		{Server: "1.1.1.1", Status: "ok", RTTMs: 10, Answers: []Answer{{Value: "192.0.2.1", TTL: 300}}},
+		{Server: "8.8.8.8", Status: "ok", RTTMs: 20, Answers: []Answer{{Value: "192.0.2.1", TTL: 300}}},
+		{Server: "9.9.9.9", Status: "timeout"},
+	}}
+	after := ResolveResponse{Name: "example.com", Type: "A", Results: []Result{
+		{Server: "1.1.1.1", Status: "ok", RTTMs: 14, Answers: []Answer{{Value: "192.0.2.2", TTL: 60}}},
+		{Server: "8.8.8.8", Status: "ok", RTTMs: 20, Answers: []Answer{{Value: "192.0.2.1", TTL: 120}}},
+		{Server: "4.2.2.1", Status: "ok", Answers: []Answer{{Value: "192.0.2.2", TTL: 60}}},
+	}}
+
+	d := diffSnapshots(before, after)
+	if len(d.Servers) != 4 {
+		t.Fatalf("expected 4 server diffs, got %+v", d.Servers)
+	}
+	cf := d.Servers[0]
+	if cf.Change != ChangeChanged || len(cf.AnswersAdded) != 1 || cf.AnswersAdded[0] != "192.0.2.2" ||
+		len(cf.AnswersRemoved) != 1 || cf.RTTDeltaMs != 4 {
+		t.Fatalf("1.1.1.1 diff: %+v", cf)
+	}
+	if g := d.Servers[1]; g.Change != ChangeUnchanged || len(g.TTLChanges) != 1 || g.TTLChanges[0].After != 120 {
+		t.Fatalf("8.8.8.8 diff: %+v", g)
+	}
+	if d.Servers[2].Change != ChangeRemoved || d.Servers[3].Change != ChangeAdded {
+		t.Fatalf("expected removed then added, got %+v", d.Servers[2:])
+	}
+	s := d.Summary
+	if s.Changed != 1 || s.Unchanged != 1 || s.Added != 1 || s.Removed != 1 || s.TTLChanges != 1 || s.MeanRTTDeltaMs != 2 {
+		t.Fatalf("unexpected summary: %+v", s)
+	}
+	if s.AnswersAfter["192.0.2.2"] != 2 {
+		t.Fatalf("answer groups after: %v", s.AnswersAfter)
+	}
+}
+
+func TestDiffHandler_MismatchedSnapshots(t *testing.T) {
+	body, _ := json.Marshal(DiffRequest{
+		Before: &ResolveResponse{Name: "example.com", Type: "A"},
+		After:  &ResolveResponse{Name: "example.com", Type: "MX"},
+	})
+	w := httptest.NewRecorder()
+	DiffHandler(testConfig(), nil).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/diff", bytes.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestDiffHandler_ByID(t *testing.T) {
+	router := newHistoryRouter(t)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/resolve", strings.NewReader(`{"name":"example.com","type":"A","servers":["127.0.0.1"]}`)))
+	var live ResolveResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &live); err != nil || live.CheckID == "" {
+		t.Fatalf("resolve: %d %s", w.Code, w.Body.String())
+	}
+	snapshot, _ := json.Marshal(ResolveResponse{Name: "example.com", Type: "A", Results: []Result{{Server: "127.0.0.1", Status: "ok"}}})
+
+	for _, tc := range []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"before_id":"` + live.CheckID + `","after":` + string(snapshot) + `}`, http.StatusOK, ""},
+		{`{"before_id":"` + live.CheckID + `","after_id":"` + strings.Repeat("0", 32) + `"}`, http.StatusNotFound, "not_found"},
+		{`{"before_id":"` + live.CheckID + `","before":` + string(snapshot) + `,"after":` + string(snapshot) + `}`, http.StatusBadRequest, "invalid_request"},
+		{`{"before_id":"` + live.CheckID + `"}`, http.StatusBadRequest, "invalid_request"},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/diff", strings.NewReader(tc.body)))
+		if tc.status == http.StatusOK {
+			var diff DiffResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &diff); w.Code != http.StatusOK || err != nil || len(diff.Servers) != 1 || diff.Servers[0].Change != ChangeChanged {
+				t.Fatalf("%s: unexpected diff: %d %s", tc.body, w.Code, w.Body.String())
+			}
+			continue
+		}
+		assertProblem(t, w, tc.status, tc.code)
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Resolve output formats selectable with the Accept header.
+const (
+	formatJSON   = "application/json"
+	formatNDJSON = ndjsonContentType
+	formatCSV    = "text/csv"
+	formatText   = "text/plain"
+)
+
+var resolveFormats = []string{formatJSON, formatNDJSON, formatCSV, formatText}
+
+// csvHeader matches the columns of the web app's CSV export, plus the fields it leaves out.
+var csvHeader = []string{"server", "region", "status", "rtt_ms", "answers", "ttls", "ad", "stale", "propagated_by", "when"}
+
+// negotiateFormat picks the supported format with the highest q-value in accept. Wildcards and
+// unsupported or missing Accept headers get JSON; on a tie the earlier entry wins.
+func negotiateFormat(accept string) string {
+	best, bestQ := formatJSON, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		for _, f := range resolveFormats {
+			if mt == f && q > bestQ {
+				best, bestQ = f, q
+			}
+		}
+	}
+	return best
+}
+
+// writeResolveResponse writes out in the format the client asked for.
+func writeResolveResponse(w http.ResponseWriter, r *http.Request, out ResolveResponse) {
+	format := negotiateFormat(r.Header.Get("Accept"))
+	w.Header().Add("Vary", "Accept")
+	switch format {
+	case formatNDJSON:
+		w.Header().Set("content-type", ndjsonContentType)
+		enc := json.NewEncoder(w)
+		for _, res := range out.Results {
+			enc.Encode(res)
+		}
+	case formatCSV:
+		w.Header().Set("content-type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="dns-%s-%s.csv"`, out.Name, out.Type))
+		writeCSV(w, out)
+	case formatText:
+		w.Header().Set("content-type", "text/plain; charset=utf-8")
+		writeDigText(w, out)
+	default:
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+func writeCSV(w io.Writer, out ResolveResponse) {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, res := range out.Results {
+		values := make([]string, 0, len(res.Answers))
+		ttls := make([]string, 0, len(res.Answers))
+		for _, a := range res.Answers {
+			values = append(values, a.Value)
+			ttls = append(ttls, strconv.FormatUint(uint64(a.TTL), 10))
+		}
+		rtt := ""
+		if res.RTTMs > 0 {
+			rtt = strconv.FormatFloat(res.RTTMs, 'f', 1, 64)
+		}
+		cw.Write([]string{
+			res.Server, res.Region, res.Status, rtt,
+			strings.Join(values, "; "), strings.Join(ttls, "; "),
+			strconv.FormatBool(res.AD), strconv.FormatBool(res.Stale), res.PropagatedBy, res.When,
+		})
+	}
+	cw.Flush()
+}
+
+// writeDigText prints a section per resolver in the style of dig's answer section, so results can
+// be grepped and diffed with shell tools.
+func writeDigText(w io.Writer, out ResolveResponse) {
+	owner := out.Name
+	if !strings.HasSuffix(owner, ".") {
+		owner += "."
+	}
+	fmt.Fprintf(w, "; <<>> wtfdns <<>> %s %s\n", out.Name, out.Type)
+	if p := out.Propagation; p != nil {
+		fmt.Fprintf(w, ";; propagation: %d current, %d stale, %d unknown; fully propagated by %s\n", p.Current, p.Stale, p.Unknown, p.FullyPropagatedBy)
+	}
+	for _, res := range out.Results {
+		fmt.Fprintf(w, "\n;; SERVER: %s", res.Server)
+		if res.Region != "" {
+			fmt.Fprintf(w, " (%s)", res.Region)
+		}
+		fmt.Fprintf(w, "\n;; status: %s, rtt: %.1f ms, when: %s", res.Status, res.RTTMs, res.When)
+		if res.AD {
+			fmt.Fprint(w, ", flags: ad")
+		}
+		if res.Stale {
+			fmt.Fprintf(w, ", stale until %s", res.PropagatedBy)
+		}
+		fmt.Fprintln(w)
+
+		tw := tabwriter.NewWriter(w, 0, 8, 1, '\t', 0)
+		for _, a := range res.Answers {
+			fmt.Fprintf(tw, "%s\t%d\tIN\t%s\t%s\n", owner, a.TTL, out.Type, a.Value)
+		}
+		tw.Flush()
+		for _, rr := range res.Authority {
+			fmt.Fprintf(w, ";; AUTHORITY: %s\n", rr)
+		}
+	}
+}
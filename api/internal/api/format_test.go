@@ -0,0 +1,105 @@
+package api
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	cases := map[string]string{
+		"":                                       formatJSON,
+		"*/*":                                    formatJSON,
+		"text/html":                              formatJSON,
+		"text/csv":                               formatCSV,
+		"application/x-ndjson":                   formatNDJSON,
+		"text/plain; charset=utf-8":              formatText,
+		"text/csv;q=0.5, text/plain":             formatText,
+		"application/json, text/csv":             formatJSON,
+		"text/csv;q=0.9, application/json;q=0.1": formatCSV,
+		"text/csv;q=bad, text/plain;q=0.2":       formatText,
+	}
+	for accept, want := range cases {
+		if got := negotiateFormat(accept); got != want {
+			t.Errorf("negotiateFormat(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func resolveAs(t *testing.T, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+	body := `{"name":"example.com","type":"A","servers":["127.0.0.1","127.0.0.2"]}`
+	r := httptest.NewRequest(http.MethodPost, "/api/resolve", strings.NewReader(body))
+	r.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+	ResolveHandler(testConfig(), nil, nil)(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Vary") != "Accept" {
+		t.Fatalf("expected Vary: Accept, got %q", w.Header().Get("Vary"))
+	}
+	return w
+}
+
+func TestResolve_CSV(t *testing.T) {
+	w := resolveAs(t, "text/csv")
+	if ct := w.Header().Get("content-type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("content-type = %q", ct)
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || strings.Join(rows[0], ",") != strings.Join(csvHeader, ",") {
+		t.Fatalf("expected header plus 2 rows, got %v", rows)
+	}
+	servers := []string{rows[1][0], rows[2][0]}
+	sort.Strings(servers)
+	if strings.Join(servers, ",") != "127.0.0.1,127.0.0.2" {
+		t.Fatalf("unexpected servers: %v", rows[1:])
+	}
+}
+
+func TestResolve_NDJSON(t *testing.T) {
+	w := resolveAs(t, "application/x-ndjson")
+	var servers []string
+	sc := bufio.NewScanner(w.Body)
+	for sc.Scan() {
+		var res Result
+		if err := json.Unmarshal(sc.Bytes(), &res); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		servers = append(servers, res.Server)
+	}
+	sort.Strings(servers)
+	if strings.Join(servers, ",") != "127.0.0.1,127.0.0.2" {
+		t.Fatalf("expected one line per server, got %v", servers)
+	}
+}
+
+func TestResolve_DigText(t *testing.T) {
+	w := resolveAs(t, "text/plain")
+	out := w.Body.String()
+	for _, want := range []string{"; <<>> wtfdns <<>> example.com A", ";; SERVER: 127.0.0.1", ";; SERVER: 127.0.0.2"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteDigText_Answers(t *testing.T) {
+	var b strings.Builder
+	writeDigText(&b, ResolveResponse{Name: "example.com", Type: "A", Results: []Result{{
+		Server: "1.1.1.1", Status: "ok", RTTMs: 12.5, When: "2024-01-01T00:00:00Z",
+		Answers: []Answer{{Value: "192.0.2.1", TTL: 300}},
+	}}})
+	if !strings.Contains(b.String(), "example.com.\t300\tIN\tA\t192.0.2.1\n") {
+		t.Fatalf("missing answer record:\n%s", b.String())
+	}
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/legertom/dnsprop/api/internal/config"
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+	"github.com/legertom/dnsprop/api/internal/grpcjson"
+	"github.com/legertom/dnsprop/api/internal/history"
+	"github.com/legertom/dnsprop/api/internal/problem"
+	"github.com/legertom/dnsprop/api/internal/ratelimit"
+	"github.com/legertom/dnsprop/api/internal/validation"
+)
+
+// gRPC service and method names. Messages are JSON-encoded (content-subtype "json") and use the
+// same shapes as the HTTP API. There is no .proto: the server decodes every call as JSON, so
+// protobuf clients, grpcurl and reflection are not supported.
+const (
+	GRPCServiceName         = "dnsprop.v1.DNSProp"
+	GRPCMethodResolve       = "/" + GRPCServiceName + "/Resolve"
+	GRPCMethodResolveStream = "/" + GRPCServiceName + "/ResolveStream"
+	GRPCMethodTrace         = "/" + GRPCServiceName + "/Trace"
+
+	// GRPCErrorDomain is the ErrorInfo domain attached to failed calls; Reason holds the same
+	// stable code as the HTTP problem responses.
+	GRPCErrorDomain = "dnsprop"
+)
+
+// ResolveStreamMessage is sent once per resolver result, then once with the summary.
+type ResolveStreamMessage struct {
+	Result  *Result        `json:"result,omitempty"`
+	Summary *StreamSummary `json:"summary,omitempty"`
+}
+
+type TraceRequest struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// grpcServer is implemented by grpcService; ServiceDesc.HandlerType needs an interface.
+type grpcServer interface {
+	resolve(ctx context.Context, req *ResolveRequest) (*ResolveResponse, error)
+	resolveStream(req *ResolveRequest, stream grpc.ServerStream) error
+	trace(req *TraceRequest, stream grpc.ServerStream) error
+}
+
+type grpcService struct {
+	cfg   *config.Config
+	cache resolver.Cache
+	store history.Store
+}
+
+// NewGRPCServer returns a gRPC server exposing Resolve, ResolveStream and Trace. It shares the
+// HTTP API's config, cache, limiter and history store; every call consumes one token.
+func NewGRPCServer(cfg *config.Config, cache resolver.Cache, limiter *ratelimit.Limiter, store history.Store, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append([]grpc.ServerOption{
+		grpc.ForceServerCodec(grpcjson.Codec{}),
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if !limiter.Allow(peerIP(ctx)) {
+				return nil, rateLimitedStatus()
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if !limiter.Allow(peerIP(ss.Context())) {
+				return rateLimitedStatus()
+			}
+			return handler(srv, ss)
+		}),
+	}, opts...)
+	s := grpc.NewServer(opts...)
+	s.RegisterService(&grpcServiceDesc, &grpcService{cfg: cfg, cache: cache, store: store})
+	return s
+}
+
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: GRPCServiceName,
+	HandlerType: (*grpcServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Resolve",
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := new(ResolveRequest)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			call := func(ctx context.Context, req any) (any, error) {
+				return srv.(grpcServer).resolve(ctx, req.(*ResolveRequest))
+			}
+			if interceptor == nil {
+				return call(ctx, req)
+			}
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: GRPCMethodResolve}, call)
+		},
+	}},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ResolveStream",
+			ServerStreams: true,
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				req := new(ResolveRequest)
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(grpcServer).resolveStream(req, stream)
+			},
+		},
+		{
+			StreamName:    "Trace",
+			ServerStreams: true,
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				req := new(TraceRequest)
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(grpcServer).trace(req, stream)
+			},
+		},
+	},
+	Metadata: "dnsprop/v1 (JSON codec)",
+}
+
+func (s *grpcService) resolve(ctx context.Context, req *ResolveRequest) (*ResolveResponse, error) {
+	servers, err := normalizeResolveRequest(s.cfg, req)
+	if err != nil {
+		return nil, invalidArgumentStatus(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.RequestTimeout)
+	defer cancel()
+	run := runResolve(ctx, s.cfg, s.cache, *req, servers)
+	recordCheck(ctx, s.store, &run, checkMeta{source: "grpc " + GRPCMethodResolve})
+	out := run.v1()
+	return &out, nil
+}
+
+func (s *grpcService) resolveStream(req *ResolveRequest, stream grpc.ServerStream) error {
+	servers, err := normalizeResolveRequest(s.cfg, req)
+	if err != nil {
+		return invalidArgumentStatus(err)
+	}
+	ctx, cancel := context.WithTimeout(stream.Context(), s.cfg.RequestTimeout)
+	defer cancel()
+
+	var sendErr error
+	summary := streamResolve(ctx, s.cfg, s.cache, *req, servers, func(rr resolver.Result) {
+		if sendErr != nil {
+			return
+		}
+		res := toResult(rr)
+		if sendErr = stream.SendMsg(&ResolveStreamMessage{Result: &res}); sendErr != nil {
+			cancel() // client went away; stop querying
+		}
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	return stream.SendMsg(&ResolveStreamMessage{Summary: &summary})
+}
+
+func (s *grpcService) trace(req *TraceRequest, stream grpc.ServerStream) error {
+	name, err := validation.ValidateDomainName(req.Name)
+	if err != nil {
+		return invalidArgumentStatus(err)
+	}
+	qtype := req.Type
+	if qtype == "" {
+		qtype = "A"
+	}
+	if err := validation.ValidateRecordType(qtype); err != nil {
+		return invalidArgumentStatus(err)
+	}
+	ctx, cancel := context.WithTimeout(stream.Context(), s.cfg.CheckTimeout)
+	defer cancel()
+
+	var sendErr error
+	err = resolver.Trace(ctx, name, qtype, s.cfg.Resolvers, s.cfg.RequestTimeout, func(h resolver.TraceHop) {
+		if sendErr == nil {
+			sendErr = stream.SendMsg(&h)
+		}
+	})
+	switch {
+	case sendErr != nil:
+		return sendErr
+	case err != nil:
+		return codedStatus(codes.Unavailable, problem.CodeUnavailable, err.Error())
+	}
+	return nil
+}
+
+func invalidArgumentStatus(err error) error {
+	return codedStatus(codes.InvalidArgument, problem.CodeOf(err, problem.CodeInvalidRequest), err.Error())
+}
+
+func rateLimitedStatus() error {
+	return codedStatus(codes.ResourceExhausted, problem.CodeRateLimited, "rate limited")
+}
+
+// codedStatus attaches the stable error code as an ErrorInfo detail.
+func codedStatus(c codes.Code, code, msg string) error {
+	st, err := status.New(c, msg).WithDetails(&errdetails.ErrorInfo{Reason: code, Domain: GRPCErrorDomain})
+	if err != nil {
+		return status.Error(c, msg)
+	}
+	return st.Err()
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -9,14 +9,22 @@ import (
 
 	"github.com/legertom/dnsprop/api/internal/config"
 	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+	"github.com/legertom/dnsprop/api/internal/history"
+	"github.com/legertom/dnsprop/api/internal/problem"
 	"github.com/legertom/dnsprop/api/internal/validation"
 )
 
+var errInvalidDNSSEC = &validation.Error{Code: problem.CodeInvalidDNSSEC, Message: "dnssec must be true or false"}
+var errInvalidETA = &validation.Error{Code: problem.CodeInvalidRequest, Message: "eta must be true or false"}
+
 type ResolveRequest struct {
 	Name    string   `json:"name"`
 	Type    string   `json:"type"`
 	Servers []string `json:"servers,omitempty"`
 	DNSSEC  bool     `json:"dnssec,omitempty"`
+	// ETA also asks the zone's own nameservers for the answer, so stale resolvers can be given a
+	// propagation estimate. That takes several extra lookups, so it is off unless requested.
+	ETA bool `json:"eta,omitempty"`
 }
 
 type Answer struct {
@@ -35,15 +43,34 @@ type Result struct {
 	Authority []string `json:"authority,omitempty"`
 	AD        bool     `json:"ad,omitempty"`
 	When      string   `json:"when"`
+	// Stale is set when the answer differs from the authoritative one; PropagatedBy is then
+	// the time the cached answer expires.
+	Stale        bool   `json:"stale,omitempty"`
+	PropagatedBy string `json:"propagated_by,omitempty"`
+}
+
+// Propagation summarizes how far the resolvers are from the authoritative answer.
+type Propagation struct {
+	AuthoritativeStatus  string   `json:"authoritative_status"`
+	AuthoritativeAnswers []Answer `json:"authoritative_answers,omitempty"`
+	AuthoritativeTTL     uint32   `json:"authoritative_ttl"`
+	Current              int      `json:"current"`
+	Stale                int      `json:"stale"`
+	Unknown              int      `json:"unknown"`
+	FullyPropagatedBy    string   `json:"fully_propagated_by"`
 }
 
 type ResolveResponse struct {
-	Name    string   `json:"name"`
-	Type    string   `json:"type"`
-	Results []Result `json:"results"`
+	Name        string       `json:"name"`
+	Type        string       `json:"type"`
+	Results     []Result     `json:"results"`
+	Propagation *Propagation `json:"propagation,omitempty"`
+	// CheckID identifies the stored check for GET /api/checks/{id}; empty when history is disabled.
+	CheckID string `json:"check_id,omitempty"`
 }
 
 func Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("ok"))
 }
@@ -84,78 +111,176 @@ func minDuration(a, b time.Duration) time.Duration {
 	return b
 }
 
-func ResolveHandler(cfg *config.Config, cache resolver.Cache) http.HandlerFunc {
+// ResolveHandler serves POST /api/resolve. The response is JSON unless Accept asks for NDJSON,
+// CSV or dig-style text.
+func ResolveHandler(cfg *config.Config, cache resolver.Cache, store history.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req ResolveRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid json", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "invalid json")
 			return
 		}
 
-		// Validate and normalize domain name
-		var err error
-		req.Name, err = validation.ValidateDomainName(req.Name)
+		servers, err := normalizeResolveRequest(cfg, &req)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.Error(w, r, http.StatusBadRequest, err)
 			return
 		}
 
-		// Validate record type
-		req.Type = strings.ToUpper(strings.TrimSpace(req.Type))
-		if err := validation.ValidateRecordType(req.Type); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		if len(req.Servers) == 0 {
-			req.Servers = cfg.Resolvers
-		}
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.RequestTimeout)
+		defer cancel()
+		run := runResolve(ctx, cfg, cache, req, servers)
+		recordCheck(r.Context(), store, &run, httpCheckMeta(r))
+		writeResolveResponse(w, r, run.v1())
+	}
+}
 
-		// Validate custom servers if provided
-		if len(req.Servers) > 0 {
-			if err := validation.ValidateServers(req.Servers, 50); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-		}
+// resolveRun is the outcome of a validated resolve request before it is shaped for an API
+// version. estimate is nil when the authoritative answer could not be obtained.
+type resolveRun struct {
+	req      ResolveRequest
+	servers  []string
+	results  []resolver.Result
+	estimate *resolver.PropagationEstimate
+	started  time.Time
+	duration time.Duration
+	// checkID is set once the run has been recorded to history.
+	checkID string
+}
 
-		servers := dedupe(req.Servers)
-		if len(servers) == 0 {
-			http.Error(w, "no resolvers configured", http.StatusBadRequest)
-			return
+// runResolve queries the resolvers and, when req.ETA is set, the zone's own nameservers in
+// parallel so stale resolvers can be given an ETA. Every API version is served from this.
+func runResolve(ctx context.Context, cfg *config.Config, cache resolver.Cache, req ResolveRequest, servers []string) resolveRun {
+	auth := startAuthoritative(ctx, cfg, req)
+	run := resolveRun{req: req, servers: servers, started: time.Now()}
+	run.results = resolver.Resolve(ctx, req.Name, req.Type, servers, req.DNSSEC, cfg.RequestTimeout, cache, cfg.CacheTTL)
+	if a, ok := auth(); ok {
+		est := resolver.EstimatePropagation(run.results, a)
+		run.estimate = &est
+	}
+	run.duration = time.Since(run.started)
+	return run
+}
+
+// queryAuthoritative is replaced in tests so they do not depend on live nameservers.
+var queryAuthoritative = resolver.QueryAuthoritative
+
+// startAuthoritative starts the authoritative lookup for req if it asked for an ETA. The returned
+// func waits for it and reports whether an answer was obtained.
+func startAuthoritative(ctx context.Context, cfg *config.Config, req ResolveRequest) func() (resolver.Result, bool) {
+	if !req.ETA {
+		return func() (resolver.Result, bool) { return resolver.Result{}, false }
+	}
+	var (
+		auth    resolver.Result
+		authErr error
+		done    = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		auth, authErr = queryAuthoritative(ctx, req.Name, req.Type, cfg.Resolvers, cfg.RequestTimeout)
+	}()
+	return func() (resolver.Result, bool) {
+		<-done
+		return auth, authErr == nil
+	}
+}
+
+// v1 shapes the run as the frozen v1 (and unversioned) ResolveResponse.
+func (run resolveRun) v1() ResolveResponse {
+	out := ResolveResponse{Name: run.req.Name, Type: run.req.Type, Results: make([]Result, 0, len(run.results)), CheckID: run.checkID}
+	for _, rr := range run.results {
+		out.Results = append(out.Results, toResult(rr))
+	}
+	if run.estimate != nil {
+		applyEstimate(&out, *run.estimate)
+	}
+	return out
+}
+
+// normalizeResolveRequest validates req in place and returns the deduplicated server list,
+// falling back to the configured resolvers when none are given.
+func normalizeResolveRequest(cfg *config.Config, req *ResolveRequest) ([]string, error) {
+	// Validate and normalize domain name
+	var err error
+	req.Name, err = validation.ValidateDomainName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate record type
+	req.Type = strings.ToUpper(strings.TrimSpace(req.Type))
+	if err := validation.ValidateRecordType(req.Type); err != nil {
+		return nil, err
+	}
+	if len(req.Servers) == 0 {
+		req.Servers = cfg.Resolvers
+	}
+
+	// Validate custom servers if provided
+	if len(req.Servers) > 0 {
+		if err := validation.ValidateServers(req.Servers, 50); err != nil {
+			return nil, err
 		}
+	}
 
-		ctx, cancel := context.WithTimeout(r.Context(), cfg.RequestTimeout)
-		defer cancel()
+	servers := dedupe(req.Servers)
+	if len(servers) == 0 {
+		return nil, &validation.Error{Code: problem.CodeNoResolvers, Message: "no resolvers configured"}
+	}
+	return servers, nil
+}
 
-		results := resolver.Resolve(ctx, req.Name, req.Type, servers, req.DNSSEC, cfg.RequestTimeout, cache, cfg.CacheTTL)
-
-		out := ResolveResponse{Name: req.Name, Type: req.Type, Results: make([]Result, 0, len(results))}
-		for _, rr := range results {
-			res := Result{
-				Server:    rr.Server,
-				Region:    rr.Region,
-				Latitude:  rr.Latitude,
-				Longitude: rr.Longitude,
-				Status:    rr.Status,
-				RTTMs:     rr.RTTMs,
-				When:      rr.When.UTC().Format(time.RFC3339),
-				AD:        rr.AD,
-			}
-			if len(rr.Answers) > 0 {
-				ans := make([]Answer, 0, len(rr.Answers))
-				for _, a := range rr.Answers {
-					ans = append(ans, Answer{Value: a.Value, TTL: a.TTL})
-				}
-				res.Answers = ans
-			}
-			if len(rr.Authority) > 0 {
-				res.Authority = rr.Authority
-			}
-			out.Results = append(out.Results, res)
+func toResult(rr resolver.Result) Result {
+	res := Result{
+		Server:    rr.Server,
+		Region:    rr.Region,
+		Latitude:  rr.Latitude,
+		Longitude: rr.Longitude,
+		Status:    rr.Status,
+		RTTMs:     rr.RTTMs,
+		When:      rr.When.UTC().Format(time.RFC3339),
+		AD:        rr.AD,
+	}
+	res.Answers = toAnswers(rr.Answers)
+	if len(rr.Authority) > 0 {
+		res.Authority = rr.Authority
+	}
+	return res
+}
+
+func toAnswers(in []resolver.Answer) []Answer {
+	if len(in) == 0 {
+		return nil
+	}
+	ans := make([]Answer, 0, len(in))
+	for _, a := range in {
+		ans = append(ans, Answer{Value: a.Value, TTL: a.TTL})
+	}
+	return ans
+}
+
+// applyEstimate copies per-server ETAs onto the results (matched by position) and adds the summary.
+func applyEstimate(out *ResolveResponse, est resolver.PropagationEstimate) {
+	for i, eta := range est.Servers {
+		if i >= len(out.Results) || eta.Current || eta.ExpiresAt.IsZero() {
+			continue
 		}
+		out.Results[i].Stale = true
+		out.Results[i].PropagatedBy = eta.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	out.Propagation = toPropagation(est)
+}
 
-		w.Header().Set("content-type", "application/json")
-		json.NewEncoder(w).Encode(out)
+func toPropagation(est resolver.PropagationEstimate) *Propagation {
+	return &Propagation{
+		AuthoritativeStatus:  est.Authoritative.Status,
+		AuthoritativeAnswers: toAnswers(est.Authoritative.Answers),
+		AuthoritativeTTL:     uint32(est.AuthoritativeTTL / time.Second),
+		Current:              est.Current,
+		Stale:                est.Stale,
+		Unknown:              est.Unknown,
+		FullyPropagatedBy:    est.FullyPropagatedBy.UTC().Format(time.RFC3339),
 	}
 }
 
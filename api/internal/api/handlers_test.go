@@ -2,31 +2,64 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/legertom/dnsprop/api/internal/config"
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+	"github.com/legertom/dnsprop/api/internal/problem"
+	"github.com/legertom/dnsprop/api/internal/ratelimit"
+	"github.com/legertom/dnsprop/api/internal/watch"
 )
 
 func testConfig() *config.Config {
 	return &config.Config{
-		Port:            "8080",
-		LogLevel:        "debug",
-		CorsOrigins:     []string{"http://localhost:5173"},
-		Resolvers:       []string{"1.1.1.1", "8.8.8.8"},
-		RequestTimeout:  200 * time.Millisecond,
-		EnableDNSSEC:    false,
-		CacheTTL:        100 * time.Millisecond,
-		CacheMaxEntries: 100,
-		RateLimitRPS:    100, // effectively disabled for tests
-		RateLimitBurst:  100,
-		RateLimitTTL:    time.Minute,
+		Port:                "8080",
+		LogLevel:            "debug",
+		CorsOrigins:         []string{"http://localhost:5173"},
+		Resolvers:           []string{"1.1.1.1", "8.8.8.8"},
+		RequestTimeout:      200 * time.Millisecond,
+		EnableDNSSEC:        false,
+		CacheTTL:            100 * time.Millisecond,
+		CacheMaxEntries:     100,
+		RateLimitRPS:        100, // effectively disabled for tests
+		RateLimitBurst:      100,
+		RateLimitTTL:        time.Minute,
+		CheckTimeout:        500 * time.Millisecond,
+		WatchMaxJobs:        2,
+		WatchMinInterval:    10 * time.Millisecond,
+		WatchMaxDuration:    time.Second,
+		BatchMaxItems:       3,
+		BatchConcurrency:    2,
+		BatchTimeout:        2 * time.Second,
+		BatchQueryRPS:       100,
+		BatchQueryBurst:     1000,
+		CheckExpiry:         time.Hour,
+		MonitorMaxCount:     10,
+		MonitorMinInterval:  time.Second,
+		ResultRetention:     24 * time.Hour,
+		HourlyRetention:     48 * time.Hour,
+		DailyRetention:      72 * time.Hour,
+		CompactInterval:     time.Hour,
+		WebhookMaxAttempts:  2,
+		WebhookRetryBackoff: 10 * time.Millisecond,
+		WebhookTimeout:      time.Second,
+		WebhookMaxCount:     10,
+		WebhookAllowPrivate: true,
+		SMTPTimeout:         time.Second,
 	}
 }
 
+// newTestRouter builds the router with its own limiter, as main does.
+func newTestRouter(cfg *config.Config) http.Handler {
+	return NewRouter(cfg, nil, ratelimit.NewLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst, cfg.RateLimitTTL), nil, nil, nil, watch.NewManager(cfg.WatchMaxJobs, cfg.RequestTimeout))
+}
+
 func TestHealthz(t *testing.T) {
 	r := httptest.NewRequest(http.MethodGet, "/api/healthz", nil)
 	w := httptest.NewRecorder()
@@ -41,58 +74,62 @@ func TestHealthz(t *testing.T) {
 
 func TestResolveHandler_InvalidJSON(t *testing.T) {
 	cfg := testConfig()
-	h := ResolveHandler(cfg, nil)
+	h := ResolveHandler(cfg, nil, nil)
 	r := httptest.NewRequest(http.MethodPost, "/api/resolve", bytes.NewBufferString("{bad json"))
 	w := httptest.NewRecorder()
 	h.ServeHTTP(w, r)
-	if w.Result().StatusCode != http.StatusBadRequest {
-		t.Fatalf("expected 400, got %d", w.Result().StatusCode)
-	}
+	assertProblem(t, w, http.StatusBadRequest, "invalid_json")
 }
 
 func TestResolveHandler_InvalidDomain(t *testing.T) {
 	cfg := testConfig()
-	h := ResolveHandler(cfg, nil)
+	h := ResolveHandler(cfg, nil, nil)
 	body := map[string]any{"name": "ex@mple.com", "type": "A"}
 	buf, _ := json.Marshal(body)
 	r := httptest.NewRequest(http.MethodPost, "/api/resolve", bytes.NewReader(buf))
 	w := httptest.NewRecorder()
 	h.ServeHTTP(w, r)
-	if w.Result().StatusCode != http.StatusBadRequest {
-		t.Fatalf("expected 400, got %d", w.Result().StatusCode)
-	}
+	assertProblem(t, w, http.StatusBadRequest, "invalid_domain")
 }
 
 func TestResolveHandler_InvalidType(t *testing.T) {
 	cfg := testConfig()
-	h := ResolveHandler(cfg, nil)
+	h := ResolveHandler(cfg, nil, nil)
 	body := map[string]any{"name": "example.com", "type": "PTR"}
 	buf, _ := json.Marshal(body)
 	r := httptest.NewRequest(http.MethodPost, "/api/resolve", bytes.NewReader(buf))
 	w := httptest.NewRecorder()
 	h.ServeHTTP(w, r)
-	if w.Result().StatusCode != http.StatusBadRequest {
-		t.Fatalf("expected 400, got %d", w.Result().StatusCode)
-	}
+	assertProblem(t, w, http.StatusBadRequest, "unsupported_type")
 }
 
 func TestResolveHandler_InvalidServers(t *testing.T) {
 	cfg := testConfig()
-	h := ResolveHandler(cfg, nil)
+	h := ResolveHandler(cfg, nil, nil)
 	body := map[string]any{"name": "example.com", "type": "A", "servers": []string{"dns.google"}}
 	buf, _ := json.Marshal(body)
 	r := httptest.NewRequest(http.MethodPost, "/api/resolve", bytes.NewReader(buf))
 	w := httptest.NewRecorder()
 	h.ServeHTTP(w, r)
-	if w.Result().StatusCode != http.StatusBadRequest {
-		t.Fatalf("expected 400, got %d", w.Result().StatusCode)
-	}
+	assertProblem(t, w, http.StatusBadRequest, "invalid_server")
+}
+
+// stubAuthoritative replaces the authoritative lookup behind the propagation estimate for the test.
+func stubAuthoritative(t *testing.T, fn func(ctx context.Context, name, qtype string, recursive []string, timeout time.Duration) (resolver.Result, error)) {
+	t.Helper()
+	prev := queryAuthoritative
+	queryAuthoritative = fn
+	t.Cleanup(func() { queryAuthoritative = prev })
 }
 
 func TestResolveHandler_ValidMinimal(t *testing.T) {
+	stubAuthoritative(t, func(context.Context, string, string, []string, time.Duration) (resolver.Result, error) {
+		t.Error("authoritative lookup made without eta")
+		return resolver.Result{}, errors.New("unexpected")
+	})
 	cfg := testConfig()
 	// Use localhost to keep quick failures/timeouts predictable
-	h := ResolveHandler(cfg, nil)
+	h := ResolveHandler(cfg, nil, nil)
 	body := map[string]any{"name": "example.com", "type": "A", "servers": []string{"127.0.0.1"}}
 	buf, _ := json.Marshal(body)
 	r := httptest.NewRequest(http.MethodPost, "/api/resolve", bytes.NewReader(buf))
@@ -110,6 +147,38 @@ func TestResolveHandler_ValidMinimal(t *testing.T) {
 	}
 }
 
+func TestResolveHandler_ETAIsOptIn(t *testing.T) {
+	var calls int
+	stubAuthoritative(t, func(_ context.Context, name, qtype string, _ []string, _ time.Duration) (resolver.Result, error) {
+		calls++
+		return resolver.Result{Server: "192.0.2.53", Status: "ok", Answers: []resolver.Answer{{Value: "192.0.2.80", TTL: 300, Type: "A"}}, QueriedAt: time.Now()}, nil
+	})
+	h := ResolveHandler(testConfig(), nil, nil)
+	for _, tc := range []struct {
+		body string
+		want bool
+	}{
+		{`{"name":"example.com","type":"A","servers":["127.0.0.1"]}`, false},
+		{`{"name":"example.com","type":"A","servers":["127.0.0.1"],"eta":true}`, true},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/resolve", bytes.NewBufferString(tc.body)))
+		var out ResolveResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("invalid json: %v", err)
+		}
+		if got := out.Propagation != nil; got != tc.want {
+			t.Fatalf("%s: propagation present = %v, want %v", tc.body, got, tc.want)
+		}
+		if tc.want && (out.Propagation.AuthoritativeTTL != 300 || out.Propagation.Unknown != 1) {
+			t.Fatalf("unexpected propagation %+v", out.Propagation)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected one authoritative lookup, got %d", calls)
+	}
+}
+
 func TestDedupe(t *testing.T) {
 	in := []string{"8.8.8.8", " ", "8.8.8.8", "1.1.1.1"}
 	out := dedupe(in)
@@ -117,3 +186,21 @@ func TestDedupe(t *testing.T) {
 		t.Fatalf("expected 2 unique servers, got %d (%v)", len(out), out)
 	}
 }
+
+// assertProblem checks that w holds a problem+json response with the given status and code.
+func assertProblem(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("expected %d, got %d: %s", status, w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("content-type"); ct != problem.ContentType {
+		t.Fatalf("expected %s, got %q", problem.ContentType, ct)
+	}
+	var p problem.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	if p.Code != code || p.Status != status || p.Detail == "" {
+		t.Fatalf("expected code %q, got %+v", code, p)
+	}
+}
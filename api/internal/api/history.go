@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/legertom/dnsprop/api/internal/config"
+	"github.com/legertom/dnsprop/api/internal/history"
+	"github.com/legertom/dnsprop/api/internal/problem"
+	"github.com/legertom/dnsprop/api/internal/validation"
+)
+
+// recordTimeout bounds how long a request waits to store its check.
+const recordTimeout = time.Second
+
+// HistoryPage is the response of GET /api/history.
+type HistoryPage struct {
+	Name       string          `json:"name"`
+	Checks     []history.Check `json:"checks"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// checkMeta describes where a check came from.
+type checkMeta struct {
+	source    string
+	requestID string
+	userAgent string
+}
+
+func httpCheckMeta(r *http.Request) checkMeta {
+	return checkMeta{
+		source:    r.Method + " " + r.URL.Path,
+		requestID: middleware.GetReqID(r.Context()),
+		userAgent: r.UserAgent(),
+	}
+}
+
+// CheckResponse is the response of GET /api/checks/{id}.
+type CheckResponse struct {
+	history.Check
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// recordCheck stores run with its v1 response and sets run.checkID. A nil store disables history;
+// storage errors are logged and never fail the request, leaving checkID empty.
+func recordCheck(ctx context.Context, store history.Store, run *resolveRun, meta checkMeta) {
+	if store == nil {
+		return
+	}
+	// The ID is assigned up front so the stored response carries the same check_id as the live one.
+	run.checkID = history.NewID()
+	resp, err := json.Marshal(run.v1())
+	if err != nil {
+		run.checkID = ""
+		return
+	}
+	c := &history.Check{
+		ID:         run.checkID,
+		Name:       strings.ToLower(run.req.Name), // history is looked up case-insensitively
+		Type:       run.req.Type,
+		Servers:    run.servers,
+		DNSSEC:     run.req.DNSSEC,
+		Source:     meta.source,
+		RequestID:  meta.requestID,
+		UserAgent:  meta.userAgent,
+		DurationMs: float64(run.duration.Microseconds()) / 1000.0,
+		CreatedAt:  run.started,
+		Response:   resp,
+	}
+	// The request context may already be done (e.g. a timed-out resolve), but the result is still worth keeping.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recordTimeout)
+	defer cancel()
+	if err := store.Add(ctx, c); err != nil {
+		slog.WarnContext(ctx, "history_record_failed", slog.String("name", c.Name), slog.String("error", err.Error()))
+		run.checkID = ""
+	}
+}
+
+// CheckHandler serves GET /api/checks/{id}, the permalink of one stored check. Checks older than
+// CHECK_EXPIRY are gone even if the periodic cleanup has not removed them yet.
+func CheckHandler(cfg *config.Config, store history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, expires, ok := loadCheck(w, r, cfg, store)
+		if !ok {
+			return
+		}
+		// A stored check never changes, so it can be cached until it expires.
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(time.Until(expires)/time.Second)))
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(CheckResponse{Check: c, ExpiresAt: expires})
+	}
+}
+
+// loadCheck returns the unexpired check named by the {id} URL parameter and when it expires. It
+// writes a problem and returns false when there is no such check.
+func loadCheck(w http.ResponseWriter, r *http.Request, cfg *config.Config, store history.Store) (history.Check, time.Time, bool) {
+	return loadCheckID(w, r, cfg, store, chi.URLParam(r, "id"))
+}
+
+// loadCheckID is loadCheck for a check ID taken from elsewhere in the request.
+func loadCheckID(w http.ResponseWriter, r *http.Request, cfg *config.Config, store history.Store, id string) (history.Check, time.Time, bool) {
+	if store == nil {
+		problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "history is disabled")
+		return history.Check{}, time.Time{}, false
+	}
+	if !history.ValidID(id) {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "check not found")
+		return history.Check{}, time.Time{}, false
+	}
+	c, err := store.Get(r.Context(), id)
+	switch {
+	case errors.Is(err, history.ErrNotFound):
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "check not found")
+		return history.Check{}, time.Time{}, false
+	case err != nil:
+		slog.ErrorContext(r.Context(), "history_get_failed", slog.String("id", id), slog.String("error", err.Error()))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "could not read check")
+		return history.Check{}, time.Time{}, false
+	}
+	expires := c.CreatedAt.Add(cfg.CheckExpiry)
+	if !time.Now().Before(expires) {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "check not found")
+		return history.Check{}, time.Time{}, false
+	}
+	return c, expires, true
+}
+
+// HistoryHandler serves GET /api/history?name=&type=&imported=&limit=&cursor=, listing stored
+// checks for a name newest first. next_cursor is passed back as cursor to get the following page.
+// imported=true lists checks imported from bundles instead of the ones this server ran.
+func HistoryHandler(store history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "history is disabled")
+			return
+		}
+		q := r.URL.Query()
+		name, err := validation.ValidateDomainName(q.Get("name"))
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		name = strings.ToLower(name)
+		query := history.ListQuery{Name: name, Cursor: q.Get("cursor")}
+		if t := q.Get("type"); t != "" {
+			query.Type = strings.ToUpper(strings.TrimSpace(t))
+			if err := validation.ValidateRecordType(query.Type); err != nil {
+				problem.Error(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if v := q.Get("imported"); v != "" {
+			imported, err := strconv.ParseBool(v)
+			if err != nil {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "imported must be true or false")
+				return
+			}
+			query.Imported = imported
+		}
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > history.MaxLimit {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "limit must be between 1 and "+strconv.Itoa(history.MaxLimit))
+				return
+			}
+			query.Limit = n
+		}
+
+		page, err := store.List(r.Context(), query)
+		switch {
+		case errors.Is(err, history.ErrInvalidCursor):
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, err.Error())
+			return
+		case err != nil:
+			slog.ErrorContext(r.Context(), "history_list_failed", slog.String("name", name), slog.String("error", err.Error()))
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "could not read history")
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(HistoryPage{Name: name, Checks: page.Checks, NextCursor: page.NextCursor})
+	}
+}
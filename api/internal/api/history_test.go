@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/legertom/dnsprop/api/internal/history"
+	"github.com/legertom/dnsprop/api/internal/ratelimit"
+	"github.com/legertom/dnsprop/api/internal/watch"
+)
+
+func newHistoryRouter(t *testing.T) http.Handler {
+	t.Helper()
+	store, err := history.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	cfg := testConfig()
+	return NewRouter(cfg, nil, ratelimit.NewLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst, cfg.RateLimitTTL), store, nil, nil, watch.NewManager(cfg.WatchMaxJobs, cfg.RequestTimeout))
+}
+
+func TestHistory_RecordsAndPaginates(t *testing.T) {
+	router := newHistoryRouter(t)
+	doc := loadOpenAPI(t)
+	body := `{"name":"example.com","type":"A","servers":["127.0.0.1"]}`
+	for _, path := range []string{"/api/v1/resolve", "/api/resolve"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d", path, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/resolve?name=example.com&type=A&servers=127.0.0.1", nil))
+
+	list := func(query string) HistoryPage {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/history?"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("history: %d %s", w.Code, w.Body.String())
+		}
+		schema, err := doc.responseSchema("/api/history", "GET", w.Code, w.Header().Get("content-type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc.checkJSON(t, schema, w.Body.Bytes(), "history response")
+		var page HistoryPage
+		json.Unmarshal(w.Body.Bytes(), &page)
+		return page
+	}
+
+	first := list("name=Example.com&limit=2")
+	if len(first.Checks) != 2 || first.NextCursor == "" {
+		t.Fatalf("expected 2 checks and a cursor, got %+v", first)
+	}
+	if first.Checks[0].Source != "GET /api/v2/resolve" || first.Checks[1].Source != "POST /api/resolve" {
+		t.Fatalf("expected newest first with sources, got %q, %q", first.Checks[0].Source, first.Checks[1].Source)
+	}
+	var resp ResolveResponse
+	if err := json.Unmarshal(first.Checks[0].Response, &resp); err != nil || resp.Name != "example.com" || len(resp.Results) != 1 {
+		t.Fatalf("expected the stored v1 response, got %s", first.Checks[0].Response)
+	}
+
+	second := list("name=example.com&limit=2&cursor=" + first.NextCursor)
+	if len(second.Checks) != 1 || second.NextCursor != "" || second.Checks[0].Source != "POST /api/v1/resolve" {
+		t.Fatalf("unexpected last page: %+v", second)
+	}
+	if got := list("name=example.com&type=MX"); len(got.Checks) != 0 {
+		t.Fatalf("expected no MX checks, got %d", len(got.Checks))
+	}
+}
+
+func TestHistory_SkipsNotModifiedGets(t *testing.T) {
+	router := newHistoryRouter(t)
+	const url = "/api/resolve?name=example.com&type=A&servers=127.0.0.1"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var first ResolveResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &first); err != nil || first.CheckID == "" {
+		t.Fatalf("expected a check id on the full response, got %s", w.Body.String())
+	}
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		r.Header.Set("If-None-Match", w.Header().Get("ETag"))
+		nm := httptest.NewRecorder()
+		router.ServeHTTP(nm, r)
+		if nm.Code != http.StatusNotModified {
+			t.Fatalf("expected 304, got %d", nm.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/history?name=example.com", nil))
+	var page HistoryPage
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if len(page.Checks) != 1 || page.Checks[0].ID != first.CheckID {
+		t.Fatalf("expected only the 200 to be recorded, got %+v", page.Checks)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/checks/"+first.CheckID, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the cached check_id to stay a valid permalink, got %d", w.Code)
+	}
+}
+
+func TestHistory_InvalidParams(t *testing.T) {
+	router := newHistoryRouter(t)
+	for query, code := range map[string]string{
+		"":                                 "invalid_domain",
+		"name=example.com&type=PTR":        "unsupported_type",
+		"name=example.com&limit=0":         "invalid_request",
+		"name=example.com&limit=101":       "invalid_request",
+		"name=example.com&cursor=notvalid": "invalid_request",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/history?"+query, nil))
+		assertProblem(t, w, http.StatusBadRequest, code)
+	}
+}
+
+func TestCheck_Permalink(t *testing.T) {
+	router := newHistoryRouter(t)
+	doc := loadOpenAPI(t)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v2/resolve", strings.NewReader(`{"name":"example.com","type":"A","servers":["127.0.0.1"]}`)))
+	var live ResolveResponseV2
+	if err := json.Unmarshal(w.Body.Bytes(), &live); err != nil || len(live.CheckID) != 32 {
+		t.Fatalf("expected a check_id in the resolve response, got %s", w.Body.String())
+	}
+
+	for _, path := range []string{"/api/checks/", "/api/v1/checks/"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+live.CheckID, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, w.Code, w.Body.String())
+		}
+		schema, err := doc.responseSchema("/api/checks/{id}", "GET", w.Code, w.Header().Get("content-type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc.checkJSON(t, schema, w.Body.Bytes(), "check response")
+		var got CheckResponse
+		json.Unmarshal(w.Body.Bytes(), &got)
+		if got.ID != live.CheckID || got.Source != "POST /api/v2/resolve" || !got.ExpiresAt.After(got.CreatedAt) {
+			t.Fatalf("unexpected check: %+v", got)
+		}
+		var stored ResolveResponse
+		if err := json.Unmarshal(got.Response, &stored); err != nil || stored.CheckID != live.CheckID {
+			t.Fatalf("expected the stored response to carry its check_id, got %s", got.Response)
+		}
+		if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+			t.Fatalf("expected an immutable Cache-Control, got %q", cc)
+		}
+	}
+
+	for _, id := range []string{"nope", "0123456789abcdef0123456789abcdef"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/checks/"+id, nil))
+		assertProblem(t, w, http.StatusNotFound, "not_found")
+	}
+}
+
+func TestCheck_Expired(t *testing.T) {
+	store, err := history.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	c := &history.Check{Name: "example.com", Type: "A", Source: "test", CreatedAt: time.Now().Add(-2 * time.Hour), Response: json.RawMessage(`{}`)}
+	store.Add(context.Background(), c)
+
+	cfg := testConfig() // CheckExpiry is an hour
+	router := NewRouter(cfg, nil, ratelimit.NewLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst, cfg.RateLimitTTL), store, nil, nil, watch.NewManager(cfg.WatchMaxJobs, cfg.RequestTimeout))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/checks/"+c.ID, nil))
+	assertProblem(t, w, http.StatusNotFound, "not_found")
+}
+
+func TestCheck_HistoryDisabled(t *testing.T) {
+	router := newTestRouter(testConfig())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/resolve", strings.NewReader(`{"name":"example.com","type":"A","servers":["127.0.0.1"]}`)))
+	if strings.Contains(w.Body.String(), "check_id") {
+		t.Fatalf("expected no check_id without a store, got %s", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/checks/0123456789abcdef0123456789abcdef", nil))
+	assertProblem(t, w, http.StatusServiceUnavailable, "unavailable")
+}
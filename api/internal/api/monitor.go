@@ -0,0 +1,453 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/legertom/dnsprop/api/internal/config"
+	"github.com/legertom/dnsprop/api/internal/history"
+	"github.com/legertom/dnsprop/api/internal/monitor"
+	"github.com/legertom/dnsprop/api/internal/problem"
+)
+
+// Defaults for monitors and their result listing.
+const (
+	defaultMonitorInterval = 5 * time.Minute
+	defaultMonitorResults  = 20
+	maxMonitorResults      = 500
+)
+
+type MonitorRequest struct {
+	ResolveRequest
+	Expected        []string `json:"expected,omitempty"`
+	IntervalSeconds int      `json:"interval_seconds,omitempty"`
+}
+
+type MonitorStatus struct {
+	State       string `json:"state"`
+	Since       string `json:"since,omitempty"`
+	CheckedAt   string `json:"checked_at,omitempty"`
+	Agreeing    int    `json:"agreeing"`
+	Unreachable int    `json:"unreachable"`
+	Total       int    `json:"total"`
+}
+
+type MonitorResponse struct {
+	ID              string        `json:"id"`
+	Name            string        `json:"name"`
+	Type            string        `json:"type"`
+	Servers         []string      `json:"servers"`
+	DNSSEC          bool          `json:"dnssec"`
+	Expected        []string      `json:"expected,omitempty"`
+	IntervalSeconds int           `json:"interval_seconds"`
+	CreatedAt       string        `json:"created_at"`
+	UpdatedAt       string        `json:"updated_at"`
+	Status          MonitorStatus `json:"status"`
+}
+
+type MonitorList struct {
+	Monitors []MonitorResponse `json:"monitors"`
+}
+
+type MonitorServerResult struct {
+	Server  string   `json:"server"`
+	Status  string   `json:"status"`
+	Answers []string `json:"answers"`
+	RTTMs   float64  `json:"rtt_ms,omitempty"`
+}
+
+type MonitorResult struct {
+	ID          int64                 `json:"id"`
+	CheckedAt   string                `json:"checked_at"`
+	State       string                `json:"state"`
+	Agreeing    int                   `json:"agreeing"`
+	Unreachable int                   `json:"unreachable"`
+	Total       int                   `json:"total"`
+	DurationMs  float64               `json:"duration_ms"`
+	Servers     []MonitorServerResult `json:"servers"`
+}
+
+type MonitorResults struct {
+	MonitorID string          `json:"monitor_id"`
+	Results   []MonitorResult `json:"results"`
+}
+
+type MonitorRollup struct {
+	Start      string         `json:"start"`
+	Checks     int            `json:"checks"`
+	DurationMs float64        `json:"duration_ms"`
+	States     map[string]int `json:"states"`
+	Statuses   map[string]int `json:"statuses"`
+	AnswerSets map[string]int `json:"answer_sets"`
+}
+
+type MonitorRollups struct {
+	MonitorID  string          `json:"monitor_id"`
+	Resolution string          `json:"resolution"`
+	Rollups    []MonitorRollup `json:"rollups"`
+}
+
+// RetentionResponse is the response of GET /api/retention. Counters cover every compaction since
+// the server started.
+type RetentionResponse struct {
+	RawSeconds     int64            `json:"raw_seconds"`
+	HourlySeconds  int64            `json:"hourly_seconds"`
+	DailySeconds   int64            `json:"daily_seconds"`
+	Runs           int64            `json:"runs"`
+	Failures       int64            `json:"failures"`
+	LastRunAt      string           `json:"last_run_at,omitempty"`
+	LastError      string           `json:"last_error,omitempty"`
+	RowsPruned     RetentionPruned  `json:"rows_pruned"`
+	RollupsWritten RetentionWritten `json:"rollups_written"`
+}
+
+// RetentionPruned counts deleted rows. MonitorChecks are history checks recorded from monitor
+// checks and WebhookDeliveries entries of the delivery log; both follow the raw retention.
+type RetentionPruned struct {
+	Raw               int64 `json:"raw"`
+	Hourly            int64 `json:"hourly"`
+	Daily             int64 `json:"daily"`
+	MonitorChecks     int64 `json:"monitor_checks"`
+	WebhookDeliveries int64 `json:"webhook_deliveries"`
+}
+
+type RetentionWritten struct {
+	Hourly int64 `json:"hourly"`
+	Daily  int64 `json:"daily"`
+}
+
+// monitorSource prefixes the Source of history checks recorded from monitor checks; the monitor
+// ID follows.
+const monitorSource = "monitor "
+
+// RecordMonitorChecks stores every monitor check in history, so monitored records show up in
+// GET /api/history and GET /api/timeline like on-demand checks.
+func RecordMonitorChecks(store history.Store) monitor.Listener {
+	return func(ctx context.Context, e monitor.Event) {
+		spec := e.Monitor.Spec
+		duration := time.Duration(e.Result.DurationMs * float64(time.Millisecond))
+		run := resolveRun{
+			req:      ResolveRequest{Name: spec.Name, Type: spec.Type, Servers: spec.Servers, DNSSEC: spec.DNSSEC},
+			servers:  spec.Servers,
+			results:  e.Results,
+			started:  e.Result.CheckedAt.Add(-duration),
+			duration: duration,
+		}
+		recordCheck(ctx, store, &run, checkMeta{source: monitorSource + e.Monitor.ID})
+	}
+}
+
+// PruneMonitorChecks deletes the history checks RecordMonitorChecks stored, so they follow the
+// monitor result retention instead of CHECK_EXPIRY.
+func PruneMonitorChecks(store history.Store) monitor.Pruner {
+	return func(ctx context.Context, before time.Time) (int64, error) {
+		return store.DeleteSourceBefore(ctx, monitorSource, before)
+	}
+}
+
+// MonitorCreateHandler creates a monitor that re-resolves (bypassing the cache) every interval.
+func MonitorCreateHandler(cfg *config.Config, monitors *monitor.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if monitors == nil {
+			monitorsDisabled(w, r)
+			return
+		}
+		spec, ok := decodeMonitorSpec(w, r, cfg)
+		if !ok {
+			return
+		}
+		mon, err := monitors.Create(r.Context(), spec)
+		if errors.Is(err, monitor.ErrTooManyMonitors) {
+			problem.Error(w, r, http.StatusServiceUnavailable, err)
+			return
+		}
+		if err != nil {
+			monitorStoreError(w, r, err)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		w.Header().Set("location", r.URL.Path+"/"+mon.ID) // keeps the /api or /api/v1 prefix
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(toMonitorResponse(mon))
+	}
+}
+
+// MonitorListHandler lists all monitors with their current status, oldest first.
+func MonitorListHandler(monitors *monitor.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if monitors == nil {
+			monitorsDisabled(w, r)
+			return
+		}
+		mons, err := monitors.List(r.Context())
+		if err != nil {
+			monitorStoreError(w, r, err)
+			return
+		}
+		out := MonitorList{Monitors: make([]MonitorResponse, 0, len(mons))}
+		for _, m := range mons {
+			out.Monitors = append(out.Monitors, toMonitorResponse(m))
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+func MonitorGetHandler(monitors *monitor.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if monitors == nil {
+			monitorsDisabled(w, r)
+			return
+		}
+		mon, err := monitors.Get(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			monitorStoreError(w, r, err)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(toMonitorResponse(mon))
+	}
+}
+
+// MonitorUpdateHandler replaces a monitor's settings; its status starts over as pending.
+func MonitorUpdateHandler(cfg *config.Config, monitors *monitor.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if monitors == nil {
+			monitorsDisabled(w, r)
+			return
+		}
+		spec, ok := decodeMonitorSpec(w, r, cfg)
+		if !ok {
+			return
+		}
+		mon, err := monitors.Update(r.Context(), chi.URLParam(r, "id"), spec)
+		if err != nil {
+			monitorStoreError(w, r, err)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(toMonitorResponse(mon))
+	}
+}
+
+func MonitorDeleteHandler(monitors *monitor.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if monitors == nil {
+			monitorsDisabled(w, r)
+			return
+		}
+		if err := monitors.Delete(r.Context(), chi.URLParam(r, "id")); err != nil {
+			monitorStoreError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// MonitorResultsHandler serves GET /api/monitors/{id}/results?limit=, newest first.
+func MonitorResultsHandler(monitors *monitor.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if monitors == nil {
+			monitorsDisabled(w, r)
+			return
+		}
+		limit := defaultMonitorResults
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxMonitorResults {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "limit must be between 1 and "+strconv.Itoa(maxMonitorResults))
+				return
+			}
+			limit = n
+		}
+		id := chi.URLParam(r, "id")
+		results, err := monitors.Results(r.Context(), id, limit)
+		if err != nil {
+			monitorStoreError(w, r, err)
+			return
+		}
+		out := MonitorResults{MonitorID: id, Results: make([]MonitorResult, 0, len(results))}
+		for _, res := range results {
+			out.Results = append(out.Results, toMonitorResult(res))
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// MonitorRollupsHandler serves GET /api/monitors/{id}/rollups?resolution=&limit=: aggregates of
+// results past raw retention, newest first.
+func MonitorRollupsHandler(monitors *monitor.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if monitors == nil {
+			monitorsDisabled(w, r)
+			return
+		}
+		q := r.URL.Query()
+		resolution := monitor.ResolutionHour
+		if v := q.Get("resolution"); v != "" {
+			if v != monitor.ResolutionHour && v != monitor.ResolutionDay {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "resolution must be hour or day")
+				return
+			}
+			resolution = v
+		}
+		limit := defaultMonitorResults
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxMonitorResults {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "limit must be between 1 and "+strconv.Itoa(maxMonitorResults))
+				return
+			}
+			limit = n
+		}
+		id := chi.URLParam(r, "id")
+		rollups, err := monitors.Rollups(r.Context(), id, resolution, limit)
+		if err != nil {
+			monitorStoreError(w, r, err)
+			return
+		}
+		out := MonitorRollups{MonitorID: id, Resolution: resolution, Rollups: make([]MonitorRollup, 0, len(rollups))}
+		for _, ru := range rollups {
+			out.Rollups = append(out.Rollups, MonitorRollup{
+				Start:      ru.Start.Format(time.RFC3339),
+				Checks:     ru.Checks,
+				DurationMs: ru.DurationMs,
+				States:     ru.States,
+				Statuses:   ru.Statuses,
+				AnswerSets: ru.AnswerSets,
+			})
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// RetentionHandler serves GET /api/retention: the retention policy for monitor results and how
+// much the compaction job has pruned.
+func RetentionHandler(monitors *monitor.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if monitors == nil {
+			monitorsDisabled(w, r)
+			return
+		}
+		st := monitors.Compaction()
+		out := RetentionResponse{
+			RawSeconds:    int64(st.Retention.Raw / time.Second),
+			HourlySeconds: int64(st.Retention.Hourly / time.Second),
+			DailySeconds:  int64(st.Retention.Daily / time.Second),
+			Runs:          st.Runs,
+			Failures:      st.Failures,
+			LastError:     st.LastError,
+			RowsPruned: RetentionPruned{
+				Raw:               st.Total.RawPruned,
+				Hourly:            st.Total.HourlyPruned,
+				Daily:             st.Total.DailyPruned,
+				MonitorChecks:     st.Total.ChecksPruned,
+				WebhookDeliveries: st.Total.DeliveriesPruned,
+			},
+			RollupsWritten: RetentionWritten{Hourly: st.Total.HourlyWritten, Daily: st.Total.DailyWritten},
+		}
+		if !st.LastRunAt.IsZero() {
+			out.LastRunAt = st.LastRunAt.Format(time.RFC3339)
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// decodeMonitorSpec validates a MonitorRequest body, writing a problem and returning false when
+// it is invalid.
+func decodeMonitorSpec(w http.ResponseWriter, r *http.Request, cfg *config.Config) (monitor.Spec, bool) {
+	var req MonitorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "invalid json")
+		return monitor.Spec{}, false
+	}
+	servers, err := normalizeResolveRequest(cfg, &req.ResolveRequest)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, err)
+		return monitor.Spec{}, false
+	}
+	interval := defaultMonitorInterval
+	if req.IntervalSeconds > 0 {
+		interval = time.Duration(req.IntervalSeconds) * time.Second
+	}
+	if interval < cfg.MonitorMinInterval {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, fmt.Sprintf("interval_seconds must be at least %d", int(cfg.MonitorMinInterval/time.Second)))
+		return monitor.Spec{}, false
+	}
+	return monitor.Spec{
+		Name:     req.Name,
+		Type:     req.Type,
+		Servers:  servers,
+		DNSSEC:   req.DNSSEC,
+		Expected: req.Expected,
+		Interval: interval,
+	}, true
+}
+
+func monitorsDisabled(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "monitors are disabled")
+}
+
+func monitorStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, monitor.ErrNotFound) {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "monitor not found")
+		return
+	}
+	slog.ErrorContext(r.Context(), "monitor_store_failed", slog.String("error", err.Error()))
+	problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "could not access monitors")
+}
+
+func toMonitorResponse(m monitor.Monitor) MonitorResponse {
+	out := MonitorResponse{
+		ID:              m.ID,
+		Name:            m.Spec.Name,
+		Type:            m.Spec.Type,
+		Servers:         m.Spec.Servers,
+		DNSSEC:          m.Spec.DNSSEC,
+		Expected:        m.Spec.Expected,
+		IntervalSeconds: int(m.Spec.Interval / time.Second),
+		CreatedAt:       m.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:       m.UpdatedAt.Format(time.RFC3339),
+		Status: MonitorStatus{
+			State:       m.Status.State,
+			Agreeing:    m.Status.Agreeing,
+			Unreachable: m.Status.Unreachable,
+			Total:       m.Status.Total,
+		},
+	}
+	if !m.Status.Since.IsZero() {
+		out.Status.Since = m.Status.Since.Format(time.RFC3339)
+	}
+	if !m.Status.CheckedAt.IsZero() {
+		out.Status.CheckedAt = m.Status.CheckedAt.Format(time.RFC3339)
+	}
+	return out
+}
+
+func toMonitorResult(r monitor.Result) MonitorResult {
+	out := MonitorResult{
+		ID:          r.ID,
+		CheckedAt:   r.CheckedAt.Format(time.RFC3339),
+		State:       r.State,
+		Agreeing:    r.Agreeing,
+		Unreachable: r.Unreachable,
+		Total:       r.Total,
+		DurationMs:  r.DurationMs,
+		Servers:     make([]MonitorServerResult, 0, len(r.Servers)),
+	}
+	for _, s := range r.Servers {
+		out.Servers = append(out.Servers, MonitorServerResult{Server: s.Server, Status: s.Status, Answers: s.Answers, RTTMs: s.RTTMs})
+	}
+	return out
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/legertom/dnsprop/api/internal/history"
+	"github.com/legertom/dnsprop/api/internal/monitor"
+	"github.com/legertom/dnsprop/api/internal/ratelimit"
+	"github.com/legertom/dnsprop/api/internal/watch"
+)
+
+func TestMonitor_Lifecycle(t *testing.T) {
+	hist, err := history.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hist.Close()
+	store, err := monitor.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	cfg := testConfig()
+	monitors := monitor.NewManager(store, cfg.MonitorMaxCount, cfg.RequestTimeout)
+	monitors.OnResult(RecordMonitorChecks(hist))
+	defer monitors.Close()
+	router := NewRouter(cfg, nil, ratelimit.NewLimiter(100, 100, time.Minute), hist, monitors, nil, watch.NewManager(cfg.WatchMaxJobs, cfg.RequestTimeout))
+	doc := loadOpenAPI(t)
+
+	do := func(method, path, body string, status int, route string, out any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		if w.Code != status {
+			t.Fatalf("%s %s: expected %d, got %d: %s", method, path, status, w.Code, w.Body.String())
+		}
+		schema, err := doc.responseSchema(route, method, w.Code, w.Header().Get("content-type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if schema != nil {
+			doc.checkJSON(t, schema, w.Body.Bytes(), method+" "+path+" response")
+		}
+		if out != nil {
+			json.Unmarshal(w.Body.Bytes(), out)
+		}
+	}
+
+	body := `{"name":"example.com","type":"A","servers":["127.0.0.1"],"expected":["192.0.2.1"],"interval_seconds":3600}`
+	doc.checkJSON(t, doc.requestSchema("/api/monitors", "POST"), []byte(body), "create request")
+	var created MonitorResponse
+	do(http.MethodPost, "/api/v1/monitors", body, http.StatusCreated, "/api/monitors", &created)
+	if created.ID == "" || created.Status.State != monitor.StatePending || created.IntervalSeconds != 3600 {
+		t.Fatalf("unexpected monitor: %+v", created)
+	}
+
+	// The first check runs right away; 127.0.0.1 does not answer, so the monitor fails.
+	var results MonitorResults
+	for deadline := time.Now().Add(5 * time.Second); len(results.Results) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("monitor was not checked")
+		}
+		time.Sleep(10 * time.Millisecond)
+		do(http.MethodGet, "/api/monitors/"+created.ID+"/results", "", http.StatusOK, "/api/monitors/{id}/results", &results)
+	}
+	if r := results.Results[0]; r.State != monitor.StateFailing || len(r.Servers) != 1 {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+	var got MonitorResponse
+	do(http.MethodGet, "/api/monitors/"+created.ID, "", http.StatusOK, "/api/monitors/{id}", &got)
+	if got.Status.State != monitor.StateFailing || got.Status.CheckedAt == "" {
+		t.Fatalf("expected a failing status, got %+v", got.Status)
+	}
+	var page HistoryPage
+	do(http.MethodGet, "/api/history?name=example.com", "", http.StatusOK, "/api/history", &page)
+	if len(page.Checks) != 1 || page.Checks[0].Source != "monitor "+created.ID {
+		t.Fatalf("expected the check in history, got %+v", page.Checks)
+	}
+
+	var updated MonitorResponse
+	do(http.MethodPut, "/api/monitors/"+created.ID, `{"name":"example.com","type":"MX","servers":["127.0.0.1"]}`, http.StatusOK, "/api/monitors/{id}", &updated)
+	if updated.Type != "MX" || updated.IntervalSeconds != 300 || updated.CreatedAt != created.CreatedAt {
+		t.Fatalf("unexpected update: %+v", updated)
+	}
+	var list MonitorList
+	do(http.MethodGet, "/api/monitors", "", http.StatusOK, "/api/monitors", &list)
+	if len(list.Monitors) != 1 || list.Monitors[0].ID != created.ID {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+
+	do(http.MethodDelete, "/api/monitors/"+created.ID, "", http.StatusNoContent, "/api/monitors/{id}", nil)
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "/api/monitors/"+created.ID, nil))
+		assertProblem(t, w, http.StatusNotFound, "not_found")
+	}
+}
+
+func TestMonitor_InvalidRequests(t *testing.T) {
+	store, err := monitor.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	cfg := testConfig()
+	cfg.MonitorMinInterval = time.Minute
+	monitors := monitor.NewManager(store, cfg.MonitorMaxCount, cfg.RequestTimeout)
+	defer monitors.Close()
+	router := NewRouter(cfg, nil, ratelimit.NewLimiter(100, 100, time.Minute), nil, monitors, nil, watch.NewManager(cfg.WatchMaxJobs, cfg.RequestTimeout))
+
+	for body, code := range map[string]string{
+		`{bad`:                                "invalid_json",
+		`{"name":"","type":"A"}`:              "invalid_domain",
+		`{"name":"example.com","type":"PTR"}`: "unsupported_type",
+		`{"name":"example.com","type":"A","interval_seconds":10}`: "invalid_request",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/monitors", bytes.NewBufferString(body)))
+		assertProblem(t, w, http.StatusBadRequest, code)
+	}
+	for _, path := range []string{"/api/monitors/nope/results?limit=0", "/api/monitors/nope/rollups?resolution=minute", "/api/monitors/nope/rollups?limit=501"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assertProblem(t, w, http.StatusBadRequest, "invalid_request")
+	}
+}
+
+func TestMonitor_RollupsAndRetention(t *testing.T) {
+	store, err := monitor.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	cfg := testConfig()
+	monitors := monitor.NewManager(store, cfg.MonitorMaxCount, cfg.RequestTimeout)
+	defer monitors.Close()
+	router := NewRouter(cfg, nil, ratelimit.NewLimiter(100, 100, time.Minute), nil, monitors, nil, watch.NewManager(cfg.WatchMaxJobs, cfg.RequestTimeout))
+	doc := loadOpenAPI(t)
+	get := func(path, route string, out any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, w.Code, w.Body.String())
+		}
+		schema, err := doc.responseSchema(route, "GET", w.Code, w.Header().Get("content-type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc.checkJSON(t, schema, w.Body.Bytes(), path+" response")
+		json.Unmarshal(w.Body.Bytes(), out)
+	}
+
+	ctx := context.Background()
+	mon := monitor.Monitor{Spec: monitor.Spec{Name: "example.com", Type: "A", Servers: []string{"127.0.0.1"}, Interval: time.Hour}}
+	if err := store.Create(ctx, &mon); err != nil {
+		t.Fatal(err)
+	}
+	checked := time.Now().Add(-2 * cfg.ResultRetention)
+	res := monitor.Result{MonitorID: mon.ID, CheckedAt: checked, State: monitor.StateOK, Total: 1, DurationMs: 12,
+		Servers: []monitor.ServerResult{{Server: "127.0.0.1", Status: "ok", Answers: []string{"192.0.2.1"}}}}
+	if err := store.Record(ctx, &res, monitor.Status{State: monitor.StateOK, Since: checked, CheckedAt: checked}); err != nil {
+		t.Fatal(err)
+	}
+
+	// History checks recorded from monitors follow the raw retention; other checks keep CHECK_EXPIRY.
+	hist, err := history.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hist.Close()
+	for _, source := range []string{monitorSource + mon.ID, "resolve"} {
+		if err := hist.Add(ctx, &history.Check{Name: "example.com", Type: "A", Source: source, CreatedAt: checked}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	monitors.PruneChecks(PruneMonitorChecks(hist))
+
+	var retention RetentionResponse
+	get("/api/retention", "/api/retention", &retention)
+	if retention.Runs != 0 || retention.LastRunAt != "" {
+		t.Fatalf("expected no runs before compaction starts, got %+v", retention)
+	}
+	monitors.StartCompaction(monitor.Retention{Raw: cfg.ResultRetention, Hourly: cfg.HourlyRetention, Daily: cfg.DailyRetention}, cfg.CompactInterval)
+	for deadline := time.Now().Add(5 * time.Second); retention.Runs == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("compaction did not run")
+		}
+		time.Sleep(10 * time.Millisecond)
+		get("/api/v1/retention", "/api/retention", &retention)
+	}
+	if retention.RawSeconds != 86400 || retention.RowsPruned.Raw != 1 || retention.RollupsWritten.Hourly != 1 || retention.LastError != "" {
+		t.Fatalf("unexpected retention: %+v", retention)
+	}
+	if page, _ := hist.List(ctx, history.ListQuery{Name: "example.com", Type: "A", Limit: 10}); retention.RowsPruned.MonitorChecks != 1 || len(page.Checks) != 1 || page.Checks[0].Source != "resolve" {
+		t.Fatalf("expected only the monitor's history check to be pruned, got %+v and %+v", retention.RowsPruned, page.Checks)
+	}
+
+	var rollups MonitorRollups
+	get("/api/monitors/"+mon.ID+"/rollups", "/api/monitors/{id}/rollups", &rollups)
+	if len(rollups.Rollups) != 1 || rollups.Resolution != "hour" {
+		t.Fatalf("expected one hourly rollup, got %+v", rollups)
+	}
+	if ru := rollups.Rollups[0]; ru.Checks != 1 || ru.States["ok"] != 1 || ru.AnswerSets["192.0.2.1"] != 1 || ru.Start != checked.UTC().Truncate(time.Hour).Format(time.RFC3339) {
+		t.Fatalf("unexpected rollup: %+v", ru)
+	}
+	get("/api/v1/monitors/"+mon.ID+"/rollups?resolution=day", "/api/monitors/{id}/rollups", &rollups)
+	if len(rollups.Rollups) != 0 || rollups.Resolution != "day" {
+		t.Fatalf("expected no daily rollups yet, got %+v", rollups)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/monitors/nope/rollups", nil))
+	assertProblem(t, w, http.StatusNotFound, "not_found")
+}
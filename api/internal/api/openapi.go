@@ -0,0 +1,19 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec documents every route registered in NewRouter. It is maintained by hand next to the
+// handlers; openapi_test.go checks it against the router and the handlers' actual payloads.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPIHandler serves the OpenAPI 3.1 document.
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	w.Header().Set("cache-control", "public, max-age=300")
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,348 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// openAPIDoc is a minimal OpenAPI/JSON Schema checker covering the keywords openapi.json uses.
+type openAPIDoc map[string]any
+
+func loadOpenAPI(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	return doc
+}
+
+func (d openAPIDoc) deref(node map[string]any) map[string]any {
+	for {
+		ref, ok := node["$ref"].(string)
+		if !ok {
+			return node
+		}
+		var cur any = map[string]any(d)
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			part = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+			cur = cur.(map[string]any)[part]
+		}
+		node = cur.(map[string]any)
+	}
+}
+
+func (d openAPIDoc) operation(route, method string) map[string]any {
+	item, _ := d["paths"].(map[string]any)[route].(map[string]any)
+	op, _ := d.deref(item)[strings.ToLower(method)].(map[string]any)
+	return op
+}
+
+// responseSchema returns the schema for a documented status and media type, or an error.
+func (d openAPIDoc) responseSchema(route, method string, status int, contentType string) (map[string]any, error) {
+	op := d.operation(route, method)
+	if op == nil {
+		return nil, fmt.Errorf("%s %s is not documented", method, route)
+	}
+	resp, ok := op["responses"].(map[string]any)[strconv.Itoa(status)].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s %s: status %d is not documented", method, route, status)
+	}
+	resp = d.deref(resp)
+	content, _ := resp["content"].(map[string]any)
+	if content == nil {
+		return nil, nil
+	}
+	mt, _, _ := mime.ParseMediaType(contentType)
+	media, ok := content[mt].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s %s %d: content-type %q is not documented", method, route, status, contentType)
+	}
+	return d.deref(media["schema"].(map[string]any)), nil
+}
+
+func (d openAPIDoc) requestSchema(route, method string) map[string]any {
+	op := d.operation(route, method)
+	body, _ := op["requestBody"].(map[string]any)
+	content, _ := body["content"].(map[string]any)
+	media, _ := content["application/json"].(map[string]any)
+	if media == nil {
+		return nil
+	}
+	return d.deref(media["schema"].(map[string]any))
+}
+
+func (d openAPIDoc) validate(schema map[string]any, v any, at string) []string {
+	schema = d.deref(schema)
+	var errs []string
+	fail := func(format string, args ...any) { errs = append(errs, at+": "+fmt.Sprintf(format, args...)) }
+
+	if types, ok := schema["type"]; ok {
+		allowed := []string{}
+		switch t := types.(type) {
+		case string:
+			allowed = append(allowed, t)
+		case []any:
+			for _, x := range t {
+				allowed = append(allowed, x.(string))
+			}
+		}
+		matched := false
+		for _, t := range allowed {
+			if jsonTypeIs(v, t) {
+				matched = true
+			}
+		}
+		if !matched {
+			fail("expected %v, got %T", allowed, v)
+			return errs
+		}
+	}
+	if c, ok := schema["const"]; ok && v != c {
+		fail("expected %v, got %v", c, v)
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if e == v {
+				found = true
+			}
+		}
+		if !found {
+			fail("%v is not one of %v", v, enum)
+		}
+	}
+	if min, ok := schema["minimum"].(float64); ok {
+		if n, isNum := v.(float64); isNum && n < min {
+			fail("%v is below minimum %v", n, min)
+		}
+	}
+	if schema["format"] == "date-time" {
+		if s, ok := v.(string); ok {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				fail("invalid date-time %q", s)
+			}
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		for _, req := range asStrings(schema["required"]) {
+			if _, ok := val[req]; !ok {
+				fail("missing required property %q", req)
+			}
+		}
+		for k, pv := range val {
+			if ps, ok := props[k].(map[string]any); ok {
+				errs = append(errs, d.validate(ps, pv, at+"."+k)...)
+				continue
+			}
+			switch ap := schema["additionalProperties"].(type) {
+			case bool:
+				if !ap {
+					fail("unexpected property %q", k)
+				}
+			case map[string]any:
+				errs = append(errs, d.validate(ap, pv, at+"."+k)...)
+			}
+		}
+	case []any:
+		if min, ok := schema["minItems"].(float64); ok && float64(len(val)) < min {
+			fail("expected at least %v items", min)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, iv := range val {
+				errs = append(errs, d.validate(items, iv, fmt.Sprintf("%s[%d]", at, i))...)
+			}
+		}
+	}
+	return errs
+}
+
+func jsonTypeIs(v any, t string) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		n, ok := v.(float64)
+		return ok && n == math.Trunc(n)
+	case "null":
+		return v == nil
+	}
+	return false
+}
+
+func asStrings(v any) []string {
+	list, _ := v.([]any)
+	out := make([]string, 0, len(list))
+	for _, x := range list {
+		out = append(out, x.(string))
+	}
+	return out
+}
+
+func (d openAPIDoc) checkJSON(t *testing.T, schema map[string]any, data []byte, what string) {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("%s: invalid json %q: %v", what, data, err)
+	}
+	if errs := d.validate(schema, v, "$"); len(errs) > 0 {
+		t.Fatalf("%s does not match the spec:\n%s", what, strings.Join(errs, "\n"))
+	}
+}
+
+func TestOpenAPI_DocumentsEveryRoute(t *testing.T) {
+	doc := loadOpenAPI(t)
+	routed := map[string]bool{}
+	err := chi.Walk(newTestRouter(testConfig()).(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routed[method+" "+route] = true
+		if doc.operation(route, method) == nil {
+			t.Errorf("%s %s is not in openapi.json", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for route, item := range doc["paths"].(map[string]any) {
+		for method := range doc.deref(item.(map[string]any)) {
+			if method == "parameters" {
+				continue
+			}
+			if !routed[strings.ToUpper(method)+" "+route] {
+				t.Errorf("openapi.json documents %s %s, which is not routed", strings.ToUpper(method), route)
+			}
+		}
+	}
+}
+
+func TestOpenAPI_HandlersMatchSpec(t *testing.T) {
+	doc := loadOpenAPI(t)
+	router := newTestRouter(testConfig())
+	snapshot := `{"name":"example.com","type":"A","results":[{"server":"1.1.1.1","latitude":0,"longitude":0,"status":"ok","answers":[{"value":"192.0.2.1","ttl":60}],"when":"2024-01-01T00:00:00Z"}]}`
+
+	cases := []struct {
+		method, route, url, body string
+		invalidBody              bool
+		status                   int
+	}{
+		{method: "GET", route: "/api/healthz", url: "/api/healthz", status: 200},
+		{method: "GET", route: "/api/openapi.json", url: "/api/openapi.json", status: 200},
+		{method: "GET", route: "/api/resolvers", url: "/api/resolvers", status: 200},
+		{method: "POST", route: "/api/resolve", url: "/api/resolve", body: `{"name":"example.com","type":"A","servers":["127.0.0.1","127.0.0.2"]}`, status: 200},
+		{method: "POST", route: "/api/resolve", url: "/api/resolve", body: `{"name":"example.com","type":"PTR"}`, invalidBody: true, status: 400},
+		{method: "POST", route: "/api/resolve", url: "/api/resolve", body: `{bad`, invalidBody: true, status: 400},
+		{method: "GET", route: "/api/resolve", url: "/api/resolve?name=example.com&type=AAAA&servers=127.0.0.1", status: 200},
+		{method: "GET", route: "/api/resolve", url: "/api/resolve?name=example.com&type=A&dnssec=maybe", status: 400},
+		{method: "POST", route: "/api/v1/resolve", url: "/api/v1/resolve", body: `{"name":"example.com","type":"A","servers":["127.0.0.1"]}`, status: 200},
+		{method: "POST", route: "/api/v2/resolve", url: "/api/v2/resolve", body: `{"name":"example.com","type":"MX","servers":["127.0.0.1","127.0.0.2"]}`, status: 200},
+		{method: "POST", route: "/api/v2/resolve", url: "/api/v2/resolve", body: `{"name":"example.com","type":"PTR"}`, invalidBody: true, status: 400},
+		{method: "GET", route: "/api/v2/resolve", url: "/api/v2/resolve?name=example.com&type=TXT&servers=127.0.0.1", status: 200},
+		{method: "POST", route: "/api/resolve/batch", url: "/api/resolve/batch", body: batchBody, status: 200},
+		{method: "POST", route: "/api/resolve/batch", url: "/api/resolve/batch", body: `{"items":[]}`, invalidBody: true, status: 400},
+		{method: "POST", route: "/api/nameservers", url: "/api/nameservers", body: `{"name":""}`, status: 400},
+		{method: "POST", route: "/api/diff", url: "/api/diff", body: `{"before":` + snapshot + `,"after":` + snapshot + `}`, status: 200},
+		{method: "GET", route: "/api/history", url: "/api/history?name=example.com", status: 503},
+		{method: "GET", route: "/api/checks/{id}", url: "/api/checks/nope", status: 503},
+		{method: "GET", route: "/api/checks/{id}/export", url: "/api/checks/nope/export", status: 503},
+		{method: "POST", route: "/api/checks/import", url: "/api/checks/import", body: `{"format":"dnsprop-check","version":1,"exported_at":"2024-01-01T00:00:00Z","check":{"id":"x","source":"resolve","created_at":"2024-01-01T00:00:00Z","duration_ms":1},"request":{"name":"example.com","type":"A"},"results":[],"summary":{"servers":0,"responded":0,"unreachable":0,"statuses":{},"answer_sets":{}},"servers":[]}`, status: 503},
+		{method: "GET", route: "/api/timeline", url: "/api/timeline?name=example.com&type=A", status: 503},
+		{method: "GET", route: "/api/monitors", url: "/api/monitors", status: 503},
+		{method: "POST", route: "/api/monitors", url: "/api/monitors", body: `{"name":"example.com","type":"A"}`, status: 503},
+		{method: "GET", route: "/api/monitors/{id}/results", url: "/api/monitors/nope/results", status: 503},
+		{method: "GET", route: "/api/monitors/{id}/rollups", url: "/api/monitors/nope/rollups", status: 503},
+		{method: "GET", route: "/api/retention", url: "/api/retention", status: 503},
+		{method: "GET", route: "/api/webhooks", url: "/api/webhooks", status: 503},
+		{method: "POST", route: "/api/webhooks", url: "/api/webhooks", body: `{"url":"https://example.com/hook","format":"slack"}`, status: 503},
+		{method: "POST", route: "/api/webhooks/{id}/test", url: "/api/webhooks/nope/test", status: 503},
+		{method: "POST", route: "/api/watch", url: "/api/watch", body: `{"name":"example.com","type":"A","servers":["127.0.0.1"],"interval_seconds":1,"timeout_seconds":1}`, status: 202},
+		{method: "GET", route: "/api/watch/{id}", url: "/api/watch/missing", status: 404},
+		{method: "DELETE", route: "/api/watch/{id}", url: "/api/watch/missing", status: 404},
+	}
+	for _, tc := range cases {
+		name := tc.method + " " + tc.url
+		if tc.body != "" && !tc.invalidBody {
+			doc.checkJSON(t, doc.requestSchema(tc.route, tc.method), []byte(tc.body), name+" request")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body)))
+		if w.Code != tc.status {
+			t.Fatalf("%s: expected %d, got %d: %s", name, tc.status, w.Code, w.Body.String())
+		}
+		schema, err := doc.responseSchema(tc.route, tc.method, w.Code, w.Header().Get("content-type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if schema == nil || !strings.Contains(w.Header().Get("content-type"), "json") {
+			continue
+		}
+		doc.checkJSON(t, schema, w.Body.Bytes(), name+" response")
+
+		if tc.route == "/api/watch" {
+			var st WatchStatus
+			json.Unmarshal(w.Body.Bytes(), &st)
+			for _, method := range []string{"GET", "DELETE"} {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(method, "/api/watch/"+st.ID, nil))
+				if _, err := doc.responseSchema("/api/watch/{id}", method, w.Code, w.Header().Get("content-type")); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+}
+
+func TestOpenAPI_StreamEventsMatchSpec(t *testing.T) {
+	checkStreamEvents(t, "/api/resolve/stream", map[string]string{"result": "Result", "summary": "StreamSummary"})
+	checkStreamEvents(t, "/api/v2/resolve/stream", map[string]string{"result": "ResultV2", "summary": "StreamSummary"})
+}
+
+func checkStreamEvents(t *testing.T, path string, eventSchema map[string]string) {
+	t.Helper()
+	doc := loadOpenAPI(t)
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	w := httptest.NewRecorder()
+	newTestRouter(testConfig()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?name=example.com&type=A&servers=127.0.0.1,127.0.0.2", nil))
+
+	event := ""
+	sc := bufio.NewScanner(w.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			schema, ok := schemas[eventSchema[event]].(map[string]any)
+			if !ok {
+				t.Fatalf("undocumented event %q", event)
+			}
+			doc.checkJSON(t, schema, []byte(strings.TrimPrefix(line, "data: ")), event+" event")
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/legertom/dnsprop/api/internal/config"
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+	"github.com/legertom/dnsprop/api/internal/history"
+	"github.com/legertom/dnsprop/api/internal/problem"
+)
+
+// ResolveGetHandler serves GET /api/resolve?name=&type=&servers=&dnssec= so lookups can be
+// bookmarked and cached by intermediaries. The response matches POST /api/resolve. Cache-Control
+// allows reuse until the first result would expire from the server-side cache, and the ETag lets
+// clients revalidate with If-None-Match.
+func ResolveGetHandler(cfg *config.Config, cache resolver.Cache, store history.Store) http.HandlerFunc {
+	return resolveGetHandler(cfg, cache, store, "", func(run resolveRun) any { return run.v1() })
+}
+
+// resolveGetHandler serves a cacheable resolve shaped by view. version is mixed into the ETag so
+// representations from different API versions never validate each other.
+func resolveGetHandler(cfg *config.Config, cache resolver.Cache, store history.Store, version string, view func(resolveRun) any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := resolveRequestFromQuery(r.URL.Query())
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		servers, err := normalizeResolveRequest(cfg, &req)
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.RequestTimeout)
+		defer cancel()
+		run := runResolve(ctx, cfg, cache, req, servers)
+
+		maxAge := resolver.MinRemainingTTL(run.results, time.Now())
+		etag := resolveETag(version, run.v1())
+		h := w.Header()
+		h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge/time.Second)))
+		h.Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		// Only a full response is recorded: a 304 hands the client nothing new, and recording every
+		// revalidation would fill history with polls and mint check IDs nobody sees.
+		recordCheck(r.Context(), store, &run, httpCheckMeta(r))
+		h.Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(view(run))
+	}
+}
+
+// resolveETag is a weak validator over what each resolver answered. Timestamps, RTTs and TTLs
+// that count down between queries are left out, so an unchanged DNS state keeps its ETag. So is
+// check_id: a 304 records no new check, so the check_id in the client's cached body still points
+// at the stored check that body came from.
+func resolveETag(version string, out ResolveResponse) string {
+	lines := make([]string, 0, len(out.Results))
+	for _, res := range out.Results {
+		values := make([]string, 0, len(res.Answers))
+		for _, a := range res.Answers {
+			values = append(values, a.Value)
+		}
+		sort.Strings(values)
+		lines = append(lines, fmt.Sprintf("%s|%s|%t|%s", res.Server, res.Status, res.AD, strings.Join(values, ",")))
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(version + out.Name + " " + out.Type + "\n" + strings.Join(lines, "\n")))
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches implements the weak comparison If-None-Match calls for.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
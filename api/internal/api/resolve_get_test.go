@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResolveGetHandler_ETagRevalidation(t *testing.T) {
+	h := ResolveGetHandler(testConfig(), nil, nil)
+	const url = "/api/resolve?name=example.com&type=A&servers=127.0.0.1,127.0.0.2"
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	etag := w.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("expected weak ETag, got %q", etag)
+	}
+	if cc := w.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "public, max-age=") {
+		t.Fatalf("unexpected Cache-Control %q", cc)
+	}
+	if !strings.Contains(w.Body.String(), `"name":"example.com`) {
+		t.Fatalf("unexpected body %s", w.Body.String())
+	}
+
+	r := httptest.NewRequest(http.MethodGet, url, nil)
+	r.Header.Set("If-None-Match", `"other", `+strings.TrimPrefix(etag, "W/"))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("expected empty 304, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestResolveGetHandler_InvalidParams(t *testing.T) {
+	w := httptest.NewRecorder()
+	ResolveGetHandler(testConfig(), nil, nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/resolve?name=example.com&type=BOGUS", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	ResolveGetHandler(testConfig(), nil, nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/resolve?name=example.com&type=A&eta=maybe", nil))
+	assertProblem(t, w, http.StatusBadRequest, "invalid_request")
+}
+
+func TestResolveETag_IgnoresVolatileFields(t *testing.T) {
+	a := ResolveResponse{Name: "example.com", Type: "A", Results: []Result{
+		{Server: "1.1.1.1", Status: "ok", RTTMs: 3, When: "t1", Answers: []Answer{{Value: "192.0.2.1", TTL: 300}, {Value: "192.0.2.2", TTL: 300}}},
+		{Server: "8.8.8.8", Status: "timeout"},
+	}}
+	b := ResolveResponse{Name: "example.com", Type: "A", Results: []Result{
+		{Server: "8.8.8.8", Status: "timeout", When: "t2"},
+		{Server: "1.1.1.1", Status: "ok", RTTMs: 9, When: "t2", Answers: []Answer{{Value: "192.0.2.2", TTL: 12}, {Value: "192.0.2.1", TTL: 12}}},
+	}}
+	if resolveETag("", a) != resolveETag("", b) {
+		t.Fatal("expected equal ETags for reordered results with different timings")
+	}
+	b.Results[1].Answers[0].Value = "192.0.2.3"
+	if resolveETag("", a) == resolveETag("", b) {
+		t.Fatal("expected ETag to change with the answer set")
+	}
+	if resolveETag("", a) == resolveETag("v2", a) {
+		t.Fatal("expected ETag to differ between API versions")
+	}
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/legertom/dnsprop/api/internal/config"
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+)
+
+type ResolverCatalog struct {
+	Resolvers []resolver.ResolverInfo `json:"resolvers"`
+	// Coalescing counts live lookups across all resolvers since startup.
+	Coalescing resolver.CoalesceStats `json:"coalescing"`
+}
+
+// ResolversHandler lists the configured default resolvers with their location, provider and
+// health over their most recent queries, so clients don't have to hard-code the pool. It also
+// reports how many live lookups shared an identical in-flight query.
+func ResolversHandler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		w.Header().Set("cache-control", "no-cache")
+		json.NewEncoder(w).Encode(ResolverCatalog{Resolvers: resolver.Catalog(cfg.Resolvers), Coalescing: resolver.Coalescing()})
+	}
+}
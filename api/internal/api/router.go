@@ -9,34 +9,95 @@ import (
 	"github.com/go-chi/cors"
 
 	"github.com/legertom/dnsprop/api/internal/config"
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+	"github.com/legertom/dnsprop/api/internal/history"
 	"github.com/legertom/dnsprop/api/internal/logging"
+	"github.com/legertom/dnsprop/api/internal/monitor"
+	"github.com/legertom/dnsprop/api/internal/problem"
 	"github.com/legertom/dnsprop/api/internal/ratelimit"
-	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+	"github.com/legertom/dnsprop/api/internal/watch"
+	"github.com/legertom/dnsprop/api/internal/webhook"
 )
 
-// NewRouter wires middlewares and routes for the API server.
-func NewRouter(cfg *config.Config, cache resolver.Cache) http.Handler {
+// NewRouter wires middlewares and routes for the API server. limiter and store are shared with
+// the gRPC server so both count against the same per-IP budget and record to the same history.
+// A nil store disables history, nil monitors the monitor routes and nil webhooks the webhook routes.
+// The caller owns watches and closes it on shutdown.
+func NewRouter(cfg *config.Config, cache resolver.Cache, limiter *ratelimit.Limiter, store history.Store, monitors *monitor.Manager, webhooks *webhook.Dispatcher, watches *watch.Manager) http.Handler {
 	r := chi.NewRouter()
+	r.NotFound(problem.NotFound)
+	r.MethodNotAllowed(problem.MethodNotAllowed)
 
 	// Standard middlewares
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(logging.StructuredLogger)
-	r.Use(ratelimit.LimiterMiddleware(cfg.RateLimitRPS, cfg.RateLimitBurst, cfg.RateLimitTTL))
+	r.Use(limiter.Middleware)
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   cfg.CorsOrigins,
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{"ETag", "Location"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
 
-	r.Get("/api/healthz", Healthz)
-	r.Get("/api/readyz", ReadyzHandler(cfg, cache))
-	r.Post("/api/resolve", ResolveHandler(cfg, cache))
+	// State shared by every mount of the v1 routes, so e.g. batches under /api and /api/v1 draw
+	// from the same budgets.
+	budget := resolver.NewBudget(cfg.BatchConcurrency)
+	batchQueries := ratelimit.NewLimiter(cfg.BatchQueryRPS, cfg.BatchQueryBurst, cfg.RateLimitTTL)
+
+	// The unversioned routes are the v1 contract and stay for existing clients. Shapes under
+	// /api/v1 are frozen: fields are never removed, renamed or changed in meaning, though new
+	// optional fields (such as check_id) may be added. Anything else goes to /api/v2, which so far
+	// only covers resolving.
+	for _, prefix := range []string{"/api", "/api/v1"} {
+		r.Get(prefix+"/healthz", Healthz)
+		r.Get(prefix+"/readyz", ReadyzHandler(cfg, cache))
+		r.Get(prefix+"/openapi.json", OpenAPIHandler)
+		r.Get(prefix+"/resolvers", ResolversHandler(cfg))
+		r.Get(prefix+"/resolve", ResolveGetHandler(cfg, cache, store))
+		r.Post(prefix+"/resolve", ResolveHandler(cfg, cache, store))
+		r.Post(prefix+"/resolve/batch", BatchHandler(cfg, cache, batchQueries, budget))
+		r.Get(prefix+"/resolve/stream", ResolveStreamHandler(cfg, cache))
+		r.Get(prefix+"/ws", WebSocketHandler(cfg, cache, limiter))
+		r.Post(prefix+"/delegation", DelegationHandler(cfg))
+		r.Post(prefix+"/nameservers", NameserversHandler(cfg))
+		r.Post(prefix+"/diff", DiffHandler(cfg, store))
+		r.Get(prefix+"/history", HistoryHandler(store))
+		r.Get(prefix+"/checks/{id}", CheckHandler(cfg, store))
+		r.Get(prefix+"/checks/{id}/export", CheckExportHandler(cfg, store))
+		r.Post(prefix+"/checks/import", CheckImportHandler(cfg, store))
+		r.Get(prefix+"/timeline", TimelineHandler(store))
+
+		r.Post(prefix+"/watch", WatchCreateHandler(cfg, watches))
+		r.Get(prefix+"/watch/{id}", WatchGetHandler(watches))
+		r.Delete(prefix+"/watch/{id}", WatchCancelHandler(watches))
+		r.Get(prefix+"/watch/{id}/events", WatchEventsHandler(watches))
+
+		r.Get(prefix+"/monitors", MonitorListHandler(monitors))
+		r.Post(prefix+"/monitors", MonitorCreateHandler(cfg, monitors))
+		r.Get(prefix+"/monitors/{id}", MonitorGetHandler(monitors))
+		r.Put(prefix+"/monitors/{id}", MonitorUpdateHandler(cfg, monitors))
+		r.Delete(prefix+"/monitors/{id}", MonitorDeleteHandler(monitors))
+		r.Get(prefix+"/monitors/{id}/results", MonitorResultsHandler(monitors))
+		r.Get(prefix+"/monitors/{id}/rollups", MonitorRollupsHandler(monitors))
+		r.Get(prefix+"/retention", RetentionHandler(monitors))
+
+		r.Get(prefix+"/webhooks", WebhookListHandler(webhooks))
+		r.Post(prefix+"/webhooks", WebhookCreateHandler(webhooks))
+		r.Get(prefix+"/webhooks/{id}", WebhookGetHandler(webhooks))
+		r.Delete(prefix+"/webhooks/{id}", WebhookDeleteHandler(webhooks))
+		r.Get(prefix+"/webhooks/{id}/deliveries", WebhookDeliveriesHandler(webhooks))
+		r.Post(prefix+"/webhooks/{id}/test", WebhookTestHandler(webhooks))
+	}
+
+	r.Get("/api/v2/resolve", ResolveGetV2Handler(cfg, cache, store))
+	r.Post("/api/v2/resolve", ResolveV2Handler(cfg, cache, store))
+	r.Get("/api/v2/resolve/stream", ResolveStreamV2Handler(cfg, cache))
 
 	// reasonable server default timeouts if used directly (optional here)
 	_ = (&http.Server{ReadTimeout: 5 * time.Second, WriteTimeout: 30 * time.Second, IdleTimeout: 60 * time.Second})
 	return r
-}
\ No newline at end of file
+}
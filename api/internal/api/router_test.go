@@ -3,6 +3,7 @@ package api
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,18 +12,18 @@ import (
 
 func TestCORSPreflight_AllowsConfiguredOrigin(t *testing.T) {
 	cfg := &config.Config{
-		Port:           "8080",
-		LogLevel:       "info",
-		CorsOrigins:    []string{"http://example.com"},
-		Resolvers:      []string{"203.0.113.1"},
-		RequestTimeout: 200 * time.Millisecond,
-		CacheTTL:       time.Second,
+		Port:            "8080",
+		LogLevel:        "info",
+		CorsOrigins:     []string{"http://example.com"},
+		Resolvers:       []string{"203.0.113.1"},
+		RequestTimeout:  200 * time.Millisecond,
+		CacheTTL:        time.Second,
 		CacheMaxEntries: 10,
-		RateLimitRPS:   10,
-		RateLimitBurst: 5,
-		RateLimitTTL:   time.Minute,
+		RateLimitRPS:    10,
+		RateLimitBurst:  5,
+		RateLimitTTL:    time.Minute,
 	}
-	r := NewRouter(cfg, nil)
+	r := newTestRouter(cfg)
 
 	req := httptest.NewRequest(http.MethodOptions, "/api/resolve", nil)
 	req.Header.Set("Origin", "http://example.com")
@@ -36,4 +37,41 @@ func TestCORSPreflight_AllowsConfiguredOrigin(t *testing.T) {
 	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "http://example.com" {
 		t.Fatalf("ACAO not set correctly: %q", got)
 	}
-}
\ No newline at end of file
+}
+
+func TestRouter_UnknownRouteIsProblem(t *testing.T) {
+	r := newTestRouter(testConfig())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/nope", nil))
+	assertProblem(t, w, http.StatusNotFound, "not_found")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/resolve", nil))
+	assertProblem(t, w, http.StatusMethodNotAllowed, "method_not_allowed")
+}
+
+func TestRouter_V1SharesStateWithUnversioned(t *testing.T) {
+	r := newTestRouter(testConfig())
+	body := `{"name":"example.com","type":"A","servers":["127.0.0.1"],"interval_seconds":1,"timeout_seconds":1}`
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/watch", strings.NewReader(body)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	loc := w.Header().Get("Location")
+	if !strings.HasPrefix(loc, "/api/v1/watch/") {
+		t.Fatalf("expected Location under /api/v1, got %q", loc)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, strings.Replace(loc, "/api/v1/", "/api/", 1), nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected the watch to be visible under /api, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/healthz", nil))
+	assertProblem(t, w, http.StatusNotFound, "not_found")
+}
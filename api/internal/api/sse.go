@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// sseWriter writes Server-Sent Events to a streaming response.
+type sseWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// newSSEWriter sends the event-stream headers and lifts the server's write deadline, since a
+// stream outlives the normal request budget. The caller bounds the stream's lifetime instead.
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, error) {
+	rc := http.NewResponseController(w)
+	h := w.Header()
+	h.Set("content-type", "text/event-stream")
+	h.Set("cache-control", "no-cache")
+	h.Set("x-accel-buffering", "no")
+	_ = rc.SetWriteDeadline(time.Time{}) // unsupported by some writers (e.g. tests); not fatal
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return nil, fmt.Errorf("streaming unsupported: %w", err)
+	}
+	return &sseWriter{w: w, rc: rc}, nil
+}
+
+// send writes one event with a JSON payload and flushes it to the client.
+func (s *sseWriter) send(event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
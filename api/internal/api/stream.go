@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/legertom/dnsprop/api/internal/config"
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+	"github.com/legertom/dnsprop/api/internal/problem"
+)
+
+// StreamSummary is the final event of a resolve stream.
+type StreamSummary struct {
+	Name        string         `json:"name"`
+	Type        string         `json:"type"`
+	Total       int            `json:"total"`
+	Statuses    map[string]int `json:"statuses"`
+	Propagation *Propagation   `json:"propagation,omitempty"`
+}
+
+// ResolveStreamHandler serves GET /api/resolve/stream?name=&type=&servers=&dnssec= as
+// Server-Sent Events: one "result" event per resolver as it answers, then a "summary" event.
+// A client disconnect cancels the request context, which abandons outstanding queries.
+func ResolveStreamHandler(cfg *config.Config, cache resolver.Cache) http.HandlerFunc {
+	return resolveStreamHandler(cfg, cache, func(_ ResolveRequest, rr resolver.Result) any { return toResult(rr) })
+}
+
+// resolveStreamHandler streams results shaped by result; the summary is the same in every version.
+func resolveStreamHandler(cfg *config.Config, cache resolver.Cache, result func(ResolveRequest, resolver.Result) any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := resolveRequestFromQuery(r.URL.Query())
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		servers, err := normalizeResolveRequest(cfg, &req)
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		sse, err := newSSEWriter(w)
+		if err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.RequestTimeout)
+		defer cancel()
+
+		summary := streamResolve(ctx, cfg, cache, req, servers, func(rr resolver.Result) {
+			if err := sse.send("result", result(req, rr)); err != nil {
+				cancel() // client went away; stop querying
+			}
+		})
+		if r.Context().Err() != nil {
+			return
+		}
+		sse.send("summary", summary)
+	}
+}
+
+// streamResolve runs a validated request, passing each result to emit as it arrives, and returns
+// the summary. With req.ETA the authoritative lookup for the propagation estimate runs alongside
+// the resolvers.
+func streamResolve(ctx context.Context, cfg *config.Config, cache resolver.Cache, req ResolveRequest, servers []string, emit func(resolver.Result)) StreamSummary {
+	auth := startAuthoritative(ctx, cfg, req)
+
+	summary := StreamSummary{Name: req.Name, Type: req.Type, Statuses: map[string]int{}}
+	results := make([]resolver.Result, 0, len(servers))
+	resolver.ResolveStream(ctx, req.Name, req.Type, servers, req.DNSSEC, cfg.RequestTimeout, cache, cfg.CacheTTL, func(rr resolver.Result) {
+		results = append(results, rr)
+		summary.Total++
+		summary.Statuses[rr.Status]++
+		emit(rr)
+	})
+	if a, ok := auth(); ok {
+		summary.Propagation = toPropagation(resolver.EstimatePropagation(results, a))
+	}
+	return summary
+}
+
+// resolveRequestFromQuery builds a ResolveRequest from URL parameters; servers is comma-separated.
+func resolveRequestFromQuery(q url.Values) (ResolveRequest, error) {
+	req := ResolveRequest{Name: q.Get("name"), Type: q.Get("type")}
+	if v := q.Get("servers"); v != "" {
+		req.Servers = strings.Split(v, ",")
+	}
+	if v := q.Get("dnssec"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return req, errInvalidDNSSEC
+		}
+		req.DNSSEC = b
+	}
+	if v := q.Get("eta"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return req, errInvalidETA
+		}
+		req.ETA = b
+	}
+	return req, nil
+}
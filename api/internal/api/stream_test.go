@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResolveStreamHandler_EmitsResultsThenSummary(t *testing.T) {
+	h := ResolveStreamHandler(testConfig(), nil)
+	r := httptest.NewRequest(http.MethodGet, "/api/resolve/stream?name=example.com&type=A&servers=127.0.0.1,127.0.0.2", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if ct := w.Header().Get("content-type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content-type %q", ct)
+	}
+	body := w.Body.String()
+	if n := strings.Count(body, "event: result\n"); n != 2 {
+		t.Fatalf("expected 2 result events, got %d: %q", n, body)
+	}
+	last := strings.LastIndex(body, "event: ")
+	if !strings.HasPrefix(body[last:], "event: summary\n") || !strings.Contains(body[last:], `"total":2`) {
+		t.Fatalf("expected trailing summary event, got %q", body[last:])
+	}
+}
+
+func TestResolveStreamHandler_InvalidParams(t *testing.T) {
+	h := ResolveStreamHandler(testConfig(), nil)
+	for _, q := range []string{"name=ex@mple.com&type=A", "name=example.com&type=A&dnssec=maybe"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/resolve/stream?"+q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", q, w.Code)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/legertom/dnsprop/api/internal/history"
+	"github.com/legertom/dnsprop/api/internal/problem"
+	"github.com/legertom/dnsprop/api/internal/validation"
+)
+
+// MaxTimelineChecks bounds how many stored checks one timeline is built from; older checks in
+// the window are left out and the response is marked truncated.
+const MaxTimelineChecks = 1000
+
+// TimelineInterval is a run of consecutive identical observations by one resolver. EndedAt is
+// when the resolver was first seen answering something else; it is absent for the latest run.
+type TimelineInterval struct {
+	Status       string     `json:"status"`
+	Answers      []string   `json:"answers"`
+	FirstSeen    time.Time  `json:"first_seen"`
+	LastSeen     time.Time  `json:"last_seen"`
+	EndedAt      *time.Time `json:"ended_at,omitempty"`
+	Observations int        `json:"observations"`
+}
+
+type ResolverTimeline struct {
+	Server    string             `json:"server"`
+	Region    string             `json:"region,omitempty"`
+	Intervals []TimelineInterval `json:"intervals"`
+}
+
+// TimelineAnswerSet is one distinct status and answer set seen by any resolver in the window.
+type TimelineAnswerSet struct {
+	Status    string    `json:"status"`
+	Answers   []string  `json:"answers"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Resolvers int       `json:"resolvers"`
+}
+
+// TimelineResponse is the response of GET /api/timeline.
+type TimelineResponse struct {
+	Name       string              `json:"name"`
+	Type       string              `json:"type"`
+	Checks     int                 `json:"checks"`
+	Truncated  bool                `json:"truncated,omitempty"`
+	AnswerSets []TimelineAnswerSet `json:"answer_sets"`
+	Resolvers  []ResolverTimeline  `json:"resolvers"`
+}
+
+// TimelineHandler serves GET /api/timeline?name=&type=&since=&until=, showing how the answers
+// for a record evolved across stored checks. since and until are RFC 3339 times and optional.
+func TimelineHandler(store history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "history is disabled")
+			return
+		}
+		q := r.URL.Query()
+		name, err := validation.ValidateDomainName(q.Get("name"))
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		query := history.RangeQuery{
+			Name:  strings.ToLower(name),
+			Type:  strings.ToUpper(strings.TrimSpace(q.Get("type"))),
+			Limit: MaxTimelineChecks + 1,
+		}
+		if err := validation.ValidateRecordType(query.Type); err != nil {
+			problem.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		for param, dst := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+			if v := q.Get(param); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, param+" must be an RFC 3339 time")
+					return
+				}
+				*dst = t
+			}
+		}
+
+		checks, err := store.Range(r.Context(), query)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "history_range_failed", slog.String("name", query.Name), slog.String("error", err.Error()))
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "could not read history")
+			return
+		}
+		truncated := len(checks) > MaxTimelineChecks
+		if truncated {
+			checks = checks[1:] // Range returns oldest first
+		}
+		out := buildTimeline(query.Name, query.Type, checks)
+		out.Truncated = truncated
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// buildTimeline collapses checks, oldest first, into intervals per resolver. A resolver missing
+// from a check (e.g. a custom server list) does not end its current interval.
+func buildTimeline(name, qtype string, checks []history.Check) TimelineResponse {
+	out := TimelineResponse{Name: name, Type: qtype, AnswerSets: []TimelineAnswerSet{}, Resolvers: []ResolverTimeline{}}
+	byServer := map[string]int{}
+	bySet := map[string]int{}
+	seenBy := map[string]map[string]struct{}{}
+
+	for _, c := range checks {
+		var resp ResolveResponse
+		if err := json.Unmarshal(c.Response, &resp); err != nil {
+			continue
+		}
+		out.Checks++
+		at := c.CreatedAt
+		for _, res := range resp.Results {
+			answers := sortedKeys(answerTTLs(res.Answers))
+			key := res.Status + "|" + strings.Join(answers, ",")
+
+			i, ok := byServer[res.Server]
+			if !ok {
+				i = len(out.Resolvers)
+				byServer[res.Server] = i
+				out.Resolvers = append(out.Resolvers, ResolverTimeline{Server: res.Server, Region: res.Region})
+			}
+			rt := &out.Resolvers[i]
+			if n := len(rt.Intervals); n > 0 && intervalKey(rt.Intervals[n-1]) == key {
+				rt.Intervals[n-1].LastSeen = at
+				rt.Intervals[n-1].Observations++
+			} else {
+				if n > 0 {
+					ended := at
+					rt.Intervals[n-1].EndedAt = &ended
+				}
+				rt.Intervals = append(rt.Intervals, TimelineInterval{Status: res.Status, Answers: answers, FirstSeen: at, LastSeen: at, Observations: 1})
+			}
+
+			j, ok := bySet[key]
+			if !ok {
+				j = len(out.AnswerSets)
+				bySet[key] = j
+				seenBy[key] = map[string]struct{}{}
+				out.AnswerSets = append(out.AnswerSets, TimelineAnswerSet{Status: res.Status, Answers: answers, FirstSeen: at})
+			}
+			out.AnswerSets[j].LastSeen = at
+			seenBy[key][res.Server] = struct{}{}
+			out.AnswerSets[j].Resolvers = len(seenBy[key])
+		}
+	}
+	return out
+}
+
+func intervalKey(iv TimelineInterval) string {
+	return iv.Status + "|" + strings.Join(iv.Answers, ",")
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/legertom/dnsprop/api/internal/history"
+	"github.com/legertom/dnsprop/api/internal/ratelimit"
+	"github.com/legertom/dnsprop/api/internal/watch"
+)
+
+// storedCheck builds a check whose stored response has one result per server→answer entry.
+func storedCheck(t *testing.T, at time.Time, answers map[string]string) *history.Check {
+	t.Helper()
+	resp := ResolveResponse{Name: "example.com", Type: "A"}
+	for _, server := range sortedKeys(answers) {
+		res := Result{Server: server, Status: "ok"}
+		if answers[server] == "" {
+			res.Status = "nxdomain"
+		} else {
+			res.Answers = []Answer{{Value: answers[server], TTL: 300}}
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &history.Check{Name: "example.com", Type: "A", Source: "test", CreatedAt: at, Response: raw}
+}
+
+func TestBuildTimeline(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(m int) time.Time { return base.Add(time.Duration(m) * time.Minute) }
+	checks := []history.Check{
+		*storedCheck(t, at(0), map[string]string{"1.1.1.1": "192.0.2.1", "8.8.8.8": "192.0.2.1"}),
+		*storedCheck(t, at(1), map[string]string{"1.1.1.1": "192.0.2.2", "8.8.8.8": "192.0.2.1"}),
+		*storedCheck(t, at(2), map[string]string{"1.1.1.1": "192.0.2.2"}),
+		*storedCheck(t, at(3), map[string]string{"1.1.1.1": "192.0.2.2", "8.8.8.8": "192.0.2.2"}),
+		{Name: "example.com", Type: "A", CreatedAt: at(4), Response: json.RawMessage(`not json`)},
+	}
+	tl := buildTimeline("example.com", "A", checks)
+	if tl.Checks != 4 || len(tl.Resolvers) != 2 || len(tl.AnswerSets) != 2 {
+		t.Fatalf("unexpected timeline shape: %+v", tl)
+	}
+
+	cf := tl.Resolvers[0]
+	if cf.Server != "1.1.1.1" || len(cf.Intervals) != 2 {
+		t.Fatalf("expected 2 intervals for 1.1.1.1, got %+v", cf)
+	}
+	if iv := cf.Intervals[0]; iv.Answers[0] != "192.0.2.1" || iv.Observations != 1 || iv.EndedAt == nil || !iv.EndedAt.Equal(at(1)) {
+		t.Fatalf("unexpected first interval: %+v", iv)
+	}
+	if iv := cf.Intervals[1]; !iv.FirstSeen.Equal(at(1)) || !iv.LastSeen.Equal(at(3)) || iv.Observations != 3 || iv.EndedAt != nil {
+		t.Fatalf("unexpected open interval: %+v", iv)
+	}
+
+	// 8.8.8.8 was missing from the check at minute 2, which does not split its first interval.
+	google := tl.Resolvers[1].Intervals
+	if len(google) != 2 || !google[0].LastSeen.Equal(at(1)) || !google[1].FirstSeen.Equal(at(3)) {
+		t.Fatalf("unexpected 8.8.8.8 intervals: %+v", google)
+	}
+
+	old, fresh := tl.AnswerSets[0], tl.AnswerSets[1]
+	if old.Answers[0] != "192.0.2.1" || !old.LastSeen.Equal(at(1)) || old.Resolvers != 2 {
+		t.Fatalf("unexpected old answer set: %+v", old)
+	}
+	if fresh.Answers[0] != "192.0.2.2" || !fresh.FirstSeen.Equal(at(1)) || fresh.Resolvers != 2 {
+		t.Fatalf("unexpected new answer set: %+v", fresh)
+	}
+}
+
+func TestTimeline_Handler(t *testing.T) {
+	store, err := history.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i, answer := range []string{"192.0.2.1", "192.0.2.1", "", "192.0.2.2"} {
+		store.Add(context.Background(), storedCheck(t, base.Add(time.Duration(i)*time.Minute), map[string]string{"1.1.1.1": answer}))
+	}
+	cfg := testConfig()
+	router := NewRouter(cfg, nil, ratelimit.NewLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst, cfg.RateLimitTTL), store, nil, nil, watch.NewManager(cfg.WatchMaxJobs, cfg.RequestTimeout))
+	doc := loadOpenAPI(t)
+
+	get := func(query string) TimelineResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/timeline?"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("timeline: %d %s", w.Code, w.Body.String())
+		}
+		schema, err := doc.responseSchema("/api/timeline", "GET", w.Code, w.Header().Get("content-type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc.checkJSON(t, schema, w.Body.Bytes(), "timeline response")
+		var tl TimelineResponse
+		json.Unmarshal(w.Body.Bytes(), &tl)
+		return tl
+	}
+
+	tl := get("name=Example.com&type=a")
+	if tl.Checks != 4 || len(tl.Resolvers) != 1 {
+		t.Fatalf("unexpected timeline: %+v", tl)
+	}
+	statuses := []string{}
+	for _, iv := range tl.Resolvers[0].Intervals {
+		statuses = append(statuses, iv.Status)
+	}
+	if len(statuses) != 3 || statuses[0] != "ok" || statuses[1] != "nxdomain" || statuses[2] != "ok" {
+		t.Fatalf("expected ok, nxdomain, ok intervals, got %v", statuses)
+	}
+
+	since := base.Add(90 * time.Second).Format(time.RFC3339)
+	if tl := get("name=example.com&type=A&since=" + since); tl.Checks != 2 {
+		t.Fatalf("expected 2 checks since %s, got %d", since, tl.Checks)
+	}
+	if tl := get("name=example.com&type=MX"); tl.Checks != 0 || len(tl.Resolvers) != 0 {
+		t.Fatalf("expected an empty MX timeline, got %+v", tl)
+	}
+
+	for query, code := range map[string]string{
+		"type=A":                             "invalid_domain",
+		"name=example.com":                   "unsupported_type",
+		"name=example.com&type=A&since=2024": "invalid_request",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/timeline?"+query, nil))
+		assertProblem(t, w, http.StatusBadRequest, code)
+	}
+}
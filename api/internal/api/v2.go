@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/legertom/dnsprop/api/internal/config"
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+	"github.com/legertom/dnsprop/api/internal/history"
+	"github.com/legertom/dnsprop/api/internal/problem"
+)
+
+// Per-result propagation states in v2.
+const (
+	PropagationCurrent = "current"
+	PropagationStale   = "stale"
+	PropagationUnknown = "unknown"
+)
+
+// ResultV2 is the v2 per-resolver result. Unlike v1, every field is always present (empty arrays
+// rather than omitted ones) and resolver metadata, DNSSEC and cache details are grouped.
+type ResultV2 struct {
+	Server    string       `json:"server"`
+	Resolver  ResolverMeta `json:"resolver"`
+	Status    string       `json:"status"`
+	RTTMs     float64      `json:"rtt_ms"`
+	Answers   []AnswerV2   `json:"answers"`
+	Authority []string     `json:"authority"`
+	DNSSEC    DNSSECStatus `json:"dnssec"`
+	Cache     CacheStatus  `json:"cache"`
+	When      string       `json:"when"`
+	// Propagation is omitted when no authoritative answer was available, and on stream events,
+	// which are sent before the estimate exists.
+	Propagation *ResultPropagation `json:"propagation,omitempty"`
+}
+
+type ResolverMeta struct {
+	Provider  string  `json:"provider,omitempty"`
+	City      string  `json:"city,omitempty"`
+	Label     string  `json:"label,omitempty"`
+	Family    string  `json:"family"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type AnswerV2 struct {
+	Value string `json:"value"`
+	Type  string `json:"type"`
+	TTL   uint32 `json:"ttl"`
+}
+
+type DNSSECStatus struct {
+	Requested     bool `json:"requested"`
+	Authenticated bool `json:"authenticated"`
+}
+
+// CacheStatus says whether the result came from this server's cache and how long it stays there.
+type CacheStatus struct {
+	Hit          bool   `json:"hit"`
+	QueriedAt    string `json:"queried_at"`
+	RemainingTTL int    `json:"remaining_ttl"`
+	// NegativeTTL is the SOA-derived TTL of an nxdomain/noanswer response.
+	NegativeTTL int `json:"negative_ttl,omitempty"`
+	// Coalesced is set when the result came from an identical query another request had in flight.
+	Coalesced bool `json:"coalesced,omitempty"`
+}
+
+type ResultPropagation struct {
+	State        string `json:"state"`
+	PropagatedBy string `json:"propagated_by,omitempty"`
+}
+
+type ResolveSummary struct {
+	Total    int            `json:"total"`
+	Statuses map[string]int `json:"statuses"`
+}
+
+type ResolveResponseV2 struct {
+	Name        string         `json:"name"`
+	Type        string         `json:"type"`
+	Results     []ResultV2     `json:"results"`
+	Summary     ResolveSummary `json:"summary"`
+	Propagation *Propagation   `json:"propagation,omitempty"`
+	CheckID     string         `json:"check_id,omitempty"`
+}
+
+// v2 shapes the run as a ResolveResponseV2.
+func (run resolveRun) v2() ResolveResponseV2 {
+	now := time.Now()
+	out := ResolveResponseV2{
+		Name:    run.req.Name,
+		Type:    run.req.Type,
+		Results: make([]ResultV2, 0, len(run.results)),
+		Summary: ResolveSummary{Total: len(run.results), Statuses: map[string]int{}},
+		CheckID: run.checkID,
+	}
+	for i, rr := range run.results {
+		res := toResultV2(run.req, rr, now)
+		if run.estimate != nil && i < len(run.estimate.Servers) {
+			res.Propagation = toResultPropagation(rr, run.estimate.Servers[i])
+		}
+		out.Results = append(out.Results, res)
+		out.Summary.Statuses[rr.Status]++
+	}
+	if run.estimate != nil {
+		out.Propagation = toPropagation(*run.estimate)
+	}
+	return out
+}
+
+func toResultV2(req ResolveRequest, rr resolver.Result, now time.Time) ResultV2 {
+	info := resolver.Describe(rr.Server)
+	res := ResultV2{
+		Server: rr.Server,
+		Resolver: ResolverMeta{
+			Provider:  info.Provider,
+			City:      info.City,
+			Label:     info.Label,
+			Family:    info.Family,
+			Latitude:  rr.Latitude,
+			Longitude: rr.Longitude,
+		},
+		Status:    rr.Status,
+		RTTMs:     rr.RTTMs,
+		Answers:   make([]AnswerV2, 0, len(rr.Answers)),
+		Authority: make([]string, 0, len(rr.Authority)),
+		DNSSEC:    DNSSECStatus{Requested: req.DNSSEC, Authenticated: rr.AD},
+		Cache: CacheStatus{
+			// Cache hits keep the original query time; When is restamped on every read.
+			Hit:         !rr.QueriedAt.IsZero() && !rr.When.Equal(rr.QueriedAt),
+			QueriedAt:   rr.QueriedAt.UTC().Format(time.RFC3339),
+			NegativeTTL: int(rr.NegativeTTL / time.Second),
+			Coalesced:   rr.Coalesced,
+		},
+		When: rr.When.UTC().Format(time.RFC3339),
+	}
+	if left := rr.CacheTTL - now.Sub(rr.QueriedAt); left > 0 {
+		res.Cache.RemainingTTL = int(left / time.Second)
+	}
+	for _, a := range rr.Answers {
+		qtype := a.Type
+		if qtype == "" {
+			qtype = req.Type
+		}
+		res.Answers = append(res.Answers, AnswerV2{Value: a.Value, Type: qtype, TTL: a.TTL})
+	}
+	res.Authority = append(res.Authority, rr.Authority...)
+	return res
+}
+
+func toResultPropagation(rr resolver.Result, eta resolver.ServerETA) *ResultPropagation {
+	switch {
+	case rr.Status == "timeout" || rr.Status == "error":
+		return &ResultPropagation{State: PropagationUnknown}
+	case eta.Current:
+		return &ResultPropagation{State: PropagationCurrent}
+	}
+	p := &ResultPropagation{State: PropagationStale}
+	if !eta.ExpiresAt.IsZero() {
+		p.PropagatedBy = eta.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return p
+}
+
+// ResolveV2Handler serves POST /api/v2/resolve. It takes the same request as v1.
+func ResolveV2Handler(cfg *config.Config, cache resolver.Cache, store history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ResolveRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "invalid json")
+			return
+		}
+		servers, err := normalizeResolveRequest(cfg, &req)
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.RequestTimeout)
+		defer cancel()
+		run := runResolve(ctx, cfg, cache, req, servers)
+		recordCheck(r.Context(), store, &run, httpCheckMeta(r))
+		out := run.v2()
+
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// ResolveGetV2Handler serves GET /api/v2/resolve with the caching behavior of GET /api/resolve.
+func ResolveGetV2Handler(cfg *config.Config, cache resolver.Cache, store history.Store) http.HandlerFunc {
+	return resolveGetHandler(cfg, cache, store, "v2", func(run resolveRun) any { return run.v2() })
+}
+
+// ResolveStreamV2Handler serves GET /api/v2/resolve/stream; result events are ResultV2.
+func ResolveStreamV2Handler(cfg *config.Config, cache resolver.Cache) http.HandlerFunc {
+	return resolveStreamHandler(cfg, cache, func(req ResolveRequest, rr resolver.Result) any {
+		return toResultV2(req, rr, time.Now())
+	})
+}
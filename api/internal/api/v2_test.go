@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+)
+
+func TestResolveRunV2(t *testing.T) {
+	now := time.Now().UTC()
+	earlier := now.Add(-20 * time.Second)
+	run := resolveRun{
+		req: ResolveRequest{Name: "example.com", Type: "A", DNSSEC: true},
+		results: []resolver.Result{
+			{Server: "1.1.1.1", Status: "ok", AD: true, When: now, QueriedAt: now, CacheTTL: time.Minute, Coalesced: true,
+				Answers: []resolver.Answer{{Value: "192.0.2.1", TTL: 60}}},
+			{Server: "8.8.8.8", Status: "ok", When: now, QueriedAt: earlier, CacheTTL: time.Minute,
+				Answers: []resolver.Answer{{Value: "192.0.2.9", TTL: 40}}},
+			{Server: "9.9.9.9", Status: "timeout", When: now, QueriedAt: now},
+		},
+		estimate: &resolver.PropagationEstimate{
+			Servers: []resolver.ServerETA{
+				{Server: "1.1.1.1", Current: true},
+				{Server: "8.8.8.8", ExpiresAt: now.Add(40 * time.Second)},
+				{Server: "9.9.9.9"},
+			},
+			Current: 1, Stale: 1, Unknown: 1,
+		},
+	}
+	out := run.v2()
+
+	if out.Summary.Total != 3 || out.Summary.Statuses["ok"] != 2 || out.Propagation == nil {
+		t.Fatalf("unexpected summary: %+v", out)
+	}
+	fresh, cached, timedOut := out.Results[0], out.Results[1], out.Results[2]
+	if fresh.Cache.Hit || !cached.Cache.Hit {
+		t.Fatalf("expected only the second result to be a cache hit: %+v / %+v", fresh.Cache, cached.Cache)
+	}
+	if !fresh.Cache.Coalesced || cached.Cache.Coalesced {
+		t.Fatalf("expected only the first result to be coalesced: %+v / %+v", fresh.Cache, cached.Cache)
+	}
+	if cached.Cache.RemainingTTL < 39 || cached.Cache.RemainingTTL > 40 {
+		t.Fatalf("expected ~40s remaining, got %d", cached.Cache.RemainingTTL)
+	}
+	if !fresh.DNSSEC.Requested || !fresh.DNSSEC.Authenticated || fresh.Answers[0].Type != "A" {
+		t.Fatalf("unexpected fresh result: %+v", fresh)
+	}
+	if fresh.Resolver.Provider != "Cloudflare" || fresh.Resolver.Family != resolver.FamilyIPv4 {
+		t.Fatalf("expected resolver metadata, got %+v", fresh.Resolver)
+	}
+	states := []string{fresh.Propagation.State, cached.Propagation.State, timedOut.Propagation.State}
+	if states[0] != PropagationCurrent || states[1] != PropagationStale || states[2] != PropagationUnknown {
+		t.Fatalf("unexpected propagation states %v", states)
+	}
+	if cached.Propagation.PropagatedBy == "" {
+		t.Fatal("expected propagated_by on the stale result")
+	}
+
+	// Empty lists are arrays, not omitted or null.
+	raw, _ := json.Marshal(timedOut)
+	var m map[string]any
+	json.Unmarshal(raw, &m)
+	if _, ok := m["answers"].([]any); !ok {
+		t.Fatalf("expected answers to be an empty array: %s", raw)
+	}
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/legertom/dnsprop/api/internal/config"
+	"github.com/legertom/dnsprop/api/internal/problem"
+	"github.com/legertom/dnsprop/api/internal/watch"
+)
+
+// Defaults for watch jobs when the request leaves them out.
+const (
+	defaultWatchInterval = 30 * time.Second
+	defaultWatchTimeout  = 15 * time.Minute
+)
+
+type WatchRequest struct {
+	ResolveRequest
+	Expected        []string `json:"expected,omitempty"`
+	IntervalSeconds int      `json:"interval_seconds,omitempty"`
+	TimeoutSeconds  int      `json:"timeout_seconds,omitempty"`
+}
+
+type WatchStatus struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Expected    []string `json:"expected,omitempty"`
+	State       string   `json:"state"`
+	Iterations  int      `json:"iterations"`
+	Agreeing    int      `json:"agreeing"`
+	Unreachable int      `json:"unreachable"`
+	Total       int      `json:"total"`
+	StartedAt   string   `json:"started_at"`
+	Deadline    string   `json:"deadline"`
+	UpdatedAt   string   `json:"updated_at"`
+	ConvergedAt string   `json:"converged_at,omitempty"`
+	Results     []Result `json:"results,omitempty"`
+}
+
+// WatchCreateHandler starts a job that re-resolves (bypassing the cache) every interval until
+// all reachable resolvers agree or the timeout passes.
+func WatchCreateHandler(cfg *config.Config, watches *watch.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req WatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "invalid json")
+			return
+		}
+		servers, err := normalizeResolveRequest(cfg, &req.ResolveRequest)
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		interval := defaultWatchInterval
+		if req.IntervalSeconds > 0 {
+			interval = time.Duration(req.IntervalSeconds) * time.Second
+		}
+		if interval < cfg.WatchMinInterval {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, fmt.Sprintf("interval_seconds must be at least %s", cfg.WatchMinInterval))
+			return
+		}
+		timeout := minDuration(defaultWatchTimeout, cfg.WatchMaxDuration)
+		if req.TimeoutSeconds > 0 {
+			timeout = time.Duration(req.TimeoutSeconds) * time.Second
+		}
+		if timeout > cfg.WatchMaxDuration {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, fmt.Sprintf("timeout_seconds must be at most %s", cfg.WatchMaxDuration))
+			return
+		}
+
+		job, err := watches.Start(watch.Spec{
+			Name:     req.Name,
+			Type:     req.Type,
+			Servers:  servers,
+			DNSSEC:   req.DNSSEC,
+			Expected: req.Expected,
+			Interval: interval,
+			Timeout:  timeout,
+		})
+		if errors.Is(err, watch.ErrTooManyJobs) {
+			problem.Error(w, r, http.StatusServiceUnavailable, err)
+			return
+		}
+		if err != nil {
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "could not start watch")
+			return
+		}
+
+		snap := job.Snapshot()
+		w.Header().Set("content-type", "application/json")
+		w.Header().Set("location", r.URL.Path+"/"+snap.ID) // keeps the /api or /api/v1 prefix
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(toWatchStatus(snap))
+	}
+}
+
+// WatchGetHandler returns the latest state of a watch job for polling clients.
+func WatchGetHandler(watches *watch.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := watches.Get(chi.URLParam(r, "id"))
+		if !ok {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "watch not found")
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(toWatchStatus(job.Snapshot()))
+	}
+}
+
+// WatchCancelHandler stops a running watch job.
+func WatchCancelHandler(watches *watch.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !watches.Cancel(chi.URLParam(r, "id")) {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "watch not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// WatchEventsHandler streams a "progress" event after every poll and a final "done" event.
+// Subscribing avoids the per-IP rate limit that frequent polling would hit.
+func WatchEventsHandler(watches *watch.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := watches.Get(chi.URLParam(r, "id"))
+		if !ok {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "watch not found")
+			return
+		}
+		updates, unsubscribe := job.Subscribe()
+		defer unsubscribe()
+
+		sse, err := newSSEWriter(w)
+		if err != nil {
+			return
+		}
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case snap, ok := <-updates:
+				if !ok {
+					return
+				}
+				event := "progress"
+				if snap.Done() {
+					event = "done"
+				}
+				if err := sse.send(event, toWatchStatus(snap)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func toWatchStatus(s watch.Snapshot) WatchStatus {
+	out := WatchStatus{
+		ID:          s.ID,
+		Name:        s.Spec.Name,
+		Type:        s.Spec.Type,
+		Expected:    s.Spec.Expected,
+		State:       s.State,
+		Iterations:  s.Iterations,
+		Agreeing:    s.Agreeing,
+		Unreachable: s.Unreachable,
+		Total:       s.Total,
+		StartedAt:   s.StartedAt.Format(time.RFC3339),
+		Deadline:    s.Deadline.Format(time.RFC3339),
+		UpdatedAt:   s.UpdatedAt.Format(time.RFC3339),
+	}
+	if !s.ConvergedAt.IsZero() {
+		out.ConvergedAt = s.ConvergedAt.Format(time.RFC3339)
+	}
+	for _, rr := range s.Results {
+		out.Results = append(out.Results, toResult(rr))
+	}
+	return out
+}
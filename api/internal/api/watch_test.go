@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatch_Lifecycle(t *testing.T) {
+	router := newTestRouter(testConfig())
+
+	body := `{"name":"example.com","type":"A","servers":["127.0.0.1"],"interval_seconds":1,"timeout_seconds":1}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/watch", bytes.NewBufferString(body)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var created WatchStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.ID == "" {
+		t.Fatalf("bad create response: %v %s", err, w.Body.String())
+	}
+	if loc := w.Header().Get("location"); loc != "/api/watch/"+created.ID {
+		t.Fatalf("unexpected location %q", loc)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/watch/"+created.ID, nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+
+	// Once cancelled the event stream ends with a done event.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/watch/"+created.ID+"/events", nil))
+	if ct := w.Header().Get("content-type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content-type %q", ct)
+	}
+	if !strings.Contains(w.Body.String(), "event: done\n") || !strings.Contains(w.Body.String(), `"state":"cancelled"`) {
+		t.Fatalf("expected done event, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/watch/nope", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestWatchCreate_RejectsLongTimeout(t *testing.T) {
+	router := newTestRouter(testConfig())
+	body := `{"name":"example.com","type":"A","timeout_seconds":3600}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/watch", bytes.NewBufferString(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestWatchCreate_RejectsShortInterval(t *testing.T) {
+	cfg := testConfig()
+	cfg.WatchMinInterval = 1500 * time.Millisecond
+	body := `{"name":"example.com","type":"A","interval_seconds":1}`
+	w := httptest.NewRecorder()
+	newTestRouter(cfg).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/watch", bytes.NewBufferString(body)))
+	assertProblem(t, w, http.StatusBadRequest, "invalid_request")
+	if !strings.Contains(w.Body.String(), "at least 1.5s") {
+		t.Fatalf("expected the minimum interval in the detail, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,282 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/legertom/dnsprop/api/internal/problem"
+	"github.com/legertom/dnsprop/api/internal/webhook"
+)
+
+// Defaults for the delivery log listing.
+const (
+	defaultWebhookDeliveries = 20
+	maxWebhookDeliveries     = 500
+)
+
+type WebhookRequest struct {
+	URL              string   `json:"url"`
+	Format           string   `json:"format,omitempty"`
+	Events           []string `json:"events,omitempty"`
+	MonitorIDs       []string `json:"monitor_ids,omitempty"`
+	ThresholdPercent int      `json:"threshold_percent,omitempty"`
+}
+
+// WebhookResponse describes a webhook. Secret is only returned when the webhook is created.
+type WebhookResponse struct {
+	ID               string   `json:"id"`
+	URL              string   `json:"url"`
+	Format           string   `json:"format"`
+	Events           []string `json:"events"`
+	MonitorIDs       []string `json:"monitor_ids"`
+	ThresholdPercent int      `json:"threshold_percent"`
+	CreatedAt        string   `json:"created_at"`
+	Secret           string   `json:"secret,omitempty"`
+}
+
+type WebhookList struct {
+	Webhooks []WebhookResponse `json:"webhooks"`
+}
+
+type WebhookDelivery struct {
+	ID         string          `json:"id"`
+	Event      string          `json:"event"`
+	State      string          `json:"state"`
+	Attempts   int             `json:"attempts"`
+	StatusCode int             `json:"status_code,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Payload    json.RawMessage `json:"payload"`
+	CreatedAt  string          `json:"created_at"`
+	UpdatedAt  string          `json:"updated_at"`
+}
+
+type WebhookDeliveries struct {
+	WebhookID  string            `json:"webhook_id"`
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+// WebhookCreateHandler registers a webhook for monitor events. The URL must resolve to public
+// addresses only (see webhook.Dispatcher.CheckURL). The response carries the signing secret,
+// which is not shown again.
+func WebhookCreateHandler(webhooks *webhook.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if webhooks == nil {
+			webhooksDisabled(w, r)
+			return
+		}
+		var req WebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "invalid json")
+			return
+		}
+		hook, detail := validateWebhookRequest(req)
+		if detail != "" {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, detail)
+			return
+		}
+		if err := webhooks.CheckURL(r.Context(), hook.URL); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, err.Error())
+			return
+		}
+		err := webhooks.Create(r.Context(), &hook)
+		if errors.Is(err, webhook.ErrTooManyWebhooks) {
+			problem.Error(w, r, http.StatusServiceUnavailable, err)
+			return
+		}
+		if err != nil {
+			webhookStoreError(w, r, err)
+			return
+		}
+		out := toWebhookResponse(hook)
+		out.Secret = hook.Secret
+		w.Header().Set("content-type", "application/json")
+		w.Header().Set("location", r.URL.Path+"/"+hook.ID) // keeps the /api or /api/v1 prefix
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// WebhookListHandler lists all webhooks, oldest first.
+func WebhookListHandler(webhooks *webhook.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if webhooks == nil {
+			webhooksDisabled(w, r)
+			return
+		}
+		hooks, err := webhooks.List(r.Context())
+		if err != nil {
+			webhookStoreError(w, r, err)
+			return
+		}
+		out := WebhookList{Webhooks: make([]WebhookResponse, 0, len(hooks))}
+		for _, h := range hooks {
+			out.Webhooks = append(out.Webhooks, toWebhookResponse(h))
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+func WebhookGetHandler(webhooks *webhook.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if webhooks == nil {
+			webhooksDisabled(w, r)
+			return
+		}
+		hook, err := webhooks.Get(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			webhookStoreError(w, r, err)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(toWebhookResponse(hook))
+	}
+}
+
+func WebhookDeleteHandler(webhooks *webhook.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if webhooks == nil {
+			webhooksDisabled(w, r)
+			return
+		}
+		if err := webhooks.Delete(r.Context(), chi.URLParam(r, "id")); err != nil {
+			webhookStoreError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// WebhookDeliveriesHandler serves GET /api/webhooks/{id}/deliveries?limit=, newest first.
+func WebhookDeliveriesHandler(webhooks *webhook.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if webhooks == nil {
+			webhooksDisabled(w, r)
+			return
+		}
+		limit := defaultWebhookDeliveries
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxWebhookDeliveries {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "limit must be between 1 and "+strconv.Itoa(maxWebhookDeliveries))
+				return
+			}
+			limit = n
+		}
+		id := chi.URLParam(r, "id")
+		deliveries, err := webhooks.Deliveries(r.Context(), id, limit)
+		if err != nil {
+			webhookStoreError(w, r, err)
+			return
+		}
+		out := WebhookDeliveries{WebhookID: id, Deliveries: make([]WebhookDelivery, 0, len(deliveries))}
+		for _, d := range deliveries {
+			out.Deliveries = append(out.Deliveries, toWebhookDelivery(d))
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// WebhookTestHandler sends a ping to the webhook once and returns the delivery, whether or not
+// the receiver accepted it.
+func WebhookTestHandler(webhooks *webhook.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if webhooks == nil {
+			webhooksDisabled(w, r)
+			return
+		}
+		d, err := webhooks.Test(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			webhookStoreError(w, r, err)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(toWebhookDelivery(d))
+	}
+}
+
+// validateWebhookRequest returns the webhook to create, or a problem detail when req is invalid.
+func validateWebhookRequest(req WebhookRequest) (webhook.Webhook, string) {
+	u, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return webhook.Webhook{}, "url must be an absolute http or https URL"
+	}
+	format := strings.ToLower(strings.TrimSpace(req.Format))
+	if format == "" {
+		format = webhook.FormatJSON
+	}
+	if !slices.Contains(webhook.Formats, format) {
+		return webhook.Webhook{}, "format must be one of " + strings.Join(webhook.Formats, ", ")
+	}
+	for _, e := range req.Events {
+		if !slices.Contains(webhook.Events, e) {
+			return webhook.Webhook{}, "events must be among " + strings.Join(webhook.Events, ", ")
+		}
+	}
+	if req.ThresholdPercent < 0 || req.ThresholdPercent > 100 {
+		return webhook.Webhook{}, "threshold_percent must be between 0 and 100"
+	}
+	return webhook.Webhook{
+		URL:              u.String(),
+		Format:           format,
+		Events:           req.Events,
+		MonitorIDs:       req.MonitorIDs,
+		ThresholdPercent: req.ThresholdPercent,
+	}, ""
+}
+
+func webhooksDisabled(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "webhooks are disabled")
+}
+
+func webhookStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, webhook.ErrNotFound) {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "webhook not found")
+		return
+	}
+	slog.ErrorContext(r.Context(), "webhook_store_failed", slog.String("error", err.Error()))
+	problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "could not access webhooks")
+}
+
+func toWebhookResponse(h webhook.Webhook) WebhookResponse {
+	out := WebhookResponse{
+		ID:               h.ID,
+		URL:              h.URL,
+		Format:           h.Format,
+		Events:           h.Events,
+		MonitorIDs:       h.MonitorIDs,
+		ThresholdPercent: h.ThresholdPercent,
+		CreatedAt:        h.CreatedAt.Format(time.RFC3339),
+	}
+	if out.Events == nil {
+		out.Events = []string{}
+	}
+	if out.MonitorIDs == nil {
+		out.MonitorIDs = []string{}
+	}
+	return out
+}
+
+func toWebhookDelivery(d webhook.Delivery) WebhookDelivery {
+	return WebhookDelivery{
+		ID:         d.ID,
+		Event:      d.Event,
+		State:      d.State,
+		Attempts:   d.Attempts,
+		StatusCode: d.StatusCode,
+		Error:      d.Error,
+		Payload:    d.Payload,
+		CreatedAt:  d.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:  d.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/legertom/dnsprop/api/internal/config"
+	"github.com/legertom/dnsprop/api/internal/ratelimit"
+	"github.com/legertom/dnsprop/api/internal/watch"
+	"github.com/legertom/dnsprop/api/internal/webhook"
+)
+
+func newWebhookRouter(t *testing.T) http.Handler {
+	t.Helper()
+	return newWebhookRouterWith(t, testConfig())
+}
+
+func newWebhookRouterWith(t *testing.T, cfg *config.Config) http.Handler {
+	t.Helper()
+	store, err := webhook.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhooks := webhook.NewDispatcher(store, cfg.WebhookMaxCount, cfg.WebhookMaxAttempts, cfg.WebhookRetryBackoff, cfg.WebhookTimeout, cfg.WebhookAllowPrivate)
+	t.Cleanup(func() {
+		webhooks.Close()
+		store.Close()
+	})
+	return NewRouter(cfg, nil, ratelimit.NewLimiter(100, 100, time.Minute), nil, nil, webhooks, watch.NewManager(cfg.WatchMaxJobs, cfg.RequestTimeout))
+}
+
+func TestWebhook_Lifecycle(t *testing.T) {
+	var got http.Header
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	router := newWebhookRouter(t)
+	doc := loadOpenAPI(t)
+
+	do := func(method, path, body string, status int, route string, out any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		if w.Code != status {
+			t.Fatalf("%s %s: expected %d, got %d: %s", method, path, status, w.Code, w.Body.String())
+		}
+		schema, err := doc.responseSchema(route, method, w.Code, w.Header().Get("content-type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if schema != nil {
+			doc.checkJSON(t, schema, w.Body.Bytes(), method+" "+path+" response")
+		}
+		if out != nil {
+			json.Unmarshal(w.Body.Bytes(), out)
+		}
+	}
+
+	body := `{"url":"` + receiver.URL + `","events":["state_changed"],"threshold_percent":80}`
+	doc.checkJSON(t, doc.requestSchema("/api/webhooks", "POST"), []byte(body), "create request")
+	var created WebhookResponse
+	do(http.MethodPost, "/api/v1/webhooks", body, http.StatusCreated, "/api/webhooks", &created)
+	if created.ID == "" || created.Secret == "" || created.Format != webhook.FormatJSON || created.ThresholdPercent != 80 {
+		t.Fatalf("unexpected webhook: %+v", created)
+	}
+
+	var fetched WebhookResponse
+	do(http.MethodGet, "/api/webhooks/"+created.ID, "", http.StatusOK, "/api/webhooks/{id}", &fetched)
+	if fetched.Secret != "" || fetched.URL != receiver.URL {
+		t.Fatalf("expected the webhook without its secret, got %+v", fetched)
+	}
+	var list WebhookList
+	do(http.MethodGet, "/api/webhooks", "", http.StatusOK, "/api/webhooks", &list)
+	if len(list.Webhooks) != 1 || list.Webhooks[0].Secret != "" {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+
+	var ping WebhookDelivery
+	do(http.MethodPost, "/api/webhooks/"+created.ID+"/test", "", http.StatusOK, "/api/webhooks/{id}/test", &ping)
+	if ping.State != webhook.DeliverySucceeded || ping.Event != webhook.EventPing || ping.StatusCode != http.StatusNoContent {
+		t.Fatalf("unexpected ping: %+v", ping)
+	}
+	if got.Get(webhook.HeaderDelivery) != ping.ID || got.Get(webhook.HeaderSignature) == "" {
+		t.Fatalf("unexpected receiver headers: %v", got)
+	}
+	var deliveries WebhookDeliveries
+	do(http.MethodGet, "/api/webhooks/"+created.ID+"/deliveries", "", http.StatusOK, "/api/webhooks/{id}/deliveries", &deliveries)
+	if len(deliveries.Deliveries) != 1 || deliveries.Deliveries[0].ID != ping.ID {
+		t.Fatalf("unexpected deliveries: %+v", deliveries)
+	}
+
+	do(http.MethodDelete, "/api/webhooks/"+created.ID, "", http.StatusNoContent, "/api/webhooks/{id}", nil)
+	for _, path := range []string{"/api/webhooks/" + created.ID, "/api/webhooks/" + created.ID + "/deliveries"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assertProblem(t, w, http.StatusNotFound, "not_found")
+	}
+}
+
+func TestWebhook_InvalidRequests(t *testing.T) {
+	router := newWebhookRouter(t)
+	for body, code := range map[string]string{
+		`{bad`:                        "invalid_json",
+		`{"url":"/relative"}`:         "invalid_request",
+		`{"url":"ftp://example.com"}`: "invalid_request",
+		`{"url":"https://example.com","format":"xml"}`:          "invalid_request",
+		`{"url":"https://example.com","events":["deleted"]}`:    "invalid_request",
+		`{"url":"https://example.com","threshold_percent":101}`: "invalid_request",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/webhooks", bytes.NewBufferString(body)))
+		assertProblem(t, w, http.StatusBadRequest, code)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/webhooks/nope/deliveries?limit=0", nil))
+	assertProblem(t, w, http.StatusBadRequest, "invalid_request")
+}
+
+func TestWebhook_RefusesPrivateURLsAndLimitsCount(t *testing.T) {
+	cfg := testConfig()
+	cfg.WebhookAllowPrivate = false
+	cfg.WebhookMaxCount = 1
+	router := newWebhookRouterWith(t, cfg)
+	post := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/webhooks", bytes.NewBufferString(`{"url":"`+url+`"}`)))
+		return w
+	}
+	for _, url := range []string{"http://127.0.0.1:8080/", "http://localhost/", "http://169.254.169.254/latest", "http://192.168.1.1/"} {
+		assertProblem(t, post(url), http.StatusBadRequest, "invalid_request")
+	}
+	if w := post("https://192.0.2.10/hook"); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	assertProblem(t, post("https://192.0.2.11/hook"), http.StatusServiceUnavailable, "unavailable")
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/legertom/dnsprop/api/internal/config"
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+	"github.com/legertom/dnsprop/api/internal/problem"
+	"github.com/legertom/dnsprop/api/internal/ratelimit"
+)
+
+const (
+	wsMaxInFlight  = 4
+	wsMaxMessage   = 64 << 10
+	wsWriteWait    = 10 * time.Second
+	wsPongWait     = 60 * time.Second
+	wsPingInterval = 30 * time.Second
+)
+
+// WSCommand is a client message. Op is "resolve" (with the ResolveRequest fields) or "cancel".
+// ID is chosen by the client and tags every message about that request.
+type WSCommand struct {
+	Op string `json:"op"`
+	ID string `json:"id"`
+	ResolveRequest
+}
+
+// WSMessage is a server message. Event is "result", "done", "cancelled" or "error"; errors carry
+// the same stable codes as HTTP problem responses.
+type WSMessage struct {
+	Event   string         `json:"event"`
+	ID      string         `json:"id,omitempty"`
+	Result  *Result        `json:"result,omitempty"`
+	Summary *StreamSummary `json:"summary,omitempty"`
+	Error   string         `json:"error,omitempty"`
+	Code    string         `json:"code,omitempty"`
+}
+
+// WebSocketHandler upgrades to a WebSocket over which a client can issue many resolve commands
+// and receive each Result as it arrives. Every resolve command consumes a token from the same
+// per-IP limiter as HTTP requests.
+func WebSocketHandler(cfg *config.Config, cache resolver.Cache, limiter *ratelimit.Limiter) http.HandlerFunc {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: allowedOrigin(cfg.CorsOrigins),
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			problem.Error(w, r, status, reason)
+		},
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return // Upgrade has already replied with an HTTP error
+		}
+		ctx, cancel := context.WithCancel(r.Context())
+		s := &wsSession{
+			conn:     conn,
+			cfg:      cfg,
+			cache:    cache,
+			limiter:  limiter,
+			ip:       ratelimit.ClientIP(r),
+			inflight: make(map[string]*wsInflight),
+		}
+		s.serve(ctx)
+		cancel()
+		s.wg.Wait()
+		conn.Close()
+	}
+}
+
+type wsInflight struct {
+	cancel    context.CancelFunc
+	cancelled atomic.Bool
+}
+
+type wsSession struct {
+	conn    *websocket.Conn
+	cfg     *config.Config
+	cache   resolver.Cache
+	limiter *ratelimit.Limiter
+	ip      string
+
+	writeMu  sync.Mutex
+	mu       sync.Mutex
+	inflight map[string]*wsInflight
+	wg       sync.WaitGroup
+}
+
+// serve reads commands until the connection fails or ctx is cancelled.
+func (s *wsSession) serve(ctx context.Context) {
+	s.conn.SetReadLimit(wsMaxMessage)
+	s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(wsPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var cmd WSCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			s.send(WSMessage{Event: "error", Error: "invalid json", Code: problem.CodeInvalidJSON})
+			continue
+		}
+		switch cmd.Op {
+		case "resolve":
+			s.resolve(ctx, cmd)
+		case "cancel":
+			s.mu.Lock()
+			if f, ok := s.inflight[cmd.ID]; ok {
+				f.cancelled.Store(true)
+				f.cancel()
+			}
+			s.mu.Unlock()
+		default:
+			s.send(WSMessage{Event: "error", ID: cmd.ID, Error: "unknown op", Code: problem.CodeInvalidRequest})
+		}
+	}
+}
+
+func (s *wsSession) resolve(ctx context.Context, cmd WSCommand) {
+	if cmd.ID == "" {
+		s.send(WSMessage{Event: "error", Error: "id is required", Code: problem.CodeInvalidRequest})
+		return
+	}
+	servers, err := normalizeResolveRequest(s.cfg, &cmd.ResolveRequest)
+	if err != nil {
+		s.send(WSMessage{Event: "error", ID: cmd.ID, Error: err.Error(), Code: problem.CodeOf(err, problem.CodeInvalidRequest)})
+		return
+	}
+
+	s.mu.Lock()
+	if _, dup := s.inflight[cmd.ID]; dup {
+		s.mu.Unlock()
+		s.send(WSMessage{Event: "error", ID: cmd.ID, Error: "id already in flight", Code: problem.CodeInvalidRequest})
+		return
+	}
+	if len(s.inflight) >= wsMaxInFlight {
+		s.mu.Unlock()
+		s.send(WSMessage{Event: "error", ID: cmd.ID, Error: "too many requests in flight", Code: problem.CodeRateLimited})
+		return
+	}
+	if !s.limiter.Allow(s.ip) {
+		s.mu.Unlock()
+		s.send(WSMessage{Event: "error", ID: cmd.ID, Error: "rate limited", Code: problem.CodeRateLimited})
+		return
+	}
+	qctx, cancel := context.WithTimeout(ctx, s.cfg.RequestTimeout)
+	f := &wsInflight{cancel: cancel}
+	s.inflight[cmd.ID] = f
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			cancel()
+			s.mu.Lock()
+			delete(s.inflight, cmd.ID)
+			s.mu.Unlock()
+		}()
+
+		summary := streamResolve(qctx, s.cfg, s.cache, cmd.ResolveRequest, servers, func(rr resolver.Result) {
+			res := toResult(rr)
+			s.send(WSMessage{Event: "result", ID: cmd.ID, Result: &res})
+		})
+		if f.cancelled.Load() {
+			s.send(WSMessage{Event: "cancelled", ID: cmd.ID})
+			return
+		}
+		s.send(WSMessage{Event: "done", ID: cmd.ID, Summary: &summary})
+	}()
+}
+
+// send serializes writes; gorilla/websocket allows only one concurrent writer.
+func (s *wsSession) send(msg WSMessage) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	s.conn.WriteJSON(msg)
+}
+
+// allowedOrigin accepts requests without an Origin header (non-browser clients) and browser
+// origins listed in CORS_ORIGINS.
+func allowedOrigin(origins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, o := range origins {
+			if o == "*" || strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
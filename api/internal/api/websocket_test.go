@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialWS(t *testing.T, srv *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestWebSocket_StreamsTaggedResults(t *testing.T) {
+	srv := httptest.NewServer(newTestRouter(testConfig()))
+	defer srv.Close()
+	conn := dialWS(t, srv)
+
+	if err := conn.WriteJSON(WSCommand{Op: "resolve", ID: "q1", ResolveRequest: ResolveRequest{Name: "example.com", Type: "A", Servers: []string{"127.0.0.1", "127.0.0.2"}}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := conn.WriteJSON(WSCommand{Op: "resolve", ID: "bad", ResolveRequest: ResolveRequest{Name: "ex@mple.com", Type: "A"}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	results, sawError := 0, false
+	for {
+		var msg WSMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		switch {
+		case msg.Event == "error" && msg.ID == "bad":
+			sawError = true
+		case msg.Event == "result" && msg.ID == "q1":
+			results++
+		case msg.Event == "done" && msg.ID == "q1":
+			if results != 2 || msg.Summary == nil || msg.Summary.Total != 2 {
+				t.Fatalf("done after %d results, summary %+v", results, msg.Summary)
+			}
+			if !sawError {
+				t.Fatalf("expected validation error for id=bad before done")
+			}
+			return
+		default:
+			t.Fatalf("unexpected message %+v", msg)
+		}
+	}
+}
+
+func TestWebSocket_RateLimited(t *testing.T) {
+	cfg := testConfig()
+	cfg.RateLimitRPS = 0.001
+	cfg.RateLimitBurst = 2 // one token for the upgrade request, one for the first command
+	srv := httptest.NewServer(newTestRouter(cfg))
+	defer srv.Close()
+	conn := dialWS(t, srv)
+
+	cmd := WSCommand{Op: "resolve", ResolveRequest: ResolveRequest{Name: "example.com", Type: "A", Servers: []string{"127.0.0.1"}}}
+	cmd.ID = "first"
+	conn.WriteJSON(cmd)
+	for {
+		var msg WSMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if msg.Event == "done" {
+			break
+		}
+	}
+	cmd.ID = "second"
+	conn.WriteJSON(cmd)
+	var msg WSMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if msg.Event != "error" || msg.ID != "second" || msg.Error != "rate limited" {
+		t.Fatalf("expected rate limited error, got %+v", msg)
+	}
+}
@@ -1,41 +1,152 @@
 package cache
 
 import (
+	"container/heap"
+	"container/list"
+	"errors"
+	"sync"
 	"time"
 
-	expirable "github.com/hashicorp/golang-lru/v2/expirable"
 	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
 )
 
-// LRUCache implements dnsresolver.Cache using an expirable LRU.
-// It is safe for concurrent use.
+// LRUCache implements dnsresolver.Cache with a bounded LRU whose entries each expire at their own
+// TTL, capped at maxTTL. Expired entries are dropped before any live entry is evicted to make
+// room, so stale results never take up capacity. It is safe for concurrent use.
 type LRUCache struct {
-	l *expirable.LRU[string, resolver.Result]
-	// defaultTTL is used only if a caller passes ttl<=0; callers should normally pass a per-entry ttl.
-	defaultTTL time.Duration
+	maxEntries int
+	maxTTL     time.Duration
+	now        func() time.Time // replaced in tests
+
+	mu      sync.Mutex
+	order   *list.List // most recently used first; values are *entry
+	entries map[string]*list.Element
+	expiry  expiryHeap
+}
+
+type entry struct {
+	key     string
+	val     resolver.Result
+	expires time.Time
+	index   int // position in expiry
 }
 
-func NewLRU(maxEntries int, defaultTTL time.Duration) (*LRUCache, error) {
-	lru := expirable.NewLRU[string, resolver.Result](maxEntries, nil, defaultTTL)
-	return &LRUCache{l: lru, defaultTTL: defaultTTL}, nil
+// NewLRU returns a cache holding at most maxEntries results for at most maxTTL each.
+func NewLRU(maxEntries int, maxTTL time.Duration) (*LRUCache, error) {
+	if maxEntries <= 0 {
+		return nil, errors.New("cache: maxEntries must be > 0")
+	}
+	if maxTTL <= 0 {
+		return nil, errors.New("cache: maxTTL must be > 0")
+	}
+	return &LRUCache{
+		maxEntries: maxEntries,
+		maxTTL:     maxTTL,
+		now:        time.Now,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}, nil
 }
 
+// Get returns the result stored under key unless it has expired.
 func (c *LRUCache) Get(key string) (resolver.Result, bool) {
-	if c == nil || c.l == nil {
+	if c == nil {
+		return resolver.Result{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
 		return resolver.Result{}, false
 	}
-	v, ok := c.l.Get(key)
-	return v, ok
+	e := el.Value.(*entry)
+	if !c.now().Before(e.expires) {
+		c.remove(el)
+		return resolver.Result{}, false
+	}
+	c.order.MoveToFront(el)
+	return e.val, true
 }
 
+// Add stores val under key for ttl, capped at the cache's maxTTL. A ttl <= 0 (e.g. a DNS TTL of
+// 0) means the result must not be reused, so it is not stored and any older entry is dropped.
 func (c *LRUCache) Add(key string, val resolver.Result, ttl time.Duration) {
-	if c == nil || c.l == nil {
+	if c == nil {
+		return
+	}
+	if ttl > c.maxTTL {
+		ttl = c.maxTTL
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if el, ok := c.entries[key]; ok {
+		if ttl <= 0 {
+			c.remove(el)
+			return
+		}
+		e := el.Value.(*entry)
+		e.val, e.expires = val, now.Add(ttl)
+		heap.Fix(&c.expiry, e.index)
+		c.order.MoveToFront(el)
 		return
 	}
 	if ttl <= 0 {
-		ttl = c.defaultTTL
+		return
+	}
+	c.purgeExpired(now)
+	if c.order.Len() >= c.maxEntries {
+		c.remove(c.order.Back())
 	}
-	// Library uses default TTL per cache; per-entry TTL is enforced by resolver when reading.
-	_ = ttl
-	c.l.Add(key, val)
+	e := &entry{key: key, val: val, expires: now.Add(ttl)}
+	c.entries[key] = c.order.PushFront(e)
+	heap.Push(&c.expiry, e)
+}
+
+// Len returns the number of unexpired entries.
+func (c *LRUCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.purgeExpired(c.now())
+	return c.order.Len()
+}
+
+// purgeExpired drops every entry that has expired by now, soonest first.
+func (c *LRUCache) purgeExpired(now time.Time) {
+	for len(c.expiry) > 0 && !now.Before(c.expiry[0].expires) {
+		c.remove(c.entries[c.expiry[0].key])
+	}
+}
+
+func (c *LRUCache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*entry)
+	delete(c.entries, e.key)
+	heap.Remove(&c.expiry, e.index)
+}
+
+// expiryHeap orders entries by expiry, soonest first.
+type expiryHeap []*entry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *expiryHeap) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
 }
@@ -9,7 +9,9 @@ import (
 
 func TestLRU_AddGet(t *testing.T) {
 	c, err := NewLRU(10, time.Minute)
-	if err != nil { t.Fatalf("NewLRU: %v", err) }
+	if err != nil {
+		t.Fatalf("NewLRU: %v", err)
+	}
 	key := "k|example.com|A|dnssec=0"
 	val := resolver.Result{Server: "8.8.8.8"}
 	c.Add(key, val, 10*time.Second)
@@ -20,11 +22,106 @@ func TestLRU_AddGet(t *testing.T) {
 
 func TestLRU_Expiry(t *testing.T) {
 	c, err := NewLRU(10, 20*time.Millisecond)
-	if err != nil { t.Fatalf("NewLRU: %v", err) }
+	if err != nil {
+		t.Fatalf("NewLRU: %v", err)
+	}
 	key := "k|example.com|A|dnssec=0"
 	c.Add(key, resolver.Result{Server: "1.1.1.1"}, 5*time.Millisecond)
 	time.Sleep(35 * time.Millisecond)
 	if _, ok := c.Get(key); ok {
 		t.Fatalf("expected entry to expire")
 	}
-}
\ No newline at end of file
+}
+
+// fakeClock is a settable clock for expiry tests.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLRU(t *testing.T, maxEntries int, maxTTL time.Duration) (*LRUCache, *fakeClock) {
+	t.Helper()
+	c, err := NewLRU(maxEntries, maxTTL)
+	if err != nil {
+		t.Fatalf("NewLRU: %v", err)
+	}
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c.now = clock.Now
+	return c, clock
+}
+
+func TestLRU_PerEntryTTL(t *testing.T) {
+	c, clock := newTestLRU(t, 10, time.Minute)
+	c.Add("short", resolver.Result{Server: "1.1.1.1"}, 5*time.Second)
+	c.Add("long", resolver.Result{Server: "8.8.8.8"}, 30*time.Second)
+	c.Add("capped", resolver.Result{Server: "9.9.9.9"}, time.Hour)
+	c.Add("zero", resolver.Result{Server: "4.2.2.1"}, 0)
+	if _, ok := c.Get("zero"); ok || c.Len() != 3 {
+		t.Fatalf("expected a zero TTL not to be stored, len=%d", c.Len())
+	}
+
+	clock.Advance(5 * time.Second)
+	if _, ok := c.Get("short"); ok {
+		t.Fatal("expected the 5s entry to expire at 5s")
+	}
+	if _, ok := c.Get("long"); !ok {
+		t.Fatal("expected the 30s entry to live at 5s")
+	}
+	clock.Advance(25 * time.Second)
+	if _, ok := c.Get("long"); ok {
+		t.Fatal("expected the 30s entry to expire at 30s")
+	}
+	if _, ok := c.Get("capped"); !ok {
+		t.Fatal("expected the capped entry to live at 30s")
+	}
+	clock.Advance(30 * time.Second)
+	if _, ok := c.Get("capped"); ok || c.Len() != 0 {
+		t.Fatalf("expected a 1h TTL to be capped at the 1m maximum, len=%d", c.Len())
+	}
+}
+
+func TestLRU_ReAddResetsTTL(t *testing.T) {
+	c, clock := newTestLRU(t, 10, time.Minute)
+	c.Add("k", resolver.Result{Server: "old"}, 10*time.Second)
+	clock.Advance(8 * time.Second)
+	c.Add("k", resolver.Result{Server: "new"}, 10*time.Second)
+	clock.Advance(8 * time.Second)
+	if got, ok := c.Get("k"); !ok || got.Server != "new" {
+		t.Fatalf("expected the re-added entry, ok=%v val=%+v", ok, got)
+	}
+	c.Add("k", resolver.Result{Server: "gone"}, 0)
+	if _, ok := c.Get("k"); ok {
+		t.Fatal("expected a zero TTL to drop the entry")
+	}
+}
+
+func TestLRU_ExpiredEntriesDoNotTakeCapacity(t *testing.T) {
+	c, clock := newTestLRU(t, 3, time.Minute)
+	c.Add("a", resolver.Result{Server: "a"}, time.Minute)
+	c.Add("b", resolver.Result{Server: "b"}, time.Second)
+	c.Add("c", resolver.Result{Server: "c"}, time.Second)
+	c.Get("b") // b and c are now more recently used than a
+	c.Get("c")
+	clock.Advance(time.Second)
+
+	// Both expired entries make room before the least recently used live entry is evicted.
+	c.Add("d", resolver.Result{Server: "d"}, time.Minute)
+	c.Add("e", resolver.Result{Server: "e"}, time.Minute)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("expected the live entry to survive while expired ones were dropped")
+	}
+	if c.Len() != 3 {
+		t.Fatalf("expected 3 live entries, got %d", c.Len())
+	}
+
+	// With no expired entries left, the least recently used one goes.
+	c.Add("f", resolver.Result{Server: "f"}, time.Minute)
+	if _, ok := c.Get("d"); ok {
+		t.Fatal("expected the least recently used entry to be evicted")
+	}
+	for _, k := range []string{"a", "e", "f"} {
+		if _, ok := c.Get(k); !ok {
+			t.Fatalf("expected %s to be cached", k)
+		}
+	}
+}
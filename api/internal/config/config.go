@@ -10,6 +10,7 @@ import (
 
 type Config struct {
 	Port            string
+	GRPCPort        string // empty disables the gRPC listener
 	LogLevel        string
 	CorsOrigins     []string
 	Resolvers       []string
@@ -20,11 +21,56 @@ type Config struct {
 	RateLimitRPS    float64
 	RateLimitBurst  int
 	RateLimitTTL    time.Duration
+	CheckTimeout    time.Duration
+	// Watch jobs
+	WatchMaxJobs     int
+	WatchMinInterval time.Duration
+	WatchMaxDuration time.Duration
+	// Batch resolve
+	BatchMaxItems    int
+	BatchConcurrency int
+	BatchTimeout     time.Duration
+	// Per-IP budget of upstream queries (items x servers) for batch requests
+	BatchQueryRPS   float64
+	BatchQueryBurst int
+	// History is stored in this SQLite file; empty disables history
+	HistoryDB string
+	// Stored checks (and their permalinks) are deleted after this long
+	CheckExpiry time.Duration
+	// Scheduled monitors; they are stored alongside history and disabled with it
+	MonitorMaxCount    int
+	MonitorMinInterval time.Duration
+	// Monitor results are kept raw for ResultRetention, then as hourly rollups until
+	// HourlyRetention and as daily rollups until DailyRetention; compaction runs every
+	// CompactInterval
+	ResultRetention time.Duration
+	HourlyRetention time.Duration
+	DailyRetention  time.Duration
+	CompactInterval time.Duration
+	// Webhook deliveries for monitor changes
+	WebhookMaxAttempts  int
+	WebhookRetryBackoff time.Duration
+	WebhookTimeout      time.Duration
+	WebhookMaxCount     int
+	// Allow webhooks to loopback and private addresses (trusted networks only)
+	WebhookAllowPrivate bool
+	// Email alerts and digests; an empty SMTPHost disables email
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPStartTLS bool
+	SMTPFrom     string
+	SMTPTo       []string
+	SMTPTimeout  time.Duration
+	// Daily digest time of day as HH:MM in UTC; empty disables the digest
+	DigestTime string
 }
 
 func Load() (*Config, error) {
 	cfg := &Config{}
 	cfg.Port = getenv("PORT", "8080")
+	cfg.GRPCPort = getenv("GRPC_PORT", "")
 	cfg.LogLevel = getenv("LOG_LEVEL", "info")
 	cfg.CorsOrigins = splitAndTrim(getenv("CORS_ORIGINS", "http://localhost:5173"), ",")
 	cfg.Resolvers = splitAndTrim(getenv("RESOLVERS", "1.1.1.1,1.0.0.1,8.8.8.8,8.8.4.4,9.9.9.9,149.112.112.112,208.67.222.222,208.67.220.220,156.154.70.1,156.154.71.1,4.2.2.1,4.2.2.2,76.76.2.0,76.76.10.0,94.140.14.14,94.140.15.15,185.228.168.9,185.228.169.9,77.88.8.8,77.88.8.1,114.114.114.114,114.114.115.115,223.5.5.5,223.6.6.6,119.29.29.29,168.95.1.1,168.95.192.1,1.1.1.2,1.0.0.2,200.221.11.100"), ",")
@@ -65,6 +111,150 @@ func Load() (*Config, error) {
 		cfg.RateLimitTTL = 10 * time.Minute
 	}
 
+	// Overall deadline for multi-step diagnostics such as the delegation check
+	if d, err := time.ParseDuration(getenv("CHECK_TIMEOUT", "10s")); err == nil {
+		cfg.CheckTimeout = d
+	} else {
+		cfg.CheckTimeout = 10 * time.Second
+	}
+
+	// Watch jobs
+	cfg.WatchMaxJobs = 100
+	if v := getenv("WATCH_MAX_JOBS", ""); v != "" {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.WatchMaxJobs = n
+		}
+	}
+	if d, err := time.ParseDuration(getenv("WATCH_MIN_INTERVAL", "10s")); err == nil {
+		cfg.WatchMinInterval = d
+	} else {
+		cfg.WatchMinInterval = 10 * time.Second
+	}
+	if d, err := time.ParseDuration(getenv("WATCH_MAX_DURATION", "1h")); err == nil {
+		cfg.WatchMaxDuration = d
+	} else {
+		cfg.WatchMaxDuration = time.Hour
+	}
+
+	// Batch resolve; the concurrency budget is shared by all batch requests in flight
+	cfg.BatchMaxItems = 100
+	if v := getenv("BATCH_MAX_ITEMS", ""); v != "" {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.BatchMaxItems = n
+		}
+	}
+	cfg.BatchConcurrency = 50
+	if v := getenv("BATCH_CONCURRENCY", ""); v != "" {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.BatchConcurrency = n
+		}
+	}
+	if d, err := time.ParseDuration(getenv("BATCH_TIMEOUT", "20s")); err == nil {
+		cfg.BatchTimeout = d
+	} else {
+		cfg.BatchTimeout = 20 * time.Second
+	}
+	// The default burst fits a full batch against the default pool (100 items x 30 resolvers)
+	cfg.BatchQueryRPS = 50
+	if v := getenv("BATCH_QUERY_RPS", ""); v != "" {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && f > 0 {
+			cfg.BatchQueryRPS = f
+		}
+	}
+	cfg.BatchQueryBurst = 3000
+	if v := getenv("BATCH_QUERY_BURST", ""); v != "" {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.BatchQueryBurst = n
+		}
+	}
+
+	cfg.HistoryDB = strings.TrimSpace(getenv("HISTORY_DB", "dnsprop.db"))
+	if d, err := time.ParseDuration(getenv("CHECK_EXPIRY", "720h")); err == nil {
+		cfg.CheckExpiry = d
+	} else {
+		cfg.CheckExpiry = 720 * time.Hour
+	}
+
+	// Monitors
+	cfg.MonitorMaxCount = 100
+	if v := getenv("MONITOR_MAX_COUNT", ""); v != "" {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.MonitorMaxCount = n
+		}
+	}
+	if d, err := time.ParseDuration(getenv("MONITOR_MIN_INTERVAL", "1m")); err == nil {
+		cfg.MonitorMinInterval = d
+	} else {
+		cfg.MonitorMinInterval = time.Minute
+	}
+
+	// Result retention
+	if d, err := time.ParseDuration(getenv("RESULT_RETENTION", "168h")); err == nil {
+		cfg.ResultRetention = d
+	} else {
+		cfg.ResultRetention = 168 * time.Hour
+	}
+	if d, err := time.ParseDuration(getenv("HOURLY_RETENTION", "2160h")); err == nil {
+		cfg.HourlyRetention = d
+	} else {
+		cfg.HourlyRetention = 2160 * time.Hour
+	}
+	if d, err := time.ParseDuration(getenv("DAILY_RETENTION", "8760h")); err == nil {
+		cfg.DailyRetention = d
+	} else {
+		cfg.DailyRetention = 8760 * time.Hour
+	}
+	if d, err := time.ParseDuration(getenv("COMPACT_INTERVAL", "1h")); err == nil {
+		cfg.CompactInterval = d
+	} else {
+		cfg.CompactInterval = time.Hour
+	}
+
+	// Webhooks; the wait between attempts doubles after each retry
+	cfg.WebhookMaxAttempts = 5
+	if v := getenv("WEBHOOK_MAX_ATTEMPTS", ""); v != "" {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.WebhookMaxAttempts = n
+		}
+	}
+	if d, err := time.ParseDuration(getenv("WEBHOOK_RETRY_BACKOFF", "2s")); err == nil {
+		cfg.WebhookRetryBackoff = d
+	} else {
+		cfg.WebhookRetryBackoff = 2 * time.Second
+	}
+	if d, err := time.ParseDuration(getenv("WEBHOOK_TIMEOUT", "10s")); err == nil {
+		cfg.WebhookTimeout = d
+	} else {
+		cfg.WebhookTimeout = 10 * time.Second
+	}
+	cfg.WebhookMaxCount = 50
+	if v := getenv("WEBHOOK_MAX_COUNT", ""); v != "" {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.WebhookMaxCount = n
+		}
+	}
+	cfg.WebhookAllowPrivate = strings.EqualFold(getenv("WEBHOOK_ALLOW_PRIVATE", "false"), "true")
+
+	// Email
+	cfg.SMTPHost = strings.TrimSpace(getenv("SMTP_HOST", ""))
+	cfg.SMTPPort = 587
+	if v := getenv("SMTP_PORT", ""); v != "" {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.SMTPPort = n
+		}
+	}
+	cfg.SMTPUsername = getenv("SMTP_USERNAME", "")
+	cfg.SMTPPassword = getenv("SMTP_PASSWORD", "")
+	cfg.SMTPStartTLS = !strings.EqualFold(getenv("SMTP_STARTTLS", "true"), "false")
+	cfg.SMTPFrom = strings.TrimSpace(getenv("SMTP_FROM", ""))
+	cfg.SMTPTo = splitAndTrim(getenv("SMTP_TO", ""), ",")
+	if d, err := time.ParseDuration(getenv("SMTP_TIMEOUT", "10s")); err == nil {
+		cfg.SMTPTimeout = d
+	} else {
+		cfg.SMTPTimeout = 10 * time.Second
+	}
+	cfg.DigestTime = strings.TrimSpace(getenv("DIGEST_TIME", "08:00"))
+
 	return cfg, nil
 }
 
@@ -94,6 +284,78 @@ func (c *Config) Validate() error {
 	if c.RateLimitTTL <= 0 {
 		return fmt.Errorf("RATE_LIMIT_TTL must be > 0")
 	}
+	if c.CheckTimeout <= 0 {
+		return fmt.Errorf("CHECK_TIMEOUT must be > 0")
+	}
+	if c.WatchMaxJobs <= 0 {
+		return fmt.Errorf("WATCH_MAX_JOBS must be > 0")
+	}
+	if c.WatchMinInterval <= 0 {
+		return fmt.Errorf("WATCH_MIN_INTERVAL must be > 0")
+	}
+	if c.WatchMaxDuration <= 0 {
+		return fmt.Errorf("WATCH_MAX_DURATION must be > 0")
+	}
+	if c.BatchMaxItems <= 0 {
+		return fmt.Errorf("BATCH_MAX_ITEMS must be > 0")
+	}
+	if c.BatchConcurrency <= 0 {
+		return fmt.Errorf("BATCH_CONCURRENCY must be > 0")
+	}
+	if c.BatchTimeout <= 0 {
+		return fmt.Errorf("BATCH_TIMEOUT must be > 0")
+	}
+	if c.BatchQueryRPS <= 0 {
+		return fmt.Errorf("BATCH_QUERY_RPS must be > 0")
+	}
+	if c.BatchQueryBurst <= 0 {
+		return fmt.Errorf("BATCH_QUERY_BURST must be > 0")
+	}
+	if c.CheckExpiry <= 0 {
+		return fmt.Errorf("CHECK_EXPIRY must be > 0")
+	}
+	if c.MonitorMaxCount <= 0 {
+		return fmt.Errorf("MONITOR_MAX_COUNT must be > 0")
+	}
+	if c.MonitorMinInterval <= 0 {
+		return fmt.Errorf("MONITOR_MIN_INTERVAL must be > 0")
+	}
+	// The daily digest reads the last day of raw results
+	if c.ResultRetention < 24*time.Hour {
+		return fmt.Errorf("RESULT_RETENTION must be at least 24h")
+	}
+	if c.HourlyRetention < c.ResultRetention {
+		return fmt.Errorf("HOURLY_RETENTION must be at least RESULT_RETENTION")
+	}
+	if c.DailyRetention < c.HourlyRetention {
+		return fmt.Errorf("DAILY_RETENTION must be at least HOURLY_RETENTION")
+	}
+	if c.CompactInterval <= 0 {
+		return fmt.Errorf("COMPACT_INTERVAL must be > 0")
+	}
+	if c.WebhookMaxAttempts <= 0 {
+		return fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be > 0")
+	}
+	if c.WebhookRetryBackoff <= 0 {
+		return fmt.Errorf("WEBHOOK_RETRY_BACKOFF must be > 0")
+	}
+	if c.WebhookTimeout <= 0 {
+		return fmt.Errorf("WEBHOOK_TIMEOUT must be > 0")
+	}
+	if c.WebhookMaxCount <= 0 {
+		return fmt.Errorf("WEBHOOK_MAX_COUNT must be > 0")
+	}
+	if c.SMTPTimeout <= 0 {
+		return fmt.Errorf("SMTP_TIMEOUT must be > 0")
+	}
+	if c.SMTPHost != "" && (c.SMTPFrom == "" || len(c.SMTPTo) == 0) {
+		return fmt.Errorf("SMTP_FROM and SMTP_TO must be set when SMTP_HOST is")
+	}
+	if c.DigestTime != "" {
+		if _, err := time.Parse("15:04", c.DigestTime); err != nil {
+			return fmt.Errorf("DIGEST_TIME must be HH:MM")
+		}
+	}
 	return nil
 }
 
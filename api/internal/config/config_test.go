@@ -26,19 +26,59 @@ func TestValidate_Errors(t *testing.T) {
 
 func TestValidate_OK(t *testing.T) {
 	c := &Config{
-		Port:            "8080",
-		LogLevel:        "info",
-		CorsOrigins:     []string{"http://localhost"},
-		Resolvers:       []string{"1.1.1.1", "8.8.8.8"},
-		RequestTimeout:  time.Second,
-		EnableDNSSEC:    false,
-		CacheTTL:        time.Second,
-		CacheMaxEntries: 10,
-		RateLimitRPS:    1,
-		RateLimitBurst:  1,
-		RateLimitTTL:    time.Minute,
+		Port:                "8080",
+		LogLevel:            "info",
+		CorsOrigins:         []string{"http://localhost"},
+		Resolvers:           []string{"1.1.1.1", "8.8.8.8"},
+		RequestTimeout:      time.Second,
+		EnableDNSSEC:        false,
+		CacheTTL:            time.Second,
+		CacheMaxEntries:     10,
+		RateLimitRPS:        1,
+		RateLimitBurst:      1,
+		RateLimitTTL:        time.Minute,
+		CheckTimeout:        time.Second,
+		WatchMaxJobs:        1,
+		WatchMinInterval:    time.Second,
+		WatchMaxDuration:    time.Minute,
+		BatchMaxItems:       10,
+		BatchConcurrency:    10,
+		BatchTimeout:        time.Second,
+		BatchQueryRPS:       10,
+		BatchQueryBurst:     100,
+		CheckExpiry:         time.Hour,
+		MonitorMaxCount:     10,
+		MonitorMinInterval:  time.Second,
+		ResultRetention:     24 * time.Hour,
+		HourlyRetention:     48 * time.Hour,
+		DailyRetention:      72 * time.Hour,
+		CompactInterval:     time.Hour,
+		WebhookMaxAttempts:  1,
+		WebhookRetryBackoff: time.Second,
+		WebhookTimeout:      time.Second,
+		WebhookMaxCount:     10,
+		SMTPTimeout:         time.Second,
 	}
 	if err := c.Validate(); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-}
\ No newline at end of file
+
+	c.SMTPHost = "smtp.example.com"
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected an error for SMTP_HOST without SMTP_FROM and SMTP_TO")
+	}
+	c.SMTPFrom, c.SMTPTo, c.DigestTime = "dnsprop@example.com", []string{"ops@example.com"}, "08:30"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.DigestTime = "25:00"
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected an error for an invalid DIGEST_TIME")
+	}
+	c.DigestTime = ""
+
+	c.HourlyRetention = 12 * time.Hour
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected an error for HOURLY_RETENTION shorter than RESULT_RETENTION")
+	}
+}
@@ -0,0 +1,177 @@
+package dnsresolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// exchange sends a single query to addr and returns the reply. It is a variable so tests
+// can substitute an in-memory responder for the network.
+var exchange = udpExchange
+
+// udpExchange queries over UDP and retries over TCP when the reply is truncated.
+func udpExchange(ctx context.Context, m *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+	client := &dns.Client{Net: "udp", Timeout: timeout}
+	r, rtt, err := client.ExchangeContext(ctx, m, addr)
+	if err != nil {
+		return nil, rtt, err
+	}
+	if r != nil && r.Truncated {
+		clientTCP := &dns.Client{Net: "tcp", Timeout: timeout}
+		r2, rtt2, err2 := clientTCP.ExchangeContext(ctx, m, addr)
+		if err2 == nil && r2 != nil {
+			return r2, rtt2, nil
+		}
+	}
+	return r, rtt, nil
+}
+
+// serverAddr returns host:port for a server, defaulting to port 53.
+func serverAddr(server string) string {
+	if !strings.Contains(server, ":") || net.ParseIP(server) != nil { // bare IPv6 addresses contain ':' too
+		return net.JoinHostPort(server, "53")
+	}
+	return server
+}
+
+// queryTimeout shortens perQueryTimeout to the time left on ctx, if any.
+func queryTimeout(ctx context.Context, perQueryTimeout time.Duration) time.Duration {
+	timeout := perQueryTimeout
+	if dl, ok := ctx.Deadline(); ok {
+		rem := time.Until(dl)
+		if rem > 0 && rem < timeout {
+			timeout = rem
+		}
+	}
+	return timeout
+}
+
+var errNoRecursiveAnswer = errors.New("no recursive resolver answered")
+
+// recursiveQuery asks the recursive resolvers in order and returns the first NOERROR or NXDOMAIN reply.
+// At most three resolvers are tried so a dead pool fails fast.
+func recursiveQuery(ctx context.Context, recursive []string, name string, qtype uint16, timeout time.Duration) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.RecursionDesired = true
+	m.SetEdns0(1232, false)
+
+	tried := 0
+	for _, server := range recursive {
+		if tried == 3 || ctx.Err() != nil {
+			break
+		}
+		tried++
+		r, _, err := exchange(ctx, m, serverAddr(server), queryTimeout(ctx, timeout))
+		if err != nil || r == nil {
+			continue
+		}
+		if r.Rcode == dns.RcodeSuccess || r.Rcode == dns.RcodeNameError {
+			return r, nil
+		}
+	}
+	return nil, errNoRecursiveAnswer
+}
+
+// authoritativeQuery sends a non-recursive query directly to a nameserver address.
+func authoritativeQuery(ctx context.Context, addr, name string, qtype uint16, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.RecursionDesired = false
+	m.SetEdns0(1232, false)
+	return exchange(ctx, m, serverAddr(addr), queryTimeout(ctx, timeout))
+}
+
+// findZone returns the apex of the zone containing name, using the owner of the SOA record
+// returned by a recursive resolver in either the answer or authority section.
+func findZone(ctx context.Context, recursive []string, name string, timeout time.Duration) (string, error) {
+	r, err := recursiveQuery(ctx, recursive, name, dns.TypeSOA, timeout)
+	if err != nil {
+		return "", err
+	}
+	for _, rr := range append(r.Answer, r.Ns...) {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return strings.ToLower(soa.Hdr.Name), nil
+		}
+	}
+	return "", errors.New("no SOA found for " + name)
+}
+
+// lookupNS returns the sorted, lower-cased NS host names for zone via the recursive resolvers.
+func lookupNS(ctx context.Context, recursive []string, zone string, timeout time.Duration) ([]string, error) {
+	r, err := recursiveQuery(ctx, recursive, zone, dns.TypeNS, timeout)
+	if err != nil {
+		return nil, err
+	}
+	hosts := nsHosts(r.Answer, zone)
+	if len(hosts) == 0 {
+		return nil, errors.New("no NS records for " + zone)
+	}
+	return hosts, nil
+}
+
+// lookupAddrs resolves host to its IPv4 and IPv6 addresses via the recursive resolvers.
+func lookupAddrs(ctx context.Context, recursive []string, host string, timeout time.Duration) []string {
+	var out []string
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		r, err := recursiveQuery(ctx, recursive, host, qtype, timeout)
+		if err != nil {
+			continue
+		}
+		out = append(out, addrsFor(r.Answer, host)...)
+	}
+	return out
+}
+
+// nsHosts extracts NS targets owned by zone from rrs.
+func nsHosts(rrs []dns.RR, zone string) []string {
+	seen := map[string]struct{}{}
+	var out []string
+	for _, rr := range rrs {
+		ns, ok := rr.(*dns.NS)
+		if !ok || !strings.EqualFold(ns.Hdr.Name, zone) {
+			continue
+		}
+		host := strings.ToLower(ns.Ns)
+		if _, dup := seen[host]; dup {
+			continue
+		}
+		seen[host] = struct{}{}
+		out = append(out, host)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// addrsFor extracts A/AAAA addresses owned by host from rrs, sorted for stable comparison.
+func addrsFor(rrs []dns.RR, host string) []string {
+	var out []string
+	for _, rr := range rrs {
+		if !strings.EqualFold(rr.Header().Name, host) {
+			continue
+		}
+		switch v := rr.(type) {
+		case *dns.A:
+			out = append(out, v.A.String())
+		case *dns.AAAA:
+			out = append(out, v.AAAA.String())
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// parentZone strips the leftmost label from a fully qualified name.
+func parentZone(zone string) string {
+	labels := dns.SplitDomainName(zone)
+	if len(labels) <= 1 {
+		return "."
+	}
+	return dns.Fqdn(strings.Join(labels[1:], "."))
+}
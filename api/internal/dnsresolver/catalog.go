@@ -0,0 +1,175 @@
+package dnsresolver
+
+import (
+	"container/list"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// healthWindow is how many recent queries per server the health tracker keeps.
+const healthWindow = 50
+
+// healthServers is how many servers the health tracker keeps. Clients can query any server, so
+// the least recently queried ones are dropped beyond this.
+const healthServers = 256
+
+// Address families reported in ResolverInfo.
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// providerTransports lists the encrypted transports providers advertise in addition to plain
+// DNS. Queries from this service always use UDP with TCP fallback.
+var providerTransports = map[string][]string{
+	"Cloudflare":    {"dot", "doh"},
+	"Google":        {"dot", "doh"},
+	"Quad9":         {"dot", "doh"},
+	"OpenDNS":       {"doh"},
+	"AdGuard":       {"dot", "doh", "doq"},
+	"CleanBrowsing": {"dot", "doh"},
+	"ControlD":      {"dot", "doh", "doq"},
+	"Alibaba DNS":   {"dot", "doh"},
+	"DNSPod":        {"dot", "doh"},
+}
+
+// ResolverInfo describes a resolver and how it has behaved recently.
+type ResolverInfo struct {
+	Address    string        `json:"address"`
+	Provider   string        `json:"provider,omitempty"`
+	City       string        `json:"city,omitempty"`
+	Label      string        `json:"label,omitempty"`
+	Latitude   float64       `json:"latitude"`
+	Longitude  float64       `json:"longitude"`
+	Family     string        `json:"family"`
+	Transports []string      `json:"transports"`
+	Health     *ServerHealth `json:"health,omitempty"`
+}
+
+// ServerHealth summarizes the last queries sent to a server.
+type ServerHealth struct {
+	Queries     int     `json:"queries"`
+	Responded   int     `json:"responded"`
+	Timeouts    int     `json:"timeouts"`
+	Errors      int     `json:"errors"`
+	SuccessRate float64 `json:"success_rate"`
+	MeanRTTMs   float64 `json:"mean_rtt_ms"`
+	LastStatus  string  `json:"last_status"`
+	LastSeen    string  `json:"last_seen"`
+}
+
+// Catalog describes each server, including recent health for servers that have been queried.
+func Catalog(servers []string) []ResolverInfo {
+	out := make([]ResolverInfo, 0, len(servers))
+	for _, s := range servers {
+		out = append(out, Describe(s))
+	}
+	return out
+}
+
+// Describe returns the static metadata and recent health for one server.
+func Describe(server string) ResolverInfo {
+	host := normalizeServer(server)
+	info := ResolverInfo{Address: server, Family: FamilyIPv4, Transports: []string{"udp", "tcp"}}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		info.Family = FamilyIPv6
+	}
+	if label, ok := defaultRegions[host]; ok {
+		info.Label = label
+		// Labels are "City, Region, Provider"; the provider is always the last part.
+		if i := strings.LastIndex(label, ","); i >= 0 {
+			info.City = strings.TrimSpace(label[:i])
+			info.Provider = strings.TrimSpace(label[i+1:])
+		}
+	}
+	info.Latitude, info.Longitude = coordinatesFor(server)
+	info.Transports = append(info.Transports, providerTransports[info.Provider]...)
+	info.Health = recentHealth.get(host)
+	return info
+}
+
+// healthTracker keeps a fixed window of recent outcomes for up to maxServers servers.
+type healthTracker struct {
+	maxServers int
+
+	mu      sync.Mutex
+	servers map[string]*healthRing
+	order   *list.List // most recently recorded first; values are hosts
+}
+
+type healthSample struct {
+	status string
+	rttMs  float64
+	at     time.Time
+}
+
+type healthRing struct {
+	samples []healthSample
+	next    int
+	el      *list.Element
+}
+
+// recentHealth records every live (non-cached) query made through Resolve and ResolveStream.
+var recentHealth = newHealthTracker(healthServers)
+
+func newHealthTracker(maxServers int) *healthTracker {
+	return &healthTracker{maxServers: maxServers, servers: make(map[string]*healthRing), order: list.New()}
+}
+
+func (t *healthTracker) record(r Result) {
+	host := normalizeServer(r.Server)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ring, ok := t.servers[host]
+	if ok {
+		t.order.MoveToFront(ring.el)
+	} else {
+		if t.order.Len() >= t.maxServers {
+			delete(t.servers, t.order.Remove(t.order.Back()).(string))
+		}
+		ring = &healthRing{samples: make([]healthSample, 0, healthWindow), el: t.order.PushFront(host)}
+		t.servers[host] = ring
+	}
+	s := healthSample{status: r.Status, rttMs: r.RTTMs, at: r.QueriedAt}
+	if len(ring.samples) < healthWindow {
+		ring.samples = append(ring.samples, s)
+	} else {
+		ring.samples[ring.next] = s
+	}
+	ring.next = (ring.next + 1) % healthWindow
+}
+
+func (t *healthTracker) get(host string) *ServerHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ring, ok := t.servers[host]
+	if !ok || len(ring.samples) == 0 {
+		return nil
+	}
+	h := &ServerHealth{Queries: len(ring.samples)}
+	var rttSum float64
+	var last healthSample
+	for _, s := range ring.samples {
+		switch s.status {
+		case "timeout":
+			h.Timeouts++
+		case "error":
+			h.Errors++
+		default:
+			h.Responded++
+			rttSum += s.rttMs
+		}
+		if s.at.After(last.at) {
+			last = s
+		}
+	}
+	h.SuccessRate = float64(h.Responded) / float64(h.Queries)
+	if h.Responded > 0 {
+		h.MeanRTTMs = rttSum / float64(h.Responded)
+	}
+	h.LastStatus = last.status
+	h.LastSeen = last.at.UTC().Format(time.RFC3339)
+	return h
+}
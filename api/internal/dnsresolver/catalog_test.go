@@ -0,0 +1,79 @@
+package dnsresolver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDescribe_KnownAndUnknown(t *testing.T) {
+	info := Describe("1.1.1.1")
+	if info.Provider != "Cloudflare" || info.City != "San Francisco, CA" || info.Family != FamilyIPv4 {
+		t.Fatalf("unexpected metadata: %+v", info)
+	}
+	if info.Latitude == 0 || len(info.Transports) < 3 {
+		t.Fatalf("expected coordinates and encrypted transports: %+v", info)
+	}
+
+	info = Describe("[2001:db8::1]:5353")
+	if info.Provider != "" || info.Family != FamilyIPv6 || len(info.Transports) != 2 {
+		t.Fatalf("unexpected metadata for unknown server: %+v", info)
+	}
+}
+
+func TestHealthTracker_KeepsRecentWindow(t *testing.T) {
+	tr := newHealthTracker(10)
+	now := time.Now()
+	for i := 0; i < healthWindow; i++ {
+		tr.record(Result{Server: "192.0.2.1", Status: "timeout", QueriedAt: now.Add(time.Duration(i) * time.Millisecond)})
+	}
+	for i := 0; i < 10; i++ {
+		tr.record(Result{Server: "192.0.2.1:53", Status: "ok", RTTMs: 20, QueriedAt: now.Add(time.Second + time.Duration(i)*time.Millisecond)})
+	}
+
+	h := tr.get("192.0.2.1")
+	if h.Queries != healthWindow || h.Responded != 10 || h.Timeouts != healthWindow-10 {
+		t.Fatalf("unexpected counts: %+v", h)
+	}
+	if h.MeanRTTMs != 20 || h.LastStatus != "ok" || h.SuccessRate != 10.0/healthWindow {
+		t.Fatalf("unexpected summary: %+v", h)
+	}
+	if tr.get("192.0.2.2") != nil {
+		t.Fatal("expected no health for an unqueried server")
+	}
+}
+
+func TestHealthTracker_EvictsLeastRecentServers(t *testing.T) {
+	tr := newHealthTracker(2)
+	now := time.Now()
+	tr.record(Result{Server: "192.0.2.1", Status: "ok", QueriedAt: now})
+	tr.record(Result{Server: "192.0.2.2", Status: "ok", QueriedAt: now})
+	tr.record(Result{Server: "192.0.2.1", Status: "ok", QueriedAt: now})
+	tr.record(Result{Server: "192.0.2.3", Status: "ok", QueriedAt: now})
+
+	if tr.get("192.0.2.2") != nil {
+		t.Fatal("expected the least recently queried server to be evicted")
+	}
+	if tr.get("192.0.2.1") == nil || tr.get("192.0.2.3") == nil {
+		t.Fatal("expected the recently queried servers to be kept")
+	}
+}
+
+func TestDescribe_TransportsMatchDefaultProviders(t *testing.T) {
+	for server := range defaultRegions {
+		if info := Describe(server); info.Provider == "" {
+			t.Fatalf("%s: expected a provider in %q", server, defaultRegions[server])
+		}
+	}
+	for provider := range providerTransports {
+		found := false
+		for server := range defaultRegions {
+			if Describe(server).Provider == provider {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("providerTransports lists %q, which no default resolver is labelled with", provider)
+		}
+	}
+}
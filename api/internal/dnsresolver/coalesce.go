@@ -0,0 +1,108 @@
+package dnsresolver
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CoalesceStats counts the live (non-cached) lookups made through Resolve and ResolveStream since
+// startup. Queries went out to a server; Coalesced were answered by an identical query (same
+// server, name, type and DNSSEC flag) that another caller already had in flight.
+type CoalesceStats struct {
+	Queries   int64 `json:"queries"`
+	Coalesced int64 `json:"coalesced"`
+}
+
+// Coalescing returns the lookup counters.
+func Coalescing() CoalesceStats {
+	return CoalesceStats{Queries: inflight.queries.Load(), Coalesced: inflight.coalesced.Load()}
+}
+
+// inflight shares one outbound query between concurrent identical lookups, keyed by cacheKey.
+// The cache only helps once a query completes; this covers the time before.
+var inflight = &coalescer{calls: map[string]*call{}}
+
+type coalescer struct {
+	mu        sync.Mutex
+	calls     map[string]*call
+	queries   atomic.Int64
+	coalesced atomic.Int64
+}
+
+// call is one shared query. waiters counts the callers still waiting for res; the last one to
+// give up cancels the query.
+type call struct {
+	done    chan struct{}
+	res     Result
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// do returns the result of query for key, running it only if no identical query is in flight.
+// The shared query is detached from ctx so one caller giving up does not fail the others, but
+// keeps the first caller's timeout, and it is cancelled once every caller waiting on it has left.
+// A caller whose ctx ends before the result arrives gets an Abandoned timeout (or, when
+// cancelled, error) result for server instead. Results that came from another caller's query have
+// Coalesced set. Every caller gets its own copy of the answer slices.
+func (c *coalescer) do(ctx context.Context, key, server string, perQueryTimeout time.Duration, query func(ctx context.Context, timeout time.Duration) Result) Result {
+	c.mu.Lock()
+	cl, shared := c.calls[key]
+	if !shared {
+		qctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		cl = &call{done: make(chan struct{}), cancel: cancel}
+		c.calls[key] = cl
+		c.queries.Add(1)
+		timeout := queryTimeout(ctx, perQueryTimeout)
+		go func() {
+			cl.res = query(qctx, timeout)
+			cancel()
+			c.forget(key, cl)
+			close(cl.done)
+		}()
+	}
+	cl.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-cl.done:
+		res := cl.res
+		res.Answers = slices.Clone(res.Answers)
+		res.Authority = slices.Clone(res.Authority)
+		if shared {
+			c.coalesced.Add(1)
+			res.Coalesced = true
+		}
+		return res
+	case <-ctx.Done():
+		c.mu.Lock()
+		if cl.waiters--; cl.waiters == 0 {
+			cl.cancel()
+			c.forgetLocked(key, cl)
+		}
+		c.mu.Unlock()
+		res := newResult(server, time.Now().UTC())
+		res.Abandoned = true
+		res.Status = "error"
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			res.Status = "timeout"
+		}
+		return res
+	}
+}
+
+// forget removes cl from the in-flight calls so the next lookup for key starts a new query.
+func (c *coalescer) forget(key string, cl *call) {
+	c.mu.Lock()
+	c.forgetLocked(key, cl)
+	c.mu.Unlock()
+}
+
+func (c *coalescer) forgetLocked(key string, cl *call) {
+	if c.calls[key] == cl {
+		delete(c.calls, key)
+	}
+}
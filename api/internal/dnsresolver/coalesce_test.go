@@ -0,0 +1,166 @@
+package dnsresolver
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// blockingExchange answers every query with one A record once release is closed, counting calls.
+func blockingExchange(t *testing.T) (calls *atomic.Int32, release chan struct{}) {
+	t.Helper()
+	calls, release = &atomic.Int32{}, make(chan struct{})
+	prev := exchange
+	exchange = func(ctx context.Context, m *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+		calls.Add(1)
+		<-release
+		r := new(dns.Msg)
+		r.SetReply(m)
+		r.Answer = mustRRs(t, []string{"example.com. 60 IN A 192.0.2.80"})
+		return r, time.Millisecond, nil
+	}
+	t.Cleanup(func() { exchange = prev })
+	return calls, release
+}
+
+func TestResolve_CoalescesIdenticalLookups(t *testing.T) {
+	calls, release := blockingExchange(t)
+	before := Coalescing()
+
+	const callers = 10
+	results := make([]Result, callers)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = Resolve(context.Background(), "Example.com", "A", []string{"192.0.2.1"}, false, time.Second, nil, 0)[0]
+		}()
+	}
+	time.Sleep(50 * time.Millisecond) // let every caller join the in-flight query
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected one outbound query, got %d", got)
+	}
+	coalesced := 0
+	for _, r := range results {
+		if r.Status != "ok" || len(r.Answers) != 1 {
+			t.Fatalf("expected every caller to get the answer, got %+v", r)
+		}
+		if r.Coalesced {
+			coalesced++
+		}
+	}
+	if coalesced != callers-1 {
+		t.Fatalf("expected %d coalesced results, got %d", callers-1, coalesced)
+	}
+	if &results[0].Answers[0] == &results[1].Answers[0] {
+		t.Fatal("expected every caller to get its own answers slice")
+	}
+	after := Coalescing()
+	if after.Queries-before.Queries != 1 || after.Coalesced-before.Coalesced != callers-1 {
+		t.Fatalf("unexpected counters: before %+v, after %+v", before, after)
+	}
+
+	// Once the query is done, the next lookup goes out again.
+	if r := Resolve(context.Background(), "example.com", "A", []string{"192.0.2.1"}, false, time.Second, nil, 0)[0]; r.Coalesced || calls.Load() != 2 {
+		t.Fatalf("expected a fresh query, got coalesced=%v after %d calls", r.Coalesced, calls.Load())
+	}
+}
+
+func TestResolve_CoalescedCallerCanLeave(t *testing.T) {
+	_, release := blockingExchange(t)
+
+	leader := make(chan Result)
+	go func() {
+		leader <- Resolve(context.Background(), "example.com", "A", []string{"192.0.2.1"}, false, time.Second, nil, 0)[0]
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// A caller that gives up gets an error without failing the shared query.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if r := Resolve(ctx, "example.com", "A", []string{"192.0.2.1"}, false, time.Second, nil, 0)[0]; r.Status != "error" || r.Server != "192.0.2.1" {
+		t.Fatalf("expected an error result for the cancelled caller, got %+v", r)
+	}
+	close(release)
+	if r := <-leader; r.Status != "ok" {
+		t.Fatalf("expected the other caller to get the answer, got %+v", r)
+	}
+}
+
+func TestResolve_CoalescedQueryCancelledWhenAllCallersLeave(t *testing.T) {
+	var calls atomic.Int32
+	cancelled := make(chan struct{})
+	prev := exchange
+	exchange = func(ctx context.Context, m *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+		calls.Add(1)
+		<-ctx.Done()
+		close(cancelled)
+		return nil, 0, ctx.Err()
+	}
+	t.Cleanup(func() { exchange = prev })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Resolve(ctx, "example.com", "A", []string{"192.0.2.1"}, false, time.Minute, nil, 0)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond) // let every caller join the in-flight query
+	cancel()
+	wg.Wait()
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("expected the shared query to be cancelled once its callers left")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected one outbound query, got %d", got)
+	}
+}
+
+// mapCache is a Cache without expiry.
+type mapCache map[string]Result
+
+func (c mapCache) Get(key string) (Result, bool) {
+	r, ok := c[key]
+	return r, ok
+}
+
+func (c mapCache) Add(key string, val Result, _ time.Duration) { c[key] = val }
+
+func TestResolve_AbandonedCallerIsNotCached(t *testing.T) {
+	_, release := blockingExchange(t)
+	cache := mapCache{}
+
+	leader := make(chan Result)
+	go func() {
+		leader <- Resolve(context.Background(), "example.com", "A", []string{"192.0.2.1"}, false, time.Second, nil, 0)[0]
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// A caller whose own deadline passes gets a timeout, which says nothing about the server.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if r := Resolve(ctx, "example.com", "A", []string{"192.0.2.1"}, false, time.Second, cache, 0)[0]; r.Status != "timeout" || !r.Abandoned {
+		t.Fatalf("expected an abandoned timeout, got %+v", r)
+	}
+	if len(cache) != 0 {
+		t.Fatalf("expected nothing cached, got %+v", cache)
+	}
+	close(release)
+	if r := <-leader; r.Status != "ok" {
+		t.Fatalf("expected the shared query to still answer, got %+v", r)
+	}
+}
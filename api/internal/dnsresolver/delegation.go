@@ -0,0 +1,297 @@
+package dnsresolver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Nameserver statuses reported by CheckDelegation.
+const (
+	NSOk          = "ok"
+	NSLame        = "lame"        // answers, but not authoritatively for the zone
+	NSUnreachable = "unreachable" // no address or no reply from any address
+	NSMissing     = "missing"     // listed in the child zone but not delegated by the parent
+	NSExtra       = "extra"       // delegated by the parent but not listed in the child zone
+)
+
+// NameserverCheck describes one nameserver seen in either the parent delegation or the child NS RRset.
+type NameserverCheck struct {
+	Host     string `json:"host"`
+	InParent bool   `json:"in_parent"`
+	InChild  bool   `json:"in_child"`
+	// Glue holds the addresses the parent returned in the additional section of its referral.
+	Glue []string `json:"glue,omitempty"`
+	// ChildAddresses holds the A/AAAA records the child zone publishes for an in-zone nameserver.
+	ChildAddresses []string `json:"child_addresses,omitempty"`
+	// Addresses are the addresses actually queried (glue if present, otherwise resolved recursively).
+	Addresses []string `json:"addresses,omitempty"`
+	Status    string   `json:"status"`
+	Problems  []string `json:"problems,omitempty"`
+}
+
+// DelegationReport compares the parent zone's referral for a zone with the zone's own NS RRset.
+type DelegationReport struct {
+	Name         string            `json:"name"`
+	Zone         string            `json:"zone"`
+	Parent       string            `json:"parent"`
+	ParentServer string            `json:"parent_server,omitempty"`
+	ParentNS     []string          `json:"parent_ns"`
+	ChildNS      []string          `json:"child_ns"`
+	Nameservers  []NameserverCheck `json:"nameservers"`
+	Consistent   bool              `json:"consistent"`
+	Problems     []string          `json:"problems,omitempty"`
+}
+
+// CheckDelegation finds the zone containing name, asks one of the parent zone's nameservers for
+// its referral and glue, then queries every delegated or listed nameserver directly to compare the
+// child's NS RRset and in-zone A/AAAA records with what the parent hands out.
+// recursive resolvers are only used to locate the zones and resolve out-of-zone nameserver addresses.
+func CheckDelegation(ctx context.Context, name string, recursive []string, timeout time.Duration) DelegationReport {
+	name = strings.ToLower(dns.Fqdn(name))
+	report := DelegationReport{Name: name, Zone: name, ParentNS: []string{}, ChildNS: []string{}, Nameservers: []NameserverCheck{}}
+	if zone, err := findZone(ctx, recursive, name, timeout); err == nil {
+		report.Zone = zone
+	}
+	if report.Zone == "." {
+		report.Problems = append(report.Problems, "the root zone has no parent delegation")
+		return report
+	}
+	report.Parent = parentZone(report.Zone)
+	if parent, err := findZone(ctx, recursive, report.Parent, timeout); err == nil {
+		report.Parent = parent
+	}
+
+	parentHosts, err := lookupNS(ctx, recursive, report.Parent, timeout)
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("cannot find nameservers for parent zone %s: %v", report.Parent, err))
+		return report
+	}
+	referral, server := parentReferral(ctx, recursive, parentHosts, report.Zone, timeout)
+	if referral == nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("no nameserver for %s answered a referral query", report.Parent))
+		return report
+	}
+	report.ParentServer = server
+	report.ParentNS = nsHosts(append(referral.Ns, referral.Answer...), report.Zone)
+	if len(report.ParentNS) == 0 {
+		report.Problems = append(report.Problems, fmt.Sprintf("%s does not delegate %s", report.Parent, report.Zone))
+		return report
+	}
+
+	checks := map[string]*NameserverCheck{}
+	childSets := map[string][]string{}
+	probeAll := func(hosts []string) {
+		var (
+			mu sync.Mutex
+			wg sync.WaitGroup
+		)
+		for _, h := range hosts {
+			c := &NameserverCheck{Host: h, Glue: addrsFor(referral.Extra, h)}
+			checks[h] = c
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				nsSet := probeNameserver(ctx, recursive, report.Zone, c, timeout)
+				if nsSet != nil {
+					mu.Lock()
+					childSets[c.Host] = nsSet
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	probeAll(report.ParentNS)
+	report.ChildNS = unionSets(childSets)
+	var unlisted []string
+	for _, h := range report.ChildNS {
+		if _, ok := checks[h]; !ok {
+			unlisted = append(unlisted, h)
+		}
+	}
+	probeAll(unlisted)
+	report.ChildNS = unionSets(childSets)
+	if distinctSets(childSets) > 1 {
+		report.Problems = append(report.Problems, "authoritative nameservers return different NS RRsets")
+	}
+
+	authAddr := firstAuthoritativeAddr(checks, childSets)
+	for _, h := range sortedKeys(checks) {
+		c := checks[h]
+		c.InParent = contains(report.ParentNS, h)
+		c.InChild = contains(report.ChildNS, h)
+		if dns.IsSubDomain(report.Zone, h) {
+			checkGlue(ctx, report.Zone, authAddr, c, timeout)
+		}
+		if c.Status == "" {
+			switch {
+			case !c.InParent:
+				c.Status = NSMissing
+				c.Problems = append(c.Problems, "listed in the zone but not delegated by the parent")
+			case !c.InChild:
+				c.Status = NSExtra
+				c.Problems = append(c.Problems, "delegated by the parent but not listed in the zone")
+			default:
+				c.Status = NSOk
+			}
+		}
+		report.Nameservers = append(report.Nameservers, *c)
+	}
+
+	report.Consistent = len(report.Problems) == 0
+	for _, c := range report.Nameservers {
+		if c.Status != NSOk || len(c.Problems) > 0 {
+			report.Consistent = false
+		}
+	}
+	return report
+}
+
+// parentReferral queries the parent's nameservers in order for zone's NS set and returns the first
+// usable reply along with the address that produced it.
+func parentReferral(ctx context.Context, recursive, parentHosts []string, zone string, timeout time.Duration) (*dns.Msg, string) {
+	for _, host := range parentHosts {
+		for _, addr := range lookupAddrs(ctx, recursive, host, timeout) {
+			if ctx.Err() != nil {
+				return nil, ""
+			}
+			r, _, err := authoritativeQuery(ctx, addr, zone, dns.TypeNS, timeout)
+			if err == nil && r != nil && r.Rcode == dns.RcodeSuccess {
+				return r, addr
+			}
+		}
+	}
+	return nil, ""
+}
+
+// probeNameserver queries each address of c for the zone's NS RRset. It sets c.Status when the
+// server is lame or unreachable and returns the NS set from the first authoritative reply.
+func probeNameserver(ctx context.Context, recursive []string, zone string, c *NameserverCheck, timeout time.Duration) []string {
+	c.Addresses = c.Glue
+	if len(c.Addresses) == 0 {
+		c.Addresses = lookupAddrs(ctx, recursive, c.Host, timeout)
+	}
+	if len(c.Addresses) == 0 {
+		c.Status = NSUnreachable
+		c.Problems = append(c.Problems, "nameserver host has no A or AAAA records")
+		return nil
+	}
+
+	var nsSet []string
+	replied := false
+	for _, addr := range c.Addresses {
+		r, _, err := authoritativeQuery(ctx, addr, zone, dns.TypeNS, timeout)
+		if err != nil || r == nil {
+			c.Problems = append(c.Problems, fmt.Sprintf("%s: no reply", addr))
+			continue
+		}
+		replied = true
+		if r.Rcode != dns.RcodeSuccess || !r.Authoritative {
+			c.Problems = append(c.Problems, fmt.Sprintf("%s: not authoritative (rcode %s, aa=%t)", addr, dns.RcodeToString[r.Rcode], r.Authoritative))
+			continue
+		}
+		if set := nsHosts(r.Answer, zone); nsSet == nil && len(set) > 0 {
+			nsSet = set
+		}
+	}
+	switch {
+	case !replied:
+		c.Status = NSUnreachable
+	case nsSet == nil:
+		c.Status = NSLame
+	}
+	return nsSet
+}
+
+// checkGlue compares the parent's glue for an in-zone nameserver with the addresses the child publishes.
+func checkGlue(ctx context.Context, zone, authAddr string, c *NameserverCheck, timeout time.Duration) {
+	if authAddr != "" {
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			r, _, err := authoritativeQuery(ctx, authAddr, c.Host, qtype, timeout)
+			if err == nil && r != nil && r.Authoritative {
+				c.ChildAddresses = append(c.ChildAddresses, addrsFor(r.Answer, c.Host)...)
+			}
+		}
+		sort.Strings(c.ChildAddresses)
+	}
+	if !c.InParent {
+		return
+	}
+	if len(c.Glue) == 0 {
+		c.Problems = append(c.Problems, "in-zone nameserver has no glue at the parent")
+		return
+	}
+	if authAddr != "" && !equalStrings(c.Glue, c.ChildAddresses) {
+		c.Problems = append(c.Problems, fmt.Sprintf("glue %v does not match zone addresses %v", c.Glue, c.ChildAddresses))
+	}
+}
+
+// firstAuthoritativeAddr picks an address of a nameserver that answered authoritatively.
+func firstAuthoritativeAddr(checks map[string]*NameserverCheck, childSets map[string][]string) string {
+	for _, h := range sortedKeys(checks) {
+		if _, ok := childSets[h]; ok && len(checks[h].Addresses) > 0 {
+			return checks[h].Addresses[0]
+		}
+	}
+	return ""
+}
+
+func unionSets(sets map[string][]string) []string {
+	seen := map[string]struct{}{}
+	out := []string{}
+	for _, set := range sets {
+		for _, h := range set {
+			if _, ok := seen[h]; !ok {
+				seen[h] = struct{}{}
+				out = append(out, h)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func distinctSets(sets map[string][]string) int {
+	seen := map[string]struct{}{}
+	for _, set := range sets {
+		seen[strings.Join(set, " ")] = struct{}{}
+	}
+	return len(seen)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package dnsresolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// fakeReply is a canned response keyed by "qname QTYPE".
+type fakeReply struct {
+	aa     bool
+	rcode  int
+	answer []string
+	ns     []string
+	extra  []string
+}
+
+// fakeDNS maps server addresses to their canned replies. Servers not present time out.
+type fakeDNS map[string]map[string]fakeReply
+
+func (f fakeDNS) install(t *testing.T) {
+	t.Helper()
+	prev := exchange
+	exchange = func(ctx context.Context, m *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+		server, ok := f[addr]
+		if !ok {
+			return nil, 0, errors.New("i/o timeout")
+		}
+		q := m.Question[0]
+		fr := server[q.Name+" "+dns.TypeToString[q.Qtype]]
+		r := new(dns.Msg)
+		r.SetReply(m)
+		r.Authoritative = fr.aa
+		r.Rcode = fr.rcode
+		r.Answer = mustRRs(t, fr.answer)
+		r.Ns = mustRRs(t, fr.ns)
+		r.Extra = mustRRs(t, fr.extra)
+		return r, time.Millisecond, nil
+	}
+	t.Cleanup(func() { exchange = prev })
+}
+
+func mustRRs(t *testing.T, in []string) []dns.RR {
+	out := make([]dns.RR, 0, len(in))
+	for _, s := range in {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatalf("NewRR(%q): %v", s, err)
+		}
+		out = append(out, rr)
+	}
+	return out
+}
+
+// delegationFixture: com. delegates example.com. to ns1/ns2.example.com; the zone itself lists
+// ns1, ns2 and ns3.other.test. ns2's glue points at an address the zone does not publish.
+func delegationFixture() fakeDNS {
+	return fakeDNS{
+		"192.0.2.53:53": {
+			"www.example.com. SOA": {ns: []string{"example.com. 300 IN SOA ns1.example.com. h.example.com. 1 2 3 4 60"}},
+			"com. SOA":             {answer: []string{"com. 300 IN SOA a.gtld.test. h.test. 1 2 3 4 60"}},
+			"com. NS":              {answer: []string{"com. 300 IN NS a.gtld.test."}},
+			"a.gtld.test. A":       {answer: []string{"a.gtld.test. 300 IN A 192.0.2.1"}},
+			"ns3.other.test. A":    {answer: []string{"ns3.other.test. 300 IN A 192.0.2.13"}},
+		},
+		"192.0.2.1:53": {
+			"example.com. NS": {
+				ns:    []string{"example.com. 172800 IN NS ns1.example.com.", "example.com. 172800 IN NS ns2.example.com."},
+				extra: []string{"ns1.example.com. 172800 IN A 192.0.2.11", "ns2.example.com. 172800 IN A 192.0.2.99"},
+			},
+		},
+		"192.0.2.11:53": childZone(),
+		"192.0.2.13:53": childZone(),
+		// 192.0.2.99 (stale glue for ns2) does not answer.
+	}
+}
+
+func childZone() map[string]fakeReply {
+	return map[string]fakeReply{
+		"example.com. NS": {aa: true, answer: []string{
+			"example.com. 300 IN NS ns1.example.com.",
+			"example.com. 300 IN NS ns2.example.com.",
+			"example.com. 300 IN NS ns3.other.test.",
+		}},
+		"ns1.example.com. A": {aa: true, answer: []string{"ns1.example.com. 300 IN A 192.0.2.11"}},
+		"ns2.example.com. A": {aa: true, answer: []string{"ns2.example.com. 300 IN A 192.0.2.12"}},
+	}
+}
+
+func TestCheckDelegation_FlagsMismatches(t *testing.T) {
+	delegationFixture().install(t)
+
+	rep := CheckDelegation(context.Background(), "www.example.com", []string{"192.0.2.53"}, time.Second)
+	if rep.Zone != "example.com." || rep.Parent != "com." {
+		t.Fatalf("zone/parent: got %q/%q", rep.Zone, rep.Parent)
+	}
+	if rep.Consistent {
+		t.Fatalf("expected inconsistent delegation")
+	}
+	if len(rep.ParentNS) != 2 || len(rep.ChildNS) != 3 {
+		t.Fatalf("unexpected NS sets: parent=%v child=%v", rep.ParentNS, rep.ChildNS)
+	}
+	got := map[string]NameserverCheck{}
+	for _, c := range rep.Nameservers {
+		got[c.Host] = c
+	}
+	if c := got["ns1.example.com."]; c.Status != NSOk || len(c.Problems) != 0 {
+		t.Fatalf("ns1: %+v", c)
+	}
+	ns2 := got["ns2.example.com."]
+	if ns2.Status != NSUnreachable {
+		t.Fatalf("ns2 status: %+v", ns2)
+	}
+	if len(ns2.ChildAddresses) != 1 || ns2.ChildAddresses[0] != "192.0.2.12" {
+		t.Fatalf("ns2 child addresses: %v", ns2.ChildAddresses)
+	}
+	if c := got["ns3.other.test."]; c.Status != NSMissing || c.InParent || !c.InChild {
+		t.Fatalf("ns3: %+v", c)
+	}
+}
+
+func TestCheckDelegation_Lame(t *testing.T) {
+	f := delegationFixture()
+	f["192.0.2.1:53"]["example.com. NS"] = fakeReply{
+		ns:    []string{"example.com. 172800 IN NS ns1.example.com."},
+		extra: []string{"ns1.example.com. 172800 IN A 192.0.2.11"},
+	}
+	f["192.0.2.11:53"] = map[string]fakeReply{"example.com. NS": {rcode: dns.RcodeRefused}}
+	f.install(t)
+
+	rep := CheckDelegation(context.Background(), "example.com", []string{"192.0.2.53"}, time.Second)
+	if len(rep.Nameservers) != 1 || rep.Nameservers[0].Status != NSLame {
+		t.Fatalf("expected single lame nameserver, got %+v", rep.Nameservers)
+	}
+	if rep.Consistent {
+		t.Fatalf("lame delegation must not be consistent")
+	}
+}
@@ -0,0 +1,142 @@
+package dnsresolver
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ServerETA says when a resolver is expected to start serving the authoritative answer.
+type ServerETA struct {
+	Server string
+	// Current is true when the resolver already returns the authoritative answer.
+	Current bool
+	// ExpiresAt is when the resolver's stale cached answer runs out. Zero when current or unknown.
+	ExpiresAt time.Time
+}
+
+// PropagationEstimate combines the authoritative answer with each resolver's cached TTL.
+type PropagationEstimate struct {
+	Authoritative    Result
+	AuthoritativeTTL time.Duration
+	Servers          []ServerETA
+	Current          int
+	Stale            int
+	Unknown          int
+	// FullyPropagatedBy is the latest stale expiry, or the authoritative query time if nothing is stale.
+	FullyPropagatedBy time.Time
+}
+
+// QueryAuthoritative asks the nameservers of the zone containing name directly (no recursion)
+// and returns the first authoritative reply.
+func QueryAuthoritative(ctx context.Context, name, qtype string, recursive []string, timeout time.Duration) (Result, error) {
+	zone, err := findZone(ctx, recursive, name, timeout)
+	if err != nil {
+		return Result{}, err
+	}
+	hosts, err := lookupNS(ctx, recursive, zone, timeout)
+	if err != nil {
+		return Result{}, err
+	}
+	for _, host := range hosts {
+		for _, addr := range lookupAddrs(ctx, recursive, host, timeout) {
+			if ctx.Err() != nil {
+				return Result{}, ctx.Err()
+			}
+			res := query(ctx, addr, name, qtype, false, false, timeout)
+			if !res.Authoritative {
+				continue
+			}
+			switch res.Status {
+			case "ok", "nxdomain", "noanswer":
+				return res, nil
+			}
+		}
+	}
+	return Result{}, errors.New("no authoritative answer for " + name)
+}
+
+// EstimatePropagation computes when each resolver should converge on the authoritative answer.
+// A stale resolver converges once its cached copy expires: the time it was queried plus the
+// remaining TTL it reported (the SOA negative TTL for cached nxdomain/noanswer). Resolvers that
+// answered without a usable TTL, e.g. servfail, are bounded by the authoritative TTL instead.
+// Timeouts and errors are counted as unknown and do not contribute to the overall estimate.
+func EstimatePropagation(results []Result, auth Result) PropagationEstimate {
+	est := PropagationEstimate{
+		Authoritative:     auth,
+		AuthoritativeTTL:  authoritativeTTL(auth),
+		Servers:           make([]ServerETA, 0, len(results)),
+		FullyPropagatedBy: auth.QueriedAt,
+	}
+	for _, res := range results {
+		eta := ServerETA{Server: res.Server}
+		switch {
+		case matchesAuthoritative(res, auth):
+			eta.Current = true
+			est.Current++
+		case res.Status == "timeout" || res.Status == "error":
+			est.Unknown++
+		default:
+			eta.ExpiresAt = res.QueriedAt.Add(remainingTTL(res, est.AuthoritativeTTL))
+			est.Stale++
+			if eta.ExpiresAt.After(est.FullyPropagatedBy) {
+				est.FullyPropagatedBy = eta.ExpiresAt
+			}
+		}
+		est.Servers = append(est.Servers, eta)
+	}
+	return est
+}
+
+func authoritativeTTL(auth Result) time.Duration {
+	if auth.Status == "ok" {
+		return minAnswerTTL(auth.Answers)
+	}
+	return auth.NegativeTTL
+}
+
+func remainingTTL(res Result, fallback time.Duration) time.Duration {
+	switch res.Status {
+	case "ok":
+		if ttl := minAnswerTTL(res.Answers); ttl > 0 {
+			return ttl
+		}
+	case "nxdomain", "noanswer":
+		if res.NegativeTTL > 0 {
+			return res.NegativeTTL
+		}
+	}
+	return fallback
+}
+
+// matchesAuthoritative compares a resolver's answer with the authoritative one. When the zone
+// answers with a CNAME only the CNAME records are compared, since resolvers append the chased target.
+func matchesAuthoritative(res, auth Result) bool {
+	if res.Status != auth.Status {
+		return false
+	}
+	if auth.Status != "ok" {
+		return true
+	}
+	onlyCNAME := false
+	for _, a := range auth.Answers {
+		if a.Type == "CNAME" {
+			onlyCNAME = true
+		}
+	}
+	return strings.Join(answerValues(res.Answers, onlyCNAME), "\n") == strings.Join(answerValues(auth.Answers, onlyCNAME), "\n")
+}
+
+func answerValues(ans []Answer, onlyCNAME bool) []string {
+	out := make([]string, 0, len(ans))
+	for _, a := range ans {
+		if onlyCNAME && a.Type != "CNAME" {
+			continue
+		}
+		out = append(out, strings.ToLower(a.Value))
+	}
+	sort.Strings(out)
+	return out
+}
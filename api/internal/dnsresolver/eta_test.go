@@ -0,0 +1,63 @@
+package dnsresolver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEstimatePropagation(t *testing.T) {
+	at := time.Date(2025, 11, 1, 12, 0, 0, 0, time.UTC)
+	auth := Result{Status: "ok", Answers: []Answer{{Value: "192.0.2.2", TTL: 300, Type: "A"}}, QueriedAt: at}
+	results := []Result{
+		{Server: "current", Status: "ok", Answers: []Answer{{Value: "192.0.2.2", TTL: 120, Type: "A"}}, QueriedAt: at},
+		{Server: "stale", Status: "ok", Answers: []Answer{{Value: "192.0.2.1", TTL: 3600, Type: "A"}}, QueriedAt: at.Add(-time.Minute)},
+		{Server: "negative", Status: "nxdomain", NegativeTTL: 900 * time.Second, QueriedAt: at},
+		{Server: "broken", Status: "servfail", QueriedAt: at},
+		{Server: "down", Status: "timeout", QueriedAt: at},
+	}
+
+	est := EstimatePropagation(results, auth)
+	if est.Current != 1 || est.Stale != 3 || est.Unknown != 1 {
+		t.Fatalf("counts: current=%d stale=%d unknown=%d", est.Current, est.Stale, est.Unknown)
+	}
+	want := map[string]time.Time{
+		"stale":    at.Add(59 * time.Minute),
+		"negative": at.Add(15 * time.Minute),
+		"broken":   at.Add(5 * time.Minute), // bounded by the authoritative TTL
+	}
+	for _, s := range est.Servers {
+		if exp, ok := want[s.Server]; ok && !s.ExpiresAt.Equal(exp) {
+			t.Fatalf("%s: expires %v, want %v", s.Server, s.ExpiresAt, exp)
+		}
+	}
+	if !est.FullyPropagatedBy.Equal(at.Add(59 * time.Minute)) {
+		t.Fatalf("fully propagated by %v", est.FullyPropagatedBy)
+	}
+}
+
+func TestMatchesAuthoritative_CNAME(t *testing.T) {
+	auth := Result{Status: "ok", Answers: []Answer{{Value: "edge.cdn.test.", Type: "CNAME"}}}
+	res := Result{Status: "ok", Answers: []Answer{{Value: "EDGE.cdn.test.", Type: "CNAME"}, {Value: "192.0.2.7", Type: "A"}}}
+	if !matchesAuthoritative(res, auth) {
+		t.Fatalf("chased CNAME target should not make the resolver stale")
+	}
+}
+
+func TestQueryAuthoritative(t *testing.T) {
+	f := delegationFixture()
+	f["192.0.2.53:53"]["www.example.com. NS"] = fakeReply{}
+	f["192.0.2.53:53"]["example.com. SOA"] = fakeReply{answer: []string{"example.com. 300 IN SOA ns1.example.com. h.example.com. 1 2 3 4 60"}}
+	f["192.0.2.53:53"]["example.com. NS"] = fakeReply{answer: []string{"example.com. 300 IN NS ns1.example.com."}}
+	f["192.0.2.53:53"]["ns1.example.com. A"] = fakeReply{answer: []string{"ns1.example.com. 300 IN A 192.0.2.11"}}
+	f["192.0.2.11:53"]["www.example.com. A"] = fakeReply{aa: true, answer: []string{"www.example.com. 60 IN A 192.0.2.80"}}
+	f.install(t)
+
+	res, err := QueryAuthoritative(context.Background(), "www.example.com", "A", []string{"192.0.2.53"}, time.Second)
+	if err != nil {
+		t.Fatalf("QueryAuthoritative: %v", err)
+	}
+	if res.Status != "ok" || len(res.Answers) != 1 || res.Answers[0].Value != "192.0.2.80" {
+		t.Fatalf("unexpected authoritative result: %+v", res)
+	}
+}
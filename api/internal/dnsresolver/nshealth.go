@@ -0,0 +1,162 @@
+package dnsresolver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Nameserver health classifications reported by CheckNameservers.
+const (
+	HealthHealthy      = "healthy"
+	HealthLame         = "lame"         // replied, but not authoritatively for the zone
+	HealthRefused      = "refused"      // REFUSED rcode
+	HealthTimeout      = "timeout"      // no reply (timeout or network error)
+	HealthNoAddress    = "no_address"   // the NS host name has no A or AAAA records to query
+	HealthInconsistent = "inconsistent" // authoritative, but SOA serial differs from the majority
+)
+
+// NameserverHealth is the result of querying one address of one nameserver for the zone SOA.
+type NameserverHealth struct {
+	Host    string  `json:"host"`
+	Address string  `json:"address,omitempty"`
+	Status  string  `json:"status"`
+	RTTMs   float64 `json:"rtt_ms,omitempty"`
+	Serial  uint32  `json:"serial,omitempty"`
+	Detail  string  `json:"detail,omitempty"`
+}
+
+// HealthReport summarizes the authoritative nameservers of a zone.
+type HealthReport struct {
+	Name        string             `json:"name"`
+	Zone        string             `json:"zone"`
+	Serial      uint32             `json:"serial,omitempty"`
+	Nameservers []NameserverHealth `json:"nameservers"`
+	Counts      map[string]int     `json:"counts"`
+	Healthy     bool               `json:"healthy"`
+	Problems    []string           `json:"problems,omitempty"`
+}
+
+// CheckNameservers resolves every NS host of the zone containing name and queries each of its
+// addresses for the zone SOA without recursion. Servers that answer authoritatively but publish a
+// serial other than the most common one are reported as inconsistent.
+func CheckNameservers(ctx context.Context, name string, recursive []string, timeout time.Duration) HealthReport {
+	name = strings.ToLower(dns.Fqdn(name))
+	report := HealthReport{Name: name, Zone: name, Nameservers: []NameserverHealth{}, Counts: map[string]int{}}
+	if zone, err := findZone(ctx, recursive, name, timeout); err == nil {
+		report.Zone = zone
+	}
+	hosts, err := lookupNS(ctx, recursive, report.Zone, timeout)
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("cannot find nameservers for %s: %v", report.Zone, err))
+		return report
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, host := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addrs := lookupAddrs(ctx, recursive, host, timeout)
+			if len(addrs) == 0 {
+				mu.Lock()
+				report.Nameservers = append(report.Nameservers, NameserverHealth{Host: host, Status: HealthNoAddress, Detail: "nameserver host has no A or AAAA records"})
+				mu.Unlock()
+				return
+			}
+			for _, addr := range addrs {
+				h := probeSOA(ctx, report.Zone, host, addr, timeout)
+				mu.Lock()
+				report.Nameservers = append(report.Nameservers, h)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(report.Nameservers, func(i, j int) bool {
+		a, b := report.Nameservers[i], report.Nameservers[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		return a.Address < b.Address
+	})
+	report.Serial = majoritySerial(report.Nameservers)
+	for i := range report.Nameservers {
+		h := &report.Nameservers[i]
+		if h.Status == HealthHealthy && h.Serial != report.Serial {
+			h.Status = HealthInconsistent
+			h.Detail = fmt.Sprintf("serial %d differs from %d", h.Serial, report.Serial)
+		}
+		report.Counts[h.Status]++
+	}
+	report.Healthy = len(report.Nameservers) > 0 && report.Counts[HealthHealthy] == len(report.Nameservers)
+	return report
+}
+
+// probeSOA classifies a single nameserver address from query's non-recursive result, additionally
+// requiring the AA bit and an SOA for the zone itself.
+func probeSOA(ctx context.Context, zone, host, addr string, timeout time.Duration) NameserverHealth {
+	h := NameserverHealth{Host: host, Address: addr}
+	res, r := queryReply(ctx, addr, zone, "SOA", false, false, timeout)
+	h.RTTMs = res.RTTMs
+	switch res.Status {
+	case "timeout":
+		h.Status = HealthTimeout
+		return h
+	case "error":
+		h.Status = HealthTimeout
+		h.Detail = "no reply"
+		return h
+	case "refused":
+		h.Status = HealthRefused
+		return h
+	case "ok", "noanswer":
+	default:
+		h.Status = HealthLame
+		h.Detail = "rcode " + res.Status
+		return h
+	}
+	if !res.Authoritative {
+		h.Status = HealthLame
+		h.Detail = "answer is not authoritative"
+		return h
+	}
+	for _, rr := range r.Answer {
+		if soa, ok := rr.(*dns.SOA); ok && strings.EqualFold(soa.Hdr.Name, zone) {
+			h.Status = HealthHealthy
+			h.Serial = soa.Serial
+			return h
+		}
+	}
+	h.Status = HealthLame
+	h.Detail = "authoritative reply without zone SOA"
+	return h
+}
+
+// majoritySerial returns the most common serial among healthy servers, preferring the higher
+// serial on a tie.
+func majoritySerial(servers []NameserverHealth) uint32 {
+	counts := map[uint32]int{}
+	for _, h := range servers {
+		if h.Status == HealthHealthy {
+			counts[h.Serial]++
+		}
+	}
+	var best uint32
+	bestCount := 0
+	for serial, n := range counts {
+		if n > bestCount || (n == bestCount && serial > best) {
+			best, bestCount = serial, n
+		}
+	}
+	return best
+}
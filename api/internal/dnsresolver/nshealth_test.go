@@ -0,0 +1,71 @@
+package dnsresolver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestCheckNameservers_Classifies(t *testing.T) {
+	soa := func(serial string) fakeReply {
+		return fakeReply{aa: true, answer: []string{"example.com. 300 IN SOA ns1.example.com. h.example.com. " + serial + " 2 3 4 60"}}
+	}
+	fakeDNS{
+		"192.0.2.53:53": {
+			"example.com. SOA": soa("1"),
+			"example.com. NS": {answer: []string{
+				"example.com. 300 IN NS ns1.example.com.",
+				"example.com. 300 IN NS ns2.example.com.",
+				"example.com. 300 IN NS ns3.example.com.",
+				"example.com. 300 IN NS ns4.example.com.",
+				"example.com. 300 IN NS ns5.example.com.",
+				"example.com. 300 IN NS ns6.example.com.",
+				"example.com. 300 IN NS ns7.example.com.",
+			}},
+			"ns1.example.com. A": {answer: []string{"ns1.example.com. 300 IN A 192.0.2.11"}},
+			"ns2.example.com. A": {answer: []string{"ns2.example.com. 300 IN A 192.0.2.12"}},
+			"ns3.example.com. A": {answer: []string{"ns3.example.com. 300 IN A 192.0.2.13"}},
+			"ns4.example.com. A": {answer: []string{"ns4.example.com. 300 IN A 192.0.2.14"}},
+			"ns5.example.com. A": {answer: []string{"ns5.example.com. 300 IN A 192.0.2.15"}},
+			"ns6.example.com. A": {answer: []string{"ns6.example.com. 300 IN A 192.0.2.16"}},
+		},
+		"192.0.2.11:53": {"example.com. SOA": soa("2025110101")},
+		"192.0.2.12:53": {"example.com. SOA": soa("2025110101")},
+		"192.0.2.13:53": {"example.com. SOA": soa("2025103100")},
+		"192.0.2.14:53": {"example.com. SOA": {rcode: dns.RcodeRefused}},
+		"192.0.2.15:53": {"example.com. SOA": {ns: []string{"example.com. 300 IN NS ns1.example.com."}}},
+		// 192.0.2.16 does not answer
+	}.install(t)
+
+	rep := CheckNameservers(context.Background(), "example.com", []string{"192.0.2.53"}, time.Second)
+	if rep.Zone != "example.com." || rep.Serial != 2025110101 {
+		t.Fatalf("zone/serial: %q %d", rep.Zone, rep.Serial)
+	}
+	want := map[string]string{
+		"ns1.example.com.": HealthHealthy,
+		"ns2.example.com.": HealthHealthy,
+		"ns3.example.com.": HealthInconsistent,
+		"ns4.example.com.": HealthRefused,
+		"ns5.example.com.": HealthLame,
+		"ns6.example.com.": HealthTimeout,
+		"ns7.example.com.": HealthNoAddress, // no A or AAAA records
+	}
+	if len(rep.Nameservers) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), rep.Nameservers)
+	}
+	for _, h := range rep.Nameservers {
+		if h.Status != want[h.Host] {
+			t.Fatalf("%s: status %q, want %q", h.Host, h.Status, want[h.Host])
+		}
+	}
+	for _, h := range rep.Nameservers {
+		if h.Host == "ns7.example.com." && (h.Address != "" || h.Detail == "") {
+			t.Fatalf("expected an address-less entry with a detail, got %+v", h)
+		}
+	}
+	if rep.Healthy || rep.Counts[HealthHealthy] != 2 {
+		t.Fatalf("unexpected summary: healthy=%v counts=%v", rep.Healthy, rep.Counts)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/miekg/dns"
@@ -12,6 +13,7 @@ import (
 type Answer struct {
 	Value string
 	TTL   uint32
+	Type  string
 }
 
 type Result struct {
@@ -25,10 +27,19 @@ type Result struct {
 	Authority []string
 	When      time.Time
 	AD        bool // Authenticated Data (DNSSEC)
+	// Authoritative reports the AA bit; only meaningful for non-recursive queries
+	Authoritative bool `json:"-"`
 	// CacheTTL is the recommended TTL for this result; not serialized in API JSON
 	CacheTTL time.Duration `json:"-"`
 	// QueriedAt is when this result was originally obtained; not serialized, used for cache expiry
 	QueriedAt time.Time `json:"-"`
+	// NegativeTTL is the SOA-derived TTL of an nxdomain/noanswer response, before any cache cap
+	NegativeTTL time.Duration `json:"-"`
+	// Coalesced is set when the result came from another caller's identical in-flight query
+	Coalesced bool `json:"-"`
+	// Abandoned is set when the caller stopped waiting before a reply arrived; the status then
+	// describes the caller's deadline, not the server, and is never cached
+	Abandoned bool `json:"-"`
 }
 
 var defaultRegions = map[string]string{
@@ -147,66 +158,118 @@ var serverCoordinates = map[string][2]float64{
 	"200.221.11.100": {-22.9068, -43.1729},
 }
 
-// Cache defines the minimal interface used by resolver for caching.
+// Cache defines the minimal interface used by resolver for caching. Get must not return an entry
+// once the ttl it was added with has passed; a ttl <= 0 means the result must not be reused.
 type Cache interface {
 	Get(key string) (Result, bool)
 	Add(key string, val Result, ttl time.Duration)
 }
 
 func Resolve(ctx context.Context, name, qtype string, servers []string, dnssec bool, perQueryTimeout time.Duration, cache Cache, maxCacheTTL time.Duration) []Result {
+	results := make([]Result, 0, len(servers))
+	ResolveStream(ctx, name, qtype, servers, dnssec, perQueryTimeout, cache, maxCacheTTL, func(r Result) {
+		results = append(results, r)
+	})
+	return results
+}
+
+// ResolveStream queries the servers like Resolve but hands each result to emit as soon as it is
+// available. emit is always called from the caller's goroutine; ResolveStream returns once every
+// server has been emitted. Cancel ctx to stop waiting for outstanding queries early. Concurrent
+// identical lookups share one outbound query, which is cancelled once all of its callers leave.
+func ResolveStream(ctx context.Context, name, qtype string, servers []string, dnssec bool, perQueryTimeout time.Duration, cache Cache, maxCacheTTL time.Duration, emit func(Result)) {
 	maxParallel := 20
 	if len(servers) < maxParallel {
 		maxParallel = len(servers)
 	}
-	sem := make(chan struct{}, maxParallel)
-	out := make(chan Result, len(servers))
+	resolveStream(ctx, make(chan struct{}, maxParallel), name, qtype, servers, dnssec, perQueryTimeout, cache, maxCacheTTL, emit)
+}
 
-	for _, s := range servers {
-		server := s
-		sem <- struct{}{}
-		go func() {
-			defer func() { <-sem }()
+// MinRemainingTTL returns how much longer the shortest-lived result may be reused, based on each
+// result's CacheTTL counted from when it was queried. It is 0 for an empty slice or expired results.
+func MinRemainingTTL(results []Result, now time.Time) time.Duration {
+	if len(results) == 0 {
+		return 0
+	}
+	min := time.Duration(-1)
+	for _, r := range results {
+		left := r.CacheTTL - now.Sub(r.QueriedAt)
+		if left < 0 {
+			left = 0
+		}
+		if min < 0 || left < min {
+			min = left
+		}
+	}
+	return min
+}
 
-			key := cacheKey(name, qtype, server, dnssec)
-			if cache != nil {
-				if cached, ok := cache.Get(key); ok {
-					if cached.CacheTTL > 0 && time.Since(cached.QueriedAt) <= cached.CacheTTL {
+// Budget caps the number of upstream queries in flight across concurrent ResolveStream calls
+// made through it, e.g. all items of a batch request.
+type Budget chan struct{}
+
+// NewBudget returns a budget allowing n concurrent upstream queries.
+func NewBudget(n int) Budget {
+	return make(Budget, n)
+}
+
+// ResolveStream behaves like the package-level ResolveStream but draws concurrency from b.
+func (b Budget) ResolveStream(ctx context.Context, name, qtype string, servers []string, dnssec bool, perQueryTimeout time.Duration, cache Cache, maxCacheTTL time.Duration, emit func(Result)) {
+	resolveStream(ctx, b, name, qtype, servers, dnssec, perQueryTimeout, cache, maxCacheTTL, emit)
+}
+
+func resolveStream(ctx context.Context, sem chan struct{}, name, qtype string, servers []string, dnssec bool, perQueryTimeout time.Duration, cache Cache, maxCacheTTL time.Duration, emit func(Result)) {
+	out := make(chan Result, len(servers))
+
+	go func() {
+		var wg sync.WaitGroup
+		for _, s := range servers {
+			server := s
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				key := cacheKey(name, qtype, server, dnssec)
+				if cache != nil {
+					if cached, ok := cache.Get(key); ok {
 						cached.When = time.Now().UTC()
 						out <- cached
 						return
 					}
-					// stale -> fall through to requery
 				}
-			}
-
-			res := queryOne(ctx, server, name, qtype, dnssec, perQueryTimeout)
-			// Cap TTL by maxCacheTTL if provided (>0)
-			if maxCacheTTL > 0 && (res.CacheTTL <= 0 || res.CacheTTL > maxCacheTTL) {
-				res.CacheTTL = maxCacheTTL
-			}
-			if cache != nil && res.Status != "error" {
-				cache.Add(key, res, res.CacheTTL)
-			}
-			out <- res
-		}()
-	}
 
-	for i := 0; i < cap(sem); i++ {
-		sem <- struct{}{}
-	}
-	close(out)
+				res := inflight.do(ctx, key, server, perQueryTimeout, func(ctx context.Context, timeout time.Duration) Result {
+					res := queryOne(ctx, server, name, qtype, dnssec, timeout)
+					if ctx.Err() == nil { // a query abandoned by its callers says nothing about the server
+						recentHealth.record(res)
+					}
+					return res
+				})
+				// Cap TTL by maxCacheTTL if provided (>0)
+				if maxCacheTTL > 0 && (res.CacheTTL <= 0 || res.CacheTTL > maxCacheTTL) {
+					res.CacheTTL = maxCacheTTL
+				}
+				if cache != nil && res.Status != "error" && !res.Abandoned {
+					cache.Add(key, res, res.CacheTTL)
+				}
+				out <- res
+			}()
+		}
+		wg.Wait()
+		close(out)
+	}()
 
-	results := make([]Result, 0, len(servers))
 	for r := range out {
-		results = append(results, r)
+		emit(r)
 	}
-	return results
 }
 
-func queryOne(ctx context.Context, server, name, qtype string, dnssec bool, perQueryTimeout time.Duration) Result {
-	now := time.Now().UTC()
+// newResult returns a Result for server with its location filled in, queried at now.
+func newResult(server string, now time.Time) Result {
 	lat, lon := coordinatesFor(server)
-	result := Result{
+	return Result{
 		Server:    normalizeServer(server),
 		Region:    regionFor(server),
 		Latitude:  lat,
@@ -214,53 +277,49 @@ func queryOne(ctx context.Context, server, name, qtype string, dnssec bool, perQ
 		When:      now,
 		QueriedAt: now,
 	}
+}
+
+func queryOne(ctx context.Context, server, name, qtype string, dnssec bool, perQueryTimeout time.Duration) Result {
+	return query(ctx, server, name, qtype, dnssec, true, perQueryTimeout)
+}
+
+// query sends a single question to server; recurse controls the RD bit so the same
+// classification can be applied to recursive resolvers and authoritative nameservers.
+func query(ctx context.Context, server, name, qtype string, dnssec, recurse bool, perQueryTimeout time.Duration) Result {
+	result, _ := queryReply(ctx, server, name, qtype, dnssec, recurse, perQueryTimeout)
+	return result
+}
+
+// queryReply is query that also returns the reply, or nil when none arrived, for callers that
+// need records the Result does not carry.
+func queryReply(ctx context.Context, server, name, qtype string, dnssec, recurse bool, perQueryTimeout time.Duration) (Result, *dns.Msg) {
+	result := newResult(server, time.Now().UTC())
 
 	qtypeCode := mapType(qtype)
 	if qtypeCode == 0 {
 		result.Status = "error"
-		return result
+		return result, nil
 	}
 
 	m := new(dns.Msg)
 	m.SetQuestion(dns.Fqdn(name), qtypeCode)
-	m.RecursionDesired = true
+	m.RecursionDesired = recurse
 	m.SetEdns0(1232, dnssec)
 
-	addr := server
-	if !strings.Contains(server, ":") {
-		addr = net.JoinHostPort(server, "53")
-	}
-
-	timeout := perQueryTimeout
-	if dl, ok := ctx.Deadline(); ok {
-		rem := time.Until(dl)
-		if rem > 0 && rem < timeout {
-			timeout = rem
-		}
-	}
-
-	client := &dns.Client{Net: "udp", Timeout: timeout}
-	r, rtt, err := client.ExchangeContext(ctx, m, addr)
+	r, rtt, err := exchange(ctx, m, serverAddr(server), queryTimeout(ctx, perQueryTimeout))
 	if err != nil {
 		if isTimeout(err) {
 			result.Status = "timeout"
 		} else {
 			result.Status = "error"
 		}
-		return result
-	}
-	if r != nil && r.Truncated {
-		clientTCP := &dns.Client{Net: "tcp", Timeout: timeout}
-		r2, rtt2, err2 := clientTCP.ExchangeContext(ctx, m, addr)
-		if err2 == nil && r2 != nil {
-			r = r2
-			rtt = rtt2
-		}
+		return result, nil
 	}
 
 	result.RTTMs = float64(rtt.Microseconds()) / 1000.0
 	// Capture DNSSEC AD bit if present
 	result.AD = r.AuthenticatedData
+	result.Authoritative = r.Authoritative
 
 	switch r.Rcode {
 	case dns.RcodeSuccess:
@@ -268,19 +327,21 @@ func queryOne(ctx context.Context, server, name, qtype string, dnssec bool, perQ
 	case dns.RcodeNameError:
 		result.Status = "nxdomain"
 		result.Authority = extractNames(r.Ns)
-		return result
+		result.NegativeTTL = negativeTTLFromNs(r.Ns)
+		return result, r
 	case dns.RcodeServerFailure:
 		result.Status = "servfail"
-		return result
+		return result, r
 	default:
 		result.Status = strings.ToLower(dns.RcodeToString[r.Rcode])
-		return result
+		return result, r
 	}
 
 	answers := parseAnswers(r.Answer)
 	if len(answers) == 0 {
 		result.Status = "noanswer"
-		result.CacheTTL = negativeTTLFromNs(r.Ns)
+		result.NegativeTTL = negativeTTLFromNs(r.Ns)
+		result.CacheTTL = result.NegativeTTL
 	} else {
 		result.Status = "ok"
 		result.Answers = answers
@@ -289,7 +350,7 @@ func queryOne(ctx context.Context, server, name, qtype string, dnssec bool, perQ
 	if len(r.Ns) > 0 {
 		result.Authority = extractNames(r.Ns)
 	}
-	return result
+	return result, r
 }
 
 func parseAnswers(rrs []dns.RR) []Answer {
@@ -299,19 +360,19 @@ func parseAnswers(rrs []dns.RR) []Answer {
 		ttl := hdr.Ttl
 		switch v := rr.(type) {
 		case *dns.A:
-			out = append(out, Answer{Value: v.A.String(), TTL: ttl})
+			out = append(out, Answer{Value: v.A.String(), TTL: ttl, Type: "A"})
 		case *dns.AAAA:
-			out = append(out, Answer{Value: v.AAAA.String(), TTL: ttl})
+			out = append(out, Answer{Value: v.AAAA.String(), TTL: ttl, Type: "AAAA"})
 		case *dns.CNAME:
-			out = append(out, Answer{Value: v.Target, TTL: ttl})
+			out = append(out, Answer{Value: v.Target, TTL: ttl, Type: "CNAME"})
 		case *dns.TXT:
-			out = append(out, Answer{Value: strings.Join(v.Txt, ""), TTL: ttl})
+			out = append(out, Answer{Value: strings.Join(v.Txt, ""), TTL: ttl, Type: "TXT"})
 		case *dns.MX:
-			out = append(out, Answer{Value: v.Mx, TTL: ttl})
+			out = append(out, Answer{Value: v.Mx, TTL: ttl, Type: "MX"})
 		case *dns.NS:
-			out = append(out, Answer{Value: v.Ns, TTL: ttl})
+			out = append(out, Answer{Value: v.Ns, TTL: ttl, Type: "NS"})
 		case *dns.SOA:
-			out = append(out, Answer{Value: v.Ns + " " + v.Mbox, TTL: ttl})
+			out = append(out, Answer{Value: v.Ns + " " + v.Mbox, TTL: ttl, Type: "SOA"})
 		default:
 			// ignore others
 		}
@@ -1,6 +1,10 @@
 package dnsresolver
 
 import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -58,9 +62,89 @@ func TestNegativeTTLFromNs_FromSOA(t *testing.T) {
 
 func TestExtractNames(t *testing.T) {
 	rr, err := dns.NewRR("example.com. 60 IN NS ns1.example.com.")
-	if err != nil { t.Fatalf("NewRR: %v", err) }
+	if err != nil {
+		t.Fatalf("NewRR: %v", err)
+	}
 	ns := extractNames([]dns.RR{rr})
 	if len(ns) != 1 || ns[0] != "example.com." {
 		t.Fatalf("unexpected extractNames: %#v", ns)
 	}
-}
\ No newline at end of file
+}
+
+func TestResolveStream_EmitsEachServer(t *testing.T) {
+	fakeDNS{
+		"192.0.2.1:53": {"example.com. A": {answer: []string{"example.com. 60 IN A 192.0.2.80"}}},
+		"192.0.2.2:53": {"example.com. A": {rcode: dns.RcodeNameError}},
+	}.install(t)
+
+	got := map[string]string{}
+	ResolveStream(context.Background(), "example.com", "A", []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}, false, time.Second, nil, 0, func(r Result) {
+		got[r.Server] = r.Status
+	})
+	want := map[string]string{"192.0.2.1": "ok", "192.0.2.2": "nxdomain", "192.0.2.3": "timeout"}
+	for server, status := range want {
+		if got[server] != status {
+			t.Fatalf("%s: got %q, want %q (all: %v)", server, got[server], status, got)
+		}
+	}
+}
+
+func TestBudget_CapsInFlightAcrossCalls(t *testing.T) {
+	var inflight, peak atomic.Int32
+	prev := exchange
+	exchange = func(ctx context.Context, m *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		r := new(dns.Msg)
+		r.SetReply(m)
+		return r, time.Millisecond, nil
+	}
+	t.Cleanup(func() { exchange = prev })
+
+	servers := make([]string, 10)
+	for i := range servers {
+		servers[i] = fmt.Sprintf("192.0.2.%d", i+1)
+	}
+	budget := NewBudget(3)
+	var wg sync.WaitGroup
+	var emitted atomic.Int32
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			budget.ResolveStream(context.Background(), "example.com", "A", servers, false, time.Second, nil, 0, func(Result) {
+				emitted.Add(1)
+			})
+		}()
+	}
+	wg.Wait()
+
+	if got := emitted.Load(); got != 40 {
+		t.Fatalf("expected 40 results, got %d", got)
+	}
+	if got := peak.Load(); got > 3 {
+		t.Fatalf("expected at most 3 queries in flight, saw %d", got)
+	}
+}
+
+func TestMinRemainingTTL(t *testing.T) {
+	now := time.Now()
+	results := []Result{
+		{CacheTTL: time.Minute, QueriedAt: now.Add(-10 * time.Second)},
+		{CacheTTL: 30 * time.Second, QueriedAt: now.Add(-5 * time.Second)},
+	}
+	if got := MinRemainingTTL(results, now); got != 25*time.Second {
+		t.Fatalf("expected 25s, got %v", got)
+	}
+	results = append(results, Result{CacheTTL: time.Second, QueriedAt: now.Add(-time.Minute)})
+	if got := MinRemainingTTL(results, now); got != 0 {
+		t.Fatalf("expected expired result to yield 0, got %v", got)
+	}
+}
@@ -0,0 +1,150 @@
+package dnsresolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxTraceHops bounds a trace in case nameservers refer in circles.
+const maxTraceHops = 16
+
+// rootHints are a few root server addresses to start a trace from, so tracing does not depend on
+// a recursive resolver answering for ".".
+var rootHints = []TraceServer{
+	{Host: "a.root-servers.net.", Address: "198.41.0.4"},
+	{Host: "k.root-servers.net.", Address: "193.0.14.129"},
+	{Host: "m.root-servers.net.", Address: "202.12.27.33"},
+}
+
+// TraceServer is a nameserver address a trace may ask.
+type TraceServer struct {
+	Host    string `json:"host"`
+	Address string `json:"address"`
+}
+
+// TraceHop is one non-recursive query made while following referrals from the root.
+type TraceHop struct {
+	// Zone is the zone the queried server was expected to be authoritative for.
+	Zone          string   `json:"zone"`
+	Server        string   `json:"server"`
+	Address       string   `json:"address"`
+	Rcode         string   `json:"rcode,omitempty"`
+	RTTMs         float64  `json:"rtt_ms,omitempty"`
+	Authoritative bool     `json:"authoritative"`
+	Answers       []string `json:"answers,omitempty"`
+	// NextZone and Referral are set when the server delegated to a closer zone.
+	NextZone string   `json:"next_zone,omitempty"`
+	Referral []string `json:"referral,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+var errNoReferral = errors.New("trace stopped: no answer and no referral")
+
+// Trace resolves name iteratively like `dig +trace`, starting at the root and following
+// referrals, and hands every hop to emit as it completes. Unreachable servers are emitted with
+// Error set before the next server for the same zone is tried. recursive resolvers are only used
+// to find addresses for nameservers that come without glue.
+func Trace(ctx context.Context, name, qtype string, recursive []string, timeout time.Duration, emit func(TraceHop)) error {
+	name = strings.ToLower(dns.Fqdn(name))
+	qt := mapType(qtype)
+	zone := "."
+	servers := rootHints
+
+	for hop := 0; hop < maxTraceHops; hop++ {
+		var reply *dns.Msg
+		for i, s := range servers {
+			if i == 3 || ctx.Err() != nil {
+				break
+			}
+			r, rtt, err := authoritativeQuery(ctx, s.Address, name, qt, timeout)
+			h := TraceHop{Zone: zone, Server: s.Host, Address: s.Address}
+			if err != nil || r == nil {
+				h.Error = "no reply"
+				if err != nil && isTimeout(err) {
+					h.Error = "timeout"
+				}
+				emit(h)
+				continue
+			}
+			h.Rcode = strings.ToLower(dns.RcodeToString[r.Rcode])
+			h.RTTMs = float64(rtt.Microseconds()) / 1000.0
+			h.Authoritative = r.Authoritative
+			for _, rr := range r.Answer {
+				h.Answers = append(h.Answers, rr.String())
+			}
+			next, hosts := referralFor(r, zone, name)
+			h.NextZone, h.Referral = next, hosts
+			emit(h)
+			reply = r
+			break
+		}
+		if reply == nil {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("trace stopped: no server for %s replied", zone)
+		}
+		if reply.Rcode != dns.RcodeSuccess || len(reply.Answer) > 0 || reply.Authoritative {
+			return nil
+		}
+		next, hosts := referralFor(reply, zone, name)
+		if next == "" {
+			return errNoReferral
+		}
+		zone = next
+		servers = referralServers(ctx, reply, hosts, recursive, timeout)
+		if len(servers) == 0 {
+			return fmt.Errorf("trace stopped: no addresses for the nameservers of %s", zone)
+		}
+	}
+	return fmt.Errorf("trace stopped after %d hops", maxTraceHops)
+}
+
+// referralFor returns the delegated zone and its NS hosts when r refers the query for name to a
+// zone below the current one.
+func referralFor(r *dns.Msg, zone, name string) (string, []string) {
+	for _, rr := range r.Ns {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+		owner := strings.ToLower(ns.Hdr.Name)
+		if owner != zone && dns.IsSubDomain(zone, owner) && dns.IsSubDomain(owner, name) {
+			return owner, nsHosts(r.Ns, owner)
+		}
+	}
+	return "", nil
+}
+
+// referralServers pairs each referred host with its glue, resolving hosts without glue through
+// the recursive resolvers only when no glue was supplied at all.
+func referralServers(ctx context.Context, r *dns.Msg, hosts, recursive []string, timeout time.Duration) []TraceServer {
+	var out []TraceServer
+	for _, host := range hosts {
+		for _, addr := range addrsFor(r.Extra, host) {
+			out = append(out, TraceServer{Host: host, Address: addr})
+		}
+	}
+	if len(out) > 0 {
+		// Try IPv4 first; IPv6 glue is often unreachable from containers.
+		sort.SliceStable(out, func(i, j int) bool {
+			return !strings.Contains(out[i].Address, ":") && strings.Contains(out[j].Address, ":")
+		})
+		return out
+	}
+	for _, host := range hosts {
+		for _, addr := range lookupAddrs(ctx, recursive, host, timeout) {
+			out = append(out, TraceServer{Host: host, Address: addr})
+		}
+		if len(out) >= 3 {
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,56 @@
+package dnsresolver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTrace_FollowsReferrals(t *testing.T) {
+	fakeDNS{
+		"198.41.0.4:53": {"www.example.com. A": {
+			ns:    []string{"com. 172800 IN NS a.gtld-servers.net."},
+			extra: []string{"a.gtld-servers.net. 172800 IN A 192.0.2.10"},
+		}},
+		"192.0.2.10:53": {"www.example.com. A": {
+			ns:    []string{"example.com. 172800 IN NS ns1.example.com.", "example.com. 172800 IN NS ns2.example.com."},
+			extra: []string{"ns1.example.com. 172800 IN A 192.0.2.20", "ns2.example.com. 172800 IN AAAA 2001:db8::20"},
+		}},
+		"192.0.2.20:53": {"www.example.com. A": {aa: true, answer: []string{"www.example.com. 300 IN A 192.0.2.80"}}},
+	}.install(t)
+
+	var hops []TraceHop
+	err := Trace(context.Background(), "www.example.com", "A", nil, time.Second, func(h TraceHop) { hops = append(hops, h) })
+	if err != nil {
+		t.Fatalf("Trace: %v", err)
+	}
+	if len(hops) != 3 {
+		t.Fatalf("expected 3 hops, got %+v", hops)
+	}
+	wantZones := []string{".", "com.", "example.com."}
+	for i, h := range hops {
+		if h.Zone != wantZones[i] || h.Error != "" {
+			t.Fatalf("hop %d: %+v", i, h)
+		}
+	}
+	if hops[1].NextZone != "example.com." || len(hops[1].Referral) != 2 {
+		t.Fatalf("expected referral to example.com., got %+v", hops[1])
+	}
+	if !hops[2].Authoritative || len(hops[2].Answers) != 1 {
+		t.Fatalf("expected authoritative answer, got %+v", hops[2])
+	}
+}
+
+func TestTrace_SkipsUnreachableRoots(t *testing.T) {
+	fakeDNS{
+		"193.0.14.129:53": {"example.com. A": {rcode: 3}},
+	}.install(t)
+
+	var hops []TraceHop
+	if err := Trace(context.Background(), "example.com", "A", nil, time.Second, func(h TraceHop) { hops = append(hops, h) }); err != nil {
+		t.Fatalf("Trace: %v", err)
+	}
+	if len(hops) != 2 || hops[0].Error == "" || hops[1].Rcode != "nxdomain" {
+		t.Fatalf("expected a failed root then nxdomain, got %+v", hops)
+	}
+}
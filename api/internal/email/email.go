@@ -0,0 +1,170 @@
+// Package email sends monitor alerts and a daily digest over SMTP, rendered from HTML and text
+// templates.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options configure a Mailer.
+type Options struct {
+	Host     string
+	Port     int
+	Username string // empty skips authentication
+	Password string
+	// StartTLS requires the server to upgrade the connection before authenticating or sending.
+	StartTLS bool
+	From     string
+	To       []string
+	Timeout  time.Duration
+}
+
+// Message is one email with a plain text and an HTML alternative.
+type Message struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer sends messages from and to the configured addresses.
+type Mailer struct {
+	opts Options
+	// tlsConfig overrides the STARTTLS settings; tests use it to trust a local sink.
+	tlsConfig *tls.Config
+}
+
+func NewMailer(opts Options) *Mailer {
+	return &Mailer{opts: opts}
+}
+
+// Send delivers msg to every recipient in one SMTP transaction.
+func (m *Mailer) Send(ctx context.Context, msg Message) error {
+	body, err := m.build(msg, time.Now())
+	if err != nil {
+		return err
+	}
+	d := net.Dialer{Timeout: m.opts.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(m.opts.Host, strconv.Itoa(m.opts.Port)))
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(m.opts.Timeout))
+	c, err := smtp.NewClient(conn, m.opts.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if m.opts.StartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		cfg := m.tlsConfig
+		if cfg == nil {
+			cfg = &tls.Config{ServerName: m.opts.Host}
+		}
+		if err := c.StartTLS(cfg); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if m.opts.Username != "" {
+		// PlainAuth refuses to send credentials over an unencrypted connection to a remote host.
+		if err := c.Auth(smtp.PlainAuth("", m.opts.Username, m.opts.Password, m.opts.Host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err := c.Mail(m.opts.From); err != nil {
+		return err
+	}
+	for _, to := range m.opts.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("rcpt %s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// build renders msg as a multipart/alternative MIME message.
+func (m *Mailer) build(msg Message, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	domain := "dnsprop"
+	if at := strings.LastIndex(m.opts.From, "@"); at >= 0 {
+		domain = m.opts.From[at+1:]
+	}
+
+	h := []string{
+		"From: " + m.opts.From,
+		"To: " + strings.Join(m.opts.To, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date: " + now.Format(time.RFC1123Z),
+		"Message-ID: <" + id + "@" + domain + ">",
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + mw.Boundary(),
+	}
+	var out bytes.Buffer
+	out.WriteString(strings.Join(h, "\r\n") + "\r\n\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(pw)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	out.Write(buf.Bytes())
+	return out.Bytes(), nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
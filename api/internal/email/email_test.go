@@ -0,0 +1,206 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// received is one mail transaction seen by the sink.
+type received struct {
+	tls  bool
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// smtpSink is a minimal local SMTP server. With tlsConfig set it offers STARTTLS and AUTH PLAIN.
+func smtpSink(t *testing.T, tlsConfig *tls.Config) (port int, mails <-chan received) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	ch := make(chan received, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, tlsConfig, ch)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, ch
+}
+
+func serveSMTP(conn net.Conn, tlsConfig *tls.Config, out chan<- received) {
+	defer conn.Close()
+	var (
+		r   = bufio.NewReader(conn)
+		cur received
+	)
+	reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+	reply("220 sink ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO":
+			if tlsConfig != nil && !cur.tls {
+				reply("250-sink")
+				reply("250-STARTTLS")
+				reply("250 AUTH PLAIN")
+			} else if tlsConfig != nil {
+				reply("250-sink")
+				reply("250 AUTH PLAIN")
+			} else {
+				reply("250 sink")
+			}
+		case "STARTTLS":
+			reply("220 ready")
+			tc := tls.Server(conn, tlsConfig)
+			if err := tc.Handshake(); err != nil {
+				return
+			}
+			conn, r, cur.tls = tc, bufio.NewReader(tc), true
+		case "AUTH":
+			fields := strings.Fields(line)
+			b, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+			cur.auth = string(b)
+			reply("235 ok")
+		case "MAIL":
+			cur.from = strings.Trim(strings.TrimPrefix(line[len("MAIL FROM:"):], " "), "<>")
+			reply("250 ok")
+		case "RCPT":
+			cur.to = append(cur.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			cur.data = data.String()
+			out <- cur
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// selfSigned returns a server config for 127.0.0.1 and a client config that trusts it.
+func selfSigned(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sink"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		&tls.Config{ServerName: "127.0.0.1", RootCAs: pool}
+}
+
+// parts parses a received message into its subject and its text and HTML bodies.
+func parts(t *testing.T, data string) (subject, text, html string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, _ = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart() // decodes quoted-printable
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(p)
+		if strings.HasPrefix(p.Header.Get("Content-Type"), "text/html") {
+			html = string(b)
+		} else {
+			text = string(b)
+		}
+	}
+}
+
+func TestMailer_StartTLSAuth(t *testing.T) {
+	server, client := selfSigned(t)
+	port, mails := smtpSink(t, server)
+	m := NewMailer(Options{Host: "127.0.0.1", Port: port, Username: "user", Password: "pass", StartTLS: true,
+		From: "dnsprop@example.com", To: []string{"ops@example.com", "dev@example.com"}, Timeout: 5 * time.Second})
+	m.tlsConfig = client
+
+	long := strings.Repeat("propagation ", 20) // longer than a quoted-printable line
+	if err := m.Send(context.Background(), Message{Subject: "Ünïcode subject", Text: ".leading dot\n" + long, HTML: "<p>hi</p>"}); err != nil {
+		t.Fatal(err)
+	}
+	got := <-mails
+	if !got.tls || got.auth != "\x00user\x00pass" || got.from != "dnsprop@example.com" || strings.Join(got.to, ",") != "ops@example.com,dev@example.com" {
+		t.Fatalf("unexpected transaction: %+v", got)
+	}
+	subject, text, html := parts(t, got.data)
+	if subject != "Ünïcode subject" || strings.ReplaceAll(text, "\r\n", "\n") != ".leading dot\n"+long || html != "<p>hi</p>" {
+		t.Fatalf("unexpected message: %q %q %q", subject, text, html)
+	}
+}
+
+func TestMailer_RequiresStartTLS(t *testing.T) {
+	port, _ := smtpSink(t, nil)
+	m := NewMailer(Options{Host: "127.0.0.1", Port: port, StartTLS: true, From: "a@example.com", To: []string{"b@example.com"}, Timeout: 5 * time.Second})
+	if err := m.Send(context.Background(), Message{Subject: "x"}); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expected a STARTTLS error, got %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	htmltemplate "html/template"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/legertom/dnsprop/api/internal/monitor"
+)
+
+// digestWindow is the period a digest summarizes.
+const digestWindow = 24 * time.Hour
+
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	funcs = map[string]any{
+		"join":  strings.Join,
+		"ts":    func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 MST") },
+		"color": stateColor,
+	}
+	textTemplates = texttemplate.Must(texttemplate.New("").Funcs(funcs).ParseFS(templateFS, "templates/*.txt.tmpl"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.New("").Funcs(funcs).ParseFS(templateFS, "templates/*.html.tmpl"))
+)
+
+// Sender delivers a message; *Mailer is the SMTP implementation.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Monitors is the part of *monitor.Manager the digest reads.
+type Monitors interface {
+	List(ctx context.Context) ([]monitor.Monitor, error)
+	Results(ctx context.Context, id string, limit int) ([]monitor.Result, error)
+}
+
+// Notifier emails an alert whenever a monitor changes state, and a digest of all monitors once a
+// day. Alerts are sent from their own goroutine so a slow mail server does not delay checks.
+type Notifier struct {
+	sender   Sender
+	monitors Monitors
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewNotifier(sender Sender, monitors Monitors) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Notifier{sender: sender, monitors: monitors, ctx: ctx, cancel: cancel}
+}
+
+// HandleMonitorEvent is a monitor.Listener. Like webhooks, it stays quiet on a monitor's first
+// check after it is created or updated.
+func (n *Notifier) HandleMonitorEvent(_ context.Context, e monitor.Event) {
+	if !e.Changed() || e.Previous.State == monitor.StatePending {
+		return
+	}
+	msg, err := alertMessage(e)
+	if err != nil {
+		slog.Warn("email_render_failed", slog.String("monitor", e.Monitor.ID), slog.String("error", err.Error()))
+		return
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		if err := n.sender.Send(n.ctx, msg); err != nil {
+			slog.Warn("email_alert_failed", slog.String("monitor", e.Monitor.ID), slog.String("error", err.Error()))
+		}
+	}()
+}
+
+// SendDigest emails the status of every monitor over the day before now.
+func (n *Notifier) SendDigest(ctx context.Context, now time.Time) error {
+	msg, err := n.digestMessage(ctx, now)
+	if err != nil {
+		return err
+	}
+	return n.sender.Send(ctx, msg)
+}
+
+// StartDigests sends a digest every day at the given offset from midnight UTC until Close is
+// called.
+func (n *Notifier) StartDigests(at time.Duration) {
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		for {
+			now := time.Now().UTC()
+			next := now.Truncate(24 * time.Hour).Add(at)
+			if !next.After(now) {
+				next = next.Add(24 * time.Hour)
+			}
+			t := time.NewTimer(next.Sub(now))
+			select {
+			case <-n.ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+			if err := n.SendDigest(n.ctx, time.Now().UTC()); err != nil {
+				slog.Warn("email_digest_failed", slog.String("error", err.Error()))
+			}
+		}
+	}()
+}
+
+// Close stops the digest loop and waits for alerts being sent.
+func (n *Notifier) Close() {
+	n.cancel()
+	n.wg.Wait()
+}
+
+type alertData struct {
+	Name, Type            string
+	State, PreviousState  string
+	CheckedAt             time.Time
+	Agreeing, Unreachable int
+	Total, Percent        int
+	Expected              []string
+	Servers               []monitor.ServerResult
+}
+
+// DigestRow is one monitor in a digest.
+type DigestRow struct {
+	Name, Type            string
+	State                 string
+	Since                 time.Time
+	Agreeing, Unreachable int
+	Total, Percent        int
+	// Over the digest window
+	Checks, OKPercent, Changes int
+}
+
+type digestData struct {
+	Since, GeneratedAt             time.Time
+	Monitors                       []DigestRow
+	OK, Mismatch, Failing, Pending int
+}
+
+func alertMessage(e monitor.Event) (Message, error) {
+	data := alertData{
+		Name:          e.Monitor.Spec.Name,
+		Type:          e.Monitor.Spec.Type,
+		State:         e.Monitor.Status.State,
+		PreviousState: e.Previous.State,
+		CheckedAt:     e.Result.CheckedAt,
+		Agreeing:      e.Result.Agreeing,
+		Unreachable:   e.Result.Unreachable,
+		Total:         e.Result.Total,
+		Percent:       percent(e.Result.Agreeing, e.Result.Total),
+		Expected:      e.Monitor.Spec.Expected,
+		Servers:       e.Result.Servers,
+	}
+	subject := "[dnsprop] " + data.Name + " " + data.Type + " is " + data.State
+	return render("alert", subject, data)
+}
+
+func (n *Notifier) digestMessage(ctx context.Context, now time.Time) (Message, error) {
+	mons, err := n.monitors.List(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+	data := digestData{Since: now.Add(-digestWindow), GeneratedAt: now, Monitors: make([]DigestRow, 0, len(mons))}
+	for _, m := range mons {
+		row := DigestRow{
+			Name:        m.Spec.Name,
+			Type:        m.Spec.Type,
+			State:       m.Status.State,
+			Since:       m.Status.Since,
+			Agreeing:    m.Status.Agreeing,
+			Unreachable: m.Status.Unreachable,
+			Total:       m.Status.Total,
+			Percent:     percent(m.Status.Agreeing, m.Status.Total),
+		}
+		// Enough results to cover the window at the monitor's interval, plus one from before it
+		// to tell whether the first check in the window changed state.
+		limit := 2
+		if m.Spec.Interval > 0 {
+			limit += int(digestWindow / m.Spec.Interval)
+		}
+		results, err := n.monitors.Results(ctx, m.ID, limit)
+		if err != nil {
+			return Message{}, err
+		}
+		ok, prev := 0, ""
+		for i := len(results) - 1; i >= 0; i-- { // oldest first
+			r := results[i]
+			if r.CheckedAt.Before(data.Since) {
+				prev = r.State
+				continue
+			}
+			row.Checks++
+			if r.State == monitor.StateOK {
+				ok++
+			}
+			if prev != "" && r.State != prev {
+				row.Changes++
+			}
+			prev = r.State
+		}
+		row.OKPercent = percent(ok, row.Checks)
+		data.Monitors = append(data.Monitors, row)
+
+		switch m.Status.State {
+		case monitor.StateOK:
+			data.OK++
+		case monitor.StateMismatch:
+			data.Mismatch++
+		case monitor.StateFailing:
+			data.Failing++
+		default:
+			data.Pending++
+		}
+	}
+	subject := "[dnsprop] Daily digest: " + strings.Join(digestCounts(data), ", ")
+	return render("digest", subject, data)
+}
+
+// digestCounts lists the non-zero state counts for the digest subject.
+func digestCounts(d digestData) []string {
+	var out []string
+	for _, c := range []struct {
+		n     int
+		label string
+	}{{d.OK, "ok"}, {d.Mismatch, "mismatch"}, {d.Failing, "failing"}, {d.Pending, "pending"}} {
+		if c.n > 0 {
+			out = append(out, strconv.Itoa(c.n)+" "+c.label)
+		}
+	}
+	if len(out) == 0 {
+		return []string{"no monitors"}
+	}
+	return out
+}
+
+func render(name, subject string, data any) (Message, error) {
+	var text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&text, name+".txt.tmpl", data); err != nil {
+		return Message{}, err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, name+".html.tmpl", data); err != nil {
+		return Message{}, err
+	}
+	return Message{Subject: subject, Text: text.String(), HTML: html.String()}, nil
+}
+
+func stateColor(state string) string {
+	switch state {
+	case monitor.StateOK:
+		return "#2eb886"
+	case monitor.StateMismatch:
+		return "#daa038"
+	case monitor.StateFailing:
+		return "#a30200"
+	}
+	return "#6b7280"
+}
+
+func percent(n, total int) int {
+	if total == 0 {
+		return 0
+	}
+	return n * 100 / total
+}
@@ -0,0 +1,126 @@
+package email
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/legertom/dnsprop/api/internal/monitor"
+)
+
+type fakeMonitors struct {
+	mons    []monitor.Monitor
+	results map[string][]monitor.Result // newest first
+}
+
+func (f fakeMonitors) List(context.Context) ([]monitor.Monitor, error) { return f.mons, nil }
+
+func (f fakeMonitors) Results(_ context.Context, id string, limit int) ([]monitor.Result, error) {
+	r := f.results[id]
+	if len(r) > limit {
+		r = r[:limit]
+	}
+	return r, nil
+}
+
+type captureSender chan Message
+
+func (c captureSender) Send(_ context.Context, msg Message) error {
+	c <- msg
+	return nil
+}
+
+func TestNotifier_AlertOverSMTP(t *testing.T) {
+	port, mails := smtpSink(t, nil)
+	m := NewMailer(Options{Host: "127.0.0.1", Port: port, From: "dnsprop@example.com", To: []string{"ops@example.com"}, Timeout: 5 * time.Second})
+	n := NewNotifier(m, fakeMonitors{})
+	defer n.Close()
+
+	e := monitor.Event{
+		Monitor: monitor.Monitor{
+			ID:     "m1",
+			Spec:   monitor.Spec{Name: "example.com", Type: "MX", Expected: []string{"10 mx.example.com."}},
+			Status: monitor.Status{State: monitor.StateMismatch},
+		},
+		Previous: monitor.Status{State: monitor.StateOK},
+		Result: monitor.Result{CheckedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), Agreeing: 1, Unreachable: 1, Total: 3, Servers: []monitor.ServerResult{
+			{Server: "1.1.1.1", Status: "ok", Answers: []string{"10 mx.example.com."}},
+			{Server: "8.8.8.8", Status: "ok", Answers: []string{"10 <old>.example.com."}},
+			{Server: "9.9.9.9", Status: "timeout"},
+		}},
+	}
+	first := e
+	first.Previous = monitor.Status{State: monitor.StatePending}
+	n.HandleMonitorEvent(context.Background(), first) // first check: no alert
+	unchanged := e
+	unchanged.Previous = monitor.Status{State: monitor.StateMismatch}
+	n.HandleMonitorEvent(context.Background(), unchanged)
+	n.HandleMonitorEvent(context.Background(), e)
+
+	got := <-mails
+	subject, text, html := parts(t, got.data)
+	if subject != "[dnsprop] example.com MX is mismatch" {
+		t.Fatalf("unexpected subject %q", subject)
+	}
+	for _, want := range []string{"is now mismatch (was ok)", "1 of 3 resolvers agree (33%), 1 unreachable", "Expected: 10 mx.example.com.", "9.9.9.9            timeout   -"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("text is missing %q:\n%s", want, text)
+		}
+	}
+	if !strings.Contains(html, "10 &lt;old&gt;.example.com.") || !strings.Contains(html, "color: #daa038") {
+		t.Fatalf("unexpected html:\n%s", html)
+	}
+	n.Close()
+	select {
+	case extra := <-mails:
+		t.Fatalf("expected a single alert, got another: %+v", extra)
+	default:
+	}
+}
+
+func TestNotifier_Digest(t *testing.T) {
+	now := time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC)
+	at := func(h int) time.Time { return now.Add(time.Duration(-h) * time.Hour) }
+	monitors := fakeMonitors{
+		mons: []monitor.Monitor{
+			{ID: "a", Spec: monitor.Spec{Name: "example.com", Type: "A", Interval: 6 * time.Hour},
+				Status: monitor.Status{State: monitor.StateOK, Since: at(6), Agreeing: 4, Total: 4}},
+			{ID: "b", Spec: monitor.Spec{Name: "example.org", Type: "TXT", Interval: time.Hour},
+				Status: monitor.Status{State: monitor.StateFailing, Since: at(1), Unreachable: 2, Total: 2}},
+		},
+		results: map[string][]monitor.Result{
+			"a": {
+				{State: monitor.StateOK, CheckedAt: at(0)},
+				{State: monitor.StateOK, CheckedAt: at(6)},
+				{State: monitor.StateMismatch, CheckedAt: at(12)},
+				{State: monitor.StateMismatch, CheckedAt: at(18)},
+				{State: monitor.StateOK, CheckedAt: at(30)}, // before the window
+			},
+		},
+	}
+	sent := make(captureSender, 1)
+	n := NewNotifier(sent, monitors)
+	defer n.Close()
+	if err := n.SendDigest(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-sent
+	if msg.Subject != "[dnsprop] Daily digest: 1 ok, 1 failing" {
+		t.Fatalf("unexpected subject %q", msg.Subject)
+	}
+	for _, want := range []string{
+		"2 monitored records, 2024-01-01 08:00 UTC to 2024-01-02 08:00 UTC",
+		"1 ok, 0 mismatch, 1 failing, 0 pending",
+		"example.com A: ok since 2024-01-02 02:00 UTC\n  now 4/4 resolvers agree (100%), 0 unreachable\n  last 24h: 4 checks, 50% ok, 2 state changes",
+		"example.org TXT: failing since 2024-01-02 07:00 UTC",
+		"last 24h: 0 checks, 0% ok, 0 state changes",
+	} {
+		if !strings.Contains(msg.Text, want) {
+			t.Fatalf("digest is missing %q:\n%s", want, msg.Text)
+		}
+	}
+	if !strings.Contains(msg.HTML, "<td>example.org TXT</td>") {
+		t.Fatalf("unexpected html:\n%s", msg.HTML)
+	}
+}
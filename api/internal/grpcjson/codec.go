@@ -0,0 +1,23 @@
+// Package grpcjson is a gRPC codec that marshals messages as JSON. The service has no protobuf
+// definitions; its messages are the same Go structs and JSON shapes as the HTTP API.
+package grpcjson
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// Name is the codec name, used as the gRPC content-subtype ("application/grpc+json").
+const Name = "json"
+
+// Codec implements encoding.Codec.
+type Codec struct{}
+
+func (Codec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (Codec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (Codec) Name() string                       { return Name }
+
+func init() {
+	encoding.RegisterCodec(Codec{})
+}
@@ -0,0 +1,170 @@
+// Package history persists completed resolve checks so they can be listed and revisited.
+package history
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pagination bounds for List.
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+var (
+	ErrNotFound      = errors.New("check not found")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// ImportSource starts the Source of every check imported from a bundle. Imports carry observations
+// this server did not make, so List only returns them when asked and Range never does.
+const ImportSource = "import"
+
+// Check is one stored resolve request and its response.
+type Check struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Servers []string `json:"servers"`
+	DNSSEC  bool     `json:"dnssec"`
+	// Source is the entry point that ran the check, e.g. "resolve" or "grpc".
+	Source     string    `json:"source"`
+	RequestID  string    `json:"request_id,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Response is the v1 ResolveResponse JSON as it was returned.
+	Response json.RawMessage `json:"response"`
+}
+
+// ListQuery selects checks for one name, newest first. Type is optional. Imported selects only
+// imported checks instead of the checks this server ran.
+type ListQuery struct {
+	Name     string
+	Type     string
+	Imported bool
+	Limit    int
+	Cursor   string
+}
+
+// RangeQuery selects the newest Limit checks for one name and type created in [Since, Until),
+// leaving out imported checks. A zero Since or Until leaves that end open.
+type RangeQuery struct {
+	Name  string
+	Type  string
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+// Page is one page of List results. NextCursor is empty on the last page.
+type Page struct {
+	Checks     []Check `json:"checks"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// Store records and lists checks. Implementations are safe for concurrent use.
+type Store interface {
+	// Add stores c, assigning ID and CreatedAt when they are empty.
+	Add(ctx context.Context, c *Check) error
+	// Get returns the check with id, or ErrNotFound.
+	Get(ctx context.Context, id string) (Check, error)
+	List(ctx context.Context, q ListQuery) (Page, error)
+	// Range returns the checks selected by q, oldest first.
+	Range(ctx context.Context, q RangeQuery) ([]Check, error)
+	// DeleteBefore removes checks created before t and returns how many were removed.
+	DeleteBefore(ctx context.Context, t time.Time) (int64, error)
+	// DeleteSourceBefore removes checks whose Source starts with prefix created before t and
+	// returns how many were removed.
+	DeleteSourceBefore(ctx context.Context, prefix string, t time.Time) (int64, error)
+	Close() error
+}
+
+// NewID returns a random, unguessable check ID.
+func NewID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ValidID reports whether id has the shape NewID produces, so malformed IDs can be rejected
+// without a lookup.
+func ValidID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// Expire deletes checks older than maxAge every interval until ctx is done.
+func Expire(ctx context.Context, s Store, maxAge, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if n, err := s.DeleteBefore(ctx, time.Now().Add(-maxAge)); err != nil {
+			slog.WarnContext(ctx, "history_expire_failed", slog.String("error", err.Error()))
+		} else if n > 0 {
+			slog.InfoContext(ctx, "history_expired", slog.Int64("deleted", n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// prepare fills in the fields Add assigns.
+func prepare(c *Check) {
+	if c.ID == "" {
+		c.ID = NewID()
+	}
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now()
+	}
+	c.CreatedAt = c.CreatedAt.UTC()
+}
+
+// clampLimit applies the default and maximum page size.
+func clampLimit(n int) int {
+	switch {
+	case n <= 0:
+		return DefaultLimit
+	case n > MaxLimit:
+		return MaxLimit
+	}
+	return n
+}
+
+// A cursor is the (created_at, id) position of the last check on the previous page, so pages stay
+// stable while new checks are added.
+func encodeCursor(c Check) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", c.CreatedAt.UnixNano(), c.ID)))
+}
+
+func decodeCursor(s string) (int64, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return 0, "", ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	return n, id, nil
+}
@@ -0,0 +1,200 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS checks (
+	id          TEXT PRIMARY KEY,
+	name        TEXT NOT NULL,
+	type        TEXT NOT NULL,
+	servers     TEXT NOT NULL,
+	dnssec      INTEGER NOT NULL,
+	source      TEXT NOT NULL,
+	request_id  TEXT NOT NULL,
+	user_agent  TEXT NOT NULL,
+	duration_ms REAL NOT NULL,
+	created_at  INTEGER NOT NULL,
+	response    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS checks_name_created ON checks (name, created_at DESC, id DESC);
+`
+
+// SQLiteStore is a Store backed by a SQLite database file.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens (creating if needed) the database at path. ":memory:" gives a private
+// in-memory database, which is useful in tests.
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time, and each connection to ":memory:" is its own database.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("history schema: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Add(ctx context.Context, c *Check) error {
+	prepare(c)
+	servers, err := json.Marshal(c.Servers)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO checks
+		(id, name, type, servers, dnssec, source, request_id, user_agent, duration_ms, created_at, response)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, c.Name, c.Type, string(servers), c.DNSSEC, c.Source, c.RequestID, c.UserAgent,
+		c.DurationMs, c.CreatedAt.UnixNano(), string(c.Response))
+	return err
+}
+
+func (s *SQLiteStore) Get(ctx context.Context, id string) (Check, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT
+		id, name, type, servers, dnssec, source, request_id, user_agent, duration_ms, created_at, response
+		FROM checks WHERE id = ?`, id)
+	c, err := scanCheck(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Check{}, ErrNotFound
+	}
+	return c, err
+}
+
+func (s *SQLiteStore) List(ctx context.Context, q ListQuery) (Page, error) {
+	limit := clampLimit(q.Limit)
+	where, args := "name = ?", []any{q.Name}
+	if q.Imported {
+		where += " AND substr(source, 1, ?) = ?"
+	} else {
+		where += " AND substr(source, 1, ?) != ?"
+	}
+	args = append(args, len(ImportSource), ImportSource)
+	if q.Type != "" {
+		where += " AND type = ?"
+		args = append(args, q.Type)
+	}
+	if q.Cursor != "" {
+		at, id, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		where += " AND (created_at < ? OR (created_at = ? AND id < ?))"
+		args = append(args, at, at, id)
+	}
+	// Fetch one extra row to learn whether there is a next page.
+	args = append(args, limit+1)
+	rows, err := s.db.QueryContext(ctx, `SELECT
+		id, name, type, servers, dnssec, source, request_id, user_agent, duration_ms, created_at, response
+		FROM checks WHERE `+where+` ORDER BY created_at DESC, id DESC LIMIT ?`, args...)
+	if err != nil {
+		return Page{}, err
+	}
+	defer rows.Close()
+
+	page := Page{Checks: []Check{}}
+	for rows.Next() {
+		c, err := scanCheck(rows)
+		if err != nil {
+			return Page{}, err
+		}
+		page.Checks = append(page.Checks, c)
+	}
+	if err := rows.Err(); err != nil {
+		return Page{}, err
+	}
+	if len(page.Checks) > limit {
+		page.Checks = page.Checks[:limit]
+		page.NextCursor = encodeCursor(page.Checks[limit-1])
+	}
+	return page, nil
+}
+
+func (s *SQLiteStore) Range(ctx context.Context, q RangeQuery) ([]Check, error) {
+	where, args := "name = ? AND type = ? AND substr(source, 1, ?) != ?", []any{q.Name, q.Type, len(ImportSource), ImportSource}
+	if !q.Since.IsZero() {
+		where += " AND created_at >= ?"
+		args = append(args, q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		where += " AND created_at < ?"
+		args = append(args, q.Until.UnixNano())
+	}
+	args = append(args, q.Limit)
+	rows, err := s.db.QueryContext(ctx, `SELECT
+		id, name, type, servers, dnssec, source, request_id, user_agent, duration_ms, created_at, response
+		FROM checks WHERE `+where+` ORDER BY created_at DESC, id DESC LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Check
+	for rows.Next() {
+		c, err := scanCheck(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.Reverse(out)
+	return out, nil
+}
+
+func (s *SQLiteStore) DeleteBefore(ctx context.Context, t time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM checks WHERE created_at < ?`, t.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLiteStore) DeleteSourceBefore(ctx context.Context, prefix string, t time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM checks WHERE created_at < ? AND substr(source, 1, ?) = ?`,
+		t.UnixNano(), len(prefix), prefix)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func scanCheck(row interface{ Scan(...any) error }) (Check, error) {
+	var (
+		c        Check
+		servers  string
+		created  int64
+		response string
+	)
+	err := row.Scan(&c.ID, &c.Name, &c.Type, &servers, &c.DNSSEC, &c.Source, &c.RequestID, &c.UserAgent,
+		&c.DurationMs, &created, &response)
+	if err != nil {
+		return Check{}, err
+	}
+	if err := json.Unmarshal([]byte(servers), &c.Servers); err != nil {
+		return Check{}, fmt.Errorf("check %s: servers: %w", c.ID, err)
+	}
+	c.CreatedAt = time.Unix(0, created).UTC()
+	c.Response = json.RawMessage(response)
+	return c, nil
+}
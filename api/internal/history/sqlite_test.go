@@ -0,0 +1,181 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	s, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLiteStore_AddList(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		c := &Check{Name: "example.com", Type: "A", Servers: []string{"1.1.1.1"}, Source: "resolve",
+			CreatedAt: base.Add(time.Duration(i) * time.Minute), Response: json.RawMessage(`{"n":` + strconv.Itoa(i) + `}`)}
+		if err := s.Add(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+		if len(c.ID) != 32 {
+			t.Fatalf("expected a 32-char ID, got %q", c.ID)
+		}
+	}
+	s.Add(ctx, &Check{Name: "example.com", Type: "MX", Source: "resolve", Response: json.RawMessage(`{}`)})
+	s.Add(ctx, &Check{Name: "example.org", Type: "A", Source: "resolve", Response: json.RawMessage(`{}`)})
+
+	var seen []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		page, err := s.List(ctx, ListQuery{Name: "example.com", Type: "A", Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range page.Checks {
+			seen = append(seen, string(c.Response))
+		}
+		if page.NextCursor == "" {
+			if pages != 2 {
+				t.Fatalf("expected 3 pages, got %d", pages+1)
+			}
+			break
+		}
+		cursor = page.NextCursor
+	}
+	want := []string{`{"n":4}`, `{"n":3}`, `{"n":2}`, `{"n":1}`, `{"n":0}`}
+	if len(seen) != len(want) {
+		t.Fatalf("expected %v, got %v", want, seen)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("expected newest first %v, got %v", want, seen)
+		}
+	}
+
+	all, _ := s.List(ctx, ListQuery{Name: "example.com"})
+	if len(all.Checks) != 6 || all.Checks[0].Type != "MX" || all.Checks[1].Servers[0] != "1.1.1.1" {
+		t.Fatalf("unexpected unfiltered list: %+v", all.Checks)
+	}
+}
+
+func TestSQLiteStore_InvalidCursor(t *testing.T) {
+	s := openTestStore(t)
+	if _, err := s.List(context.Background(), ListQuery{Name: "example.com", Cursor: "!!"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestSQLiteStore_GetDeleteBefore(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	old := &Check{Name: "example.com", Type: "A", Source: "resolve", CreatedAt: now.Add(-2 * time.Hour), Response: json.RawMessage(`{}`)}
+	fresh := &Check{Name: "example.com", Type: "A", Source: "resolve", CreatedAt: now, Response: json.RawMessage(`{"n":1}`)}
+	s.Add(ctx, old)
+	s.Add(ctx, fresh)
+
+	got, err := s.Get(ctx, fresh.ID)
+	if err != nil || got.ID != fresh.ID || string(got.Response) != `{"n":1}` {
+		t.Fatalf("unexpected Get: %+v, %v", got, err)
+	}
+	if n, err := s.DeleteBefore(ctx, now.Add(-time.Hour)); err != nil || n != 1 {
+		t.Fatalf("expected 1 deletion, got %d, %v", n, err)
+	}
+	if _, err := s.Get(ctx, old.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for the deleted check, got %v", err)
+	}
+	if _, err := s.Get(ctx, fresh.ID); err != nil {
+		t.Fatalf("expected the newer check to remain, got %v", err)
+	}
+}
+
+func TestSQLiteStore_DeleteSourceBefore(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+	old := time.Now().Add(-2 * time.Hour)
+	for _, source := range []string{"monitor abc", "monitor def", "resolve", "monitoring"} {
+		s.Add(ctx, &Check{Name: "example.com", Type: "A", Source: source, CreatedAt: old, Response: json.RawMessage(`{}`)})
+	}
+	s.Add(ctx, &Check{Name: "example.com", Type: "A", Source: "monitor abc", Response: json.RawMessage(`{}`)})
+
+	if n, err := s.DeleteSourceBefore(ctx, "monitor ", time.Now().Add(-time.Hour)); err != nil || n != 2 {
+		t.Fatalf("expected 2 deletions, got %d, %v", n, err)
+	}
+	if page, _ := s.List(ctx, ListQuery{Name: "example.com", Type: "A", Limit: 10}); len(page.Checks) != 3 {
+		t.Fatalf("expected the other sources and the recent check to remain, got %+v", page.Checks)
+	}
+}
+
+func TestSQLiteStore_KeepsImportsApart(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+	for _, source := range []string{"resolve", ImportSource, ImportSource + " abc (2024-01-01T00:00:00Z)"} {
+		s.Add(ctx, &Check{Name: "example.com", Type: "A", Source: source, Response: json.RawMessage(`{}`)})
+	}
+
+	if page, _ := s.List(ctx, ListQuery{Name: "example.com"}); len(page.Checks) != 1 || page.Checks[0].Source != "resolve" {
+		t.Fatalf("expected List to leave out imports, got %+v", page.Checks)
+	}
+	if page, _ := s.List(ctx, ListQuery{Name: "example.com", Imported: true}); len(page.Checks) != 2 {
+		t.Fatalf("expected both imports with Imported set, got %+v", page.Checks)
+	}
+	if checks, _ := s.Range(ctx, RangeQuery{Name: "example.com", Type: "A", Limit: 10}); len(checks) != 1 || checks[0].Source != "resolve" {
+		t.Fatalf("expected Range to leave out imports, got %+v", checks)
+	}
+}
+
+func TestSQLiteStore_Range(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		s.Add(ctx, &Check{Name: "example.com", Type: "A", Source: "resolve",
+			CreatedAt: base.Add(time.Duration(i) * time.Minute), Response: json.RawMessage(`{"n":` + strconv.Itoa(i) + `}`)})
+	}
+	s.Add(ctx, &Check{Name: "example.com", Type: "MX", Source: "resolve", CreatedAt: base, Response: json.RawMessage(`{}`)})
+
+	got, err := s.Range(ctx, RangeQuery{Name: "example.com", Type: "A", Since: base.Add(time.Minute), Until: base.Add(4 * time.Minute), Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The newest two of minutes 1-3, oldest first.
+	if len(got) != 2 || string(got[0].Response) != `{"n":2}` || string(got[1].Response) != `{"n":3}` {
+		t.Fatalf("unexpected range: %+v", got)
+	}
+	if all, _ := s.Range(ctx, RangeQuery{Name: "example.com", Type: "A", Limit: 10}); len(all) != 5 {
+		t.Fatalf("expected an open range to return all 5 checks, got %d", len(all))
+	}
+}
+
+func TestSQLiteStore_PersistsAcrossOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	s, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add(context.Background(), &Check{Name: "example.com", Type: "A", Source: "resolve", Response: json.RawMessage(`{}`)})
+	s.Close()
+
+	s, err = OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	page, _ := s.List(context.Background(), ListQuery{Name: "example.com"})
+	if len(page.Checks) != 1 {
+		t.Fatalf("expected the check to survive reopening, got %d", len(page.Checks))
+	}
+}
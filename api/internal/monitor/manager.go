@@ -0,0 +1,222 @@
+package monitor
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+)
+
+type resolveFunc func(ctx context.Context, name, qtype string, servers []string, dnssec bool, perQueryTimeout time.Duration) []resolver.Result
+
+// Manager keeps monitors in a Store and runs each on its interval. It is safe for concurrent use.
+type Manager struct {
+	store           Store
+	maxMonitors     int
+	perQueryTimeout time.Duration
+	resolve         resolveFunc
+	listeners       []Listener
+	pruneChecks     Pruner
+	pruneDeliveries Pruner
+
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running map[string]context.CancelFunc
+	wg      sync.WaitGroup
+
+	statsMu sync.Mutex
+	stats   CompactionStats
+}
+
+// NewManager creates a manager that allows at most maxMonitors monitors. Like watch jobs,
+// checks bypass the resolver cache so every result reflects live resolver state.
+func NewManager(store Store, maxMonitors int, perQueryTimeout time.Duration) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		store:           store,
+		maxMonitors:     maxMonitors,
+		perQueryTimeout: perQueryTimeout,
+		resolve: func(ctx context.Context, name, qtype string, servers []string, dnssec bool, perQueryTimeout time.Duration) []resolver.Result {
+			return resolver.Resolve(ctx, name, qtype, servers, dnssec, perQueryTimeout, nil, 0)
+		},
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[string]context.CancelFunc),
+	}
+}
+
+// OnResult registers l to be called after every check. Call it before Start.
+func (m *Manager) OnResult(l Listener) {
+	m.listeners = append(m.listeners, l)
+}
+
+// Start schedules every stored monitor. Monitors checked recently wait out the rest of their
+// interval, so restarting the server does not re-check everything at once.
+func (m *Manager) Start(ctx context.Context) error {
+	mons, err := m.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, mon := range mons {
+		m.schedule(mon)
+	}
+	return nil
+}
+
+// Create stores a monitor for spec and starts checking it right away.
+func (m *Manager) Create(ctx context.Context, spec Spec) (Monitor, error) {
+	mon := Monitor{Spec: spec}
+	if err := m.create(ctx, &mon); err != nil {
+		return Monitor{}, err
+	}
+	m.schedule(mon)
+	return mon, nil
+}
+
+// create stores mon unless the limit is reached. Holding m.mu between counting and storing keeps
+// concurrent creates from exceeding it.
+func (m *Manager) create(ctx context.Context, mon *Monitor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mons, err := m.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	if len(mons) >= m.maxMonitors {
+		return ErrTooManyMonitors
+	}
+	return m.store.Create(ctx, mon)
+}
+
+func (m *Manager) Get(ctx context.Context, id string) (Monitor, error) {
+	return m.store.Get(ctx, id)
+}
+
+func (m *Manager) List(ctx context.Context) ([]Monitor, error) {
+	return m.store.List(ctx)
+}
+
+// Update replaces a monitor's spec. Its status goes back to pending and it is checked right away.
+func (m *Manager) Update(ctx context.Context, id string, spec Spec) (Monitor, error) {
+	mon := Monitor{ID: id, Spec: spec}
+	if err := m.store.Update(ctx, &mon); err != nil {
+		return Monitor{}, err
+	}
+	m.schedule(mon)
+	return mon, nil
+}
+
+// Delete stops a monitor and removes it with its results.
+func (m *Manager) Delete(ctx context.Context, id string) error {
+	m.unschedule(id)
+	return m.store.Delete(ctx, id)
+}
+
+// Results returns up to limit results of a monitor, newest first.
+func (m *Manager) Results(ctx context.Context, id string, limit int) ([]Result, error) {
+	if _, err := m.store.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return m.store.Results(ctx, id, limit)
+}
+
+// Close stops all monitors and compaction and waits for running checks to finish.
+func (m *Manager) Close() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// schedule (re)starts the loop for mon, replacing any running one.
+func (m *Manager) schedule(mon Monitor) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ctx.Err() != nil {
+		return
+	}
+	if stop, ok := m.running[mon.ID]; ok {
+		stop()
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.running[mon.ID] = cancel
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.run(ctx, mon)
+	}()
+}
+
+func (m *Manager) unschedule(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stop, ok := m.running[id]; ok {
+		stop()
+		delete(m.running, id)
+	}
+}
+
+func (m *Manager) run(ctx context.Context, mon Monitor) {
+	interval := mon.Spec.Interval
+	if !mon.Status.CheckedAt.IsZero() {
+		if wait := time.Until(mon.Status.CheckedAt.Add(interval)); wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.check(ctx, mon.ID)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs one check of the monitor with id, stores it and notifies listeners.
+func (m *Manager) check(ctx context.Context, id string) {
+	// Re-read so the check sees the latest status.
+	mon, err := m.store.Get(ctx, id)
+	if err != nil {
+		return
+	}
+	started := time.Now()
+	results := m.resolve(ctx, mon.Spec.Name, mon.Spec.Type, mon.Spec.Servers, mon.Spec.DNSSEC, m.perQueryTimeout)
+	if ctx.Err() != nil {
+		return // stopped, updated or deleted mid-check
+	}
+	now := time.Now().UTC()
+	st := evaluate(results, mon.Spec.Expected, mon.Status, now)
+	res := Result{
+		MonitorID:   mon.ID,
+		CheckedAt:   now,
+		State:       st.State,
+		Agreeing:    st.Agreeing,
+		Unreachable: st.Unreachable,
+		Total:       st.Total,
+		DurationMs:  float64(time.Since(started).Microseconds()) / 1000.0,
+		Servers:     summarize(results),
+	}
+	var prev *Result
+	if last, err := m.store.Results(ctx, mon.ID, 1); err == nil && len(last) == 1 {
+		prev = &last[0]
+	}
+	if err := m.store.Record(ctx, &res, st); err != nil {
+		slog.WarnContext(ctx, "monitor_record_failed", slog.String("monitor", mon.ID), slog.String("error", err.Error()))
+		return
+	}
+	ev := Event{Monitor: mon, Previous: mon.Status, PreviousResult: prev, Result: res, Results: results}
+	ev.Monitor.Status = st
+	for _, l := range m.listeners {
+		l(ctx, ev)
+	}
+}
@@ -0,0 +1,174 @@
+package monitor
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+)
+
+func answer(v string) resolver.Result {
+	return resolver.Result{Status: "ok", Answers: []resolver.Answer{{Value: v}}}
+}
+
+func newTestManager(t *testing.T, max int) (*Manager, *SQLiteStore) {
+	t.Helper()
+	store, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(store, max, time.Second)
+	t.Cleanup(func() {
+		m.Close()
+		store.Close()
+	})
+	return m, store
+}
+
+func TestManager_ChecksAndNotifies(t *testing.T) {
+	m, _ := newTestManager(t, 10)
+	var calls atomic.Int32
+	m.resolve = func(ctx context.Context, name, qtype string, servers []string, dnssec bool, _ time.Duration) []resolver.Result {
+		if calls.Add(1) == 1 {
+			return []resolver.Result{answer("192.0.2.1"), answer("192.0.2.2"), {Status: "timeout"}}
+		}
+		return []resolver.Result{answer("192.0.2.2"), answer("192.0.2.2"), {Status: "timeout"}}
+	}
+	events := make(chan Event, 10)
+	m.OnResult(func(_ context.Context, e Event) { events <- e })
+
+	mon, err := m.Create(context.Background(), Spec{Name: "example.com", Type: "A", Servers: []string{"a", "b", "c"}, Expected: []string{"192.0.2.2"}, Interval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mon.Status.State != StatePending {
+		t.Fatalf("expected a pending monitor, got %q", mon.Status.State)
+	}
+
+	first, second := <-events, <-events
+	if first.Previous.State != StatePending || first.Monitor.Status.State != StateMismatch || !first.Changed() {
+		t.Fatalf("unexpected first event: %+v", first)
+	}
+	if first.PreviousResult != nil || second.PreviousResult == nil || second.PreviousResult.ID != first.Result.ID {
+		t.Fatalf("expected the second event to carry the first result, got %+v", second.PreviousResult)
+	}
+	if second.Monitor.Status.State != StateOK || second.Monitor.Status.Agreeing != 2 || second.Monitor.Status.Unreachable != 1 {
+		t.Fatalf("unexpected second event: %+v", second.Monitor.Status)
+	}
+
+	m.Delete(context.Background(), mon.ID)
+	got, err := m.Get(context.Background(), mon.ID)
+	if err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound after delete, got %+v, %v", got, err)
+	}
+}
+
+func TestManager_StatusAndResultsPersist(t *testing.T) {
+	m, store := newTestManager(t, 10)
+	m.resolve = func(ctx context.Context, name, qtype string, servers []string, dnssec bool, _ time.Duration) []resolver.Result {
+		return []resolver.Result{{Status: "timeout"}, {Status: "error"}}
+	}
+	done := make(chan struct{}, 10)
+	m.OnResult(func(context.Context, Event) { done <- struct{}{} })
+
+	mon, _ := m.Create(context.Background(), Spec{Name: "example.com", Type: "A", Servers: []string{"a", "b"}, Interval: time.Hour})
+	<-done
+	stored, err := store.Get(context.Background(), mon.ID)
+	if err != nil || stored.Status.State != StateFailing || stored.Status.CheckedAt.IsZero() || stored.Status.Since.IsZero() {
+		t.Fatalf("unexpected stored status: %+v, %v", stored.Status, err)
+	}
+	results, err := m.Results(context.Background(), mon.ID, 10)
+	if err != nil || len(results) != 1 || results[0].State != StateFailing || len(results[0].Servers) != 2 {
+		t.Fatalf("unexpected results: %+v, %v", results, err)
+	}
+
+	// Updating resets the status and checks again right away.
+	spec := mon.Spec
+	spec.Type = "AAAA"
+	updated, err := m.Update(context.Background(), mon.ID, spec)
+	if err != nil || updated.Status.State != StatePending || !updated.CreatedAt.Equal(stored.CreatedAt) {
+		t.Fatalf("unexpected update: %+v, %v", updated, err)
+	}
+	<-done
+	if results, _ := m.Results(context.Background(), mon.ID, 10); len(results) != 2 {
+		t.Fatalf("expected a second result after update, got %d", len(results))
+	}
+}
+
+func TestManager_StartWaitsOutInterval(t *testing.T) {
+	m, store := newTestManager(t, 10)
+	var calls atomic.Int32
+	m.resolve = func(ctx context.Context, name, qtype string, servers []string, dnssec bool, _ time.Duration) []resolver.Result {
+		calls.Add(1)
+		return []resolver.Result{answer("192.0.2.1")}
+	}
+	recent := &Monitor{Spec: Spec{Name: "recent.example", Type: "A", Servers: []string{"a"}, Interval: time.Hour}}
+	stale := &Monitor{Spec: Spec{Name: "stale.example", Type: "A", Servers: []string{"a"}, Interval: time.Hour}}
+	store.Create(context.Background(), recent)
+	store.Create(context.Background(), stale)
+	now := time.Now().UTC()
+	store.Record(context.Background(), &Result{MonitorID: recent.ID, CheckedAt: now, State: StateOK}, Status{State: StateOK, Since: now, CheckedAt: now})
+
+	done := make(chan Event, 10)
+	m.OnResult(func(_ context.Context, e Event) { done <- e })
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if e := <-done; e.Monitor.ID != stale.ID {
+		t.Fatalf("expected only the never-checked monitor to run, got %s", e.Monitor.Spec.Name)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected 1 check after start, got %d", n)
+	}
+}
+
+func TestManager_Limit(t *testing.T) {
+	m, _ := newTestManager(t, 2)
+	m.resolve = func(context.Context, string, string, []string, bool, time.Duration) []resolver.Result { return nil }
+	spec := Spec{Name: "example.com", Type: "A", Servers: []string{"a"}, Interval: time.Hour}
+	var (
+		wg      sync.WaitGroup
+		created atomic.Int32
+	)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.Create(context.Background(), spec)
+			switch err {
+			case nil:
+				created.Add(1)
+			case ErrTooManyMonitors:
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if mons, _ := m.List(context.Background()); created.Load() != 2 || len(mons) != 2 {
+		t.Fatalf("expected exactly 2 monitors from concurrent creates, created %d, stored %d", created.Load(), len(mons))
+	}
+	if _, err := m.Update(context.Background(), "nope", spec); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestManager_OldAnswerNextToExpectedIsMismatch(t *testing.T) {
+	m, _ := newTestManager(t, 10)
+	m.resolve = func(context.Context, string, string, []string, bool, time.Duration) []resolver.Result {
+		both := resolver.Result{Status: "ok", Answers: []resolver.Answer{{Value: "192.0.2.1"}, {Value: "192.0.2.2"}}}
+		return []resolver.Result{answer("192.0.2.2"), both}
+	}
+	events := make(chan Event, 1)
+	m.OnResult(func(_ context.Context, e Event) { events <- e })
+	if _, err := m.Create(context.Background(), Spec{Name: "example.com", Type: "A", Servers: []string{"a", "b"}, Expected: []string{"192.0.2.2"}, Interval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if st := (<-events).Monitor.Status; st.State != StateMismatch || st.Agreeing != 1 {
+		t.Fatalf("expected a mismatch while one resolver still returns the old record, got %+v", st)
+	}
+}
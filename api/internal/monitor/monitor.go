@@ -0,0 +1,159 @@
+// Package monitor re-checks configured records on a schedule and keeps each monitor's results and
+// current status.
+package monitor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+	"github.com/legertom/dnsprop/api/internal/watch"
+)
+
+// Monitor states.
+const (
+	StatePending  = "pending"  // not checked yet
+	StateOK       = "ok"       // every reachable resolver returns the expected answers
+	StateMismatch = "mismatch" // at least one reachable resolver answers differently
+	StateFailing  = "failing"  // no resolver could be reached
+)
+
+var (
+	ErrNotFound        = errors.New("monitor not found")
+	ErrTooManyMonitors = errors.New("too many monitors")
+)
+
+// Spec describes what a monitor checks.
+type Spec struct {
+	Name    string
+	Type    string
+	Servers []string
+	DNSSEC  bool
+	// Expected answer values every resolver must return; when empty the monitor expects all
+	// resolvers to agree on any answer set.
+	Expected []string
+	Interval time.Duration
+}
+
+// Status is a monitor's state as of its latest check. Since is when the state last changed.
+type Status struct {
+	State       string
+	Since       time.Time
+	CheckedAt   time.Time
+	Agreeing    int
+	Unreachable int
+	Total       int
+}
+
+type Monitor struct {
+	ID        string
+	Spec      Spec
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Status    Status
+}
+
+// ServerResult is what one resolver answered in a check.
+type ServerResult struct {
+	Server  string
+	Status  string
+	Answers []string
+	RTTMs   float64
+}
+
+// Result is one stored check of a monitor.
+type Result struct {
+	ID          int64
+	MonitorID   string
+	CheckedAt   time.Time
+	State       string
+	Agreeing    int
+	Unreachable int
+	Total       int
+	DurationMs  float64
+	Servers     []ServerResult
+}
+
+// Store persists monitors and their results. Implementations are safe for concurrent use.
+type Store interface {
+	// Create stores m, assigning its ID and timestamps and a pending status.
+	Create(ctx context.Context, m *Monitor) error
+	Get(ctx context.Context, id string) (Monitor, error)
+	// List returns all monitors, oldest first.
+	List(ctx context.Context) ([]Monitor, error)
+	// Update replaces the spec of the monitor with m.ID and resets its status to pending.
+	Update(ctx context.Context, m *Monitor) error
+	// Delete removes a monitor with its results and rollups.
+	Delete(ctx context.Context, id string) error
+	// Record stores r and sets the monitor's status to st in one step.
+	Record(ctx context.Context, r *Result, st Status) error
+	// Results returns up to limit results of a monitor, newest first.
+	Results(ctx context.Context, monitorID string, limit int) ([]Result, error)
+	// Compact rolls results and rollups that are past their retention as of now up into coarser
+	// rollups, and deletes daily rollups past theirs.
+	Compact(ctx context.Context, r Retention, now time.Time) (CompactResult, error)
+	// Rollups returns up to limit rollups of a monitor at resolution, newest first.
+	Rollups(ctx context.Context, monitorID, resolution string, limit int) ([]Rollup, error)
+	Close() error
+}
+
+// Event is passed to listeners after every completed check.
+type Event struct {
+	// Monitor carries the status after the check.
+	Monitor  Monitor
+	Previous Status
+	// PreviousResult is the check before this one; nil for a monitor's first check.
+	PreviousResult *Result
+	Result         Result
+	Results        []resolver.Result
+}
+
+// Changed reports whether the check moved the monitor to a different state.
+func (e Event) Changed() bool {
+	return e.Previous.State != e.Monitor.Status.State
+}
+
+// Listener is called after every completed check, from the monitor's goroutine.
+type Listener func(ctx context.Context, e Event)
+
+// evaluate derives the status of a check; prev carries Since over while the state is unchanged.
+func evaluate(results []resolver.Result, expected []string, prev Status, now time.Time) Status {
+	st := Status{CheckedAt: now, Total: len(results)}
+	st.Agreeing, st.Unreachable = watch.Agreement(results, expected)
+	switch {
+	case st.Total == 0 || st.Unreachable == st.Total:
+		st.State = StateFailing
+	case st.Agreeing > 0 && st.Agreeing+st.Unreachable == st.Total:
+		st.State = StateOK
+	default:
+		st.State = StateMismatch
+	}
+	st.Since = now
+	if st.State == prev.State {
+		st.Since = prev.Since
+	}
+	return st
+}
+
+func summarize(results []resolver.Result) []ServerResult {
+	out := make([]ServerResult, 0, len(results))
+	for _, r := range results {
+		sr := ServerResult{Server: r.Server, Status: r.Status, RTTMs: r.RTTMs, Answers: make([]string, 0, len(r.Answers))}
+		for _, a := range r.Answers {
+			sr.Answers = append(sr.Answers, a.Value)
+		}
+		out = append(out, sr)
+	}
+	return out
+}
+
+func newID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,223 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rollup resolutions.
+const (
+	ResolutionHour = "hour"
+	ResolutionDay  = "day"
+)
+
+// Retention says how long monitor results are kept at each resolution. Raw results older than Raw
+// are rolled up into hourly rollups, hourly rollups older than Hourly into daily ones, and daily
+// rollups older than Daily are deleted.
+type Retention struct {
+	Raw    time.Duration
+	Hourly time.Duration
+	Daily  time.Duration
+}
+
+// Rollup aggregates the results of one monitor over an hour or a day starting at Start (UTC).
+type Rollup struct {
+	MonitorID  string
+	Resolution string
+	Start      time.Time
+	Checks     int
+	// DurationMs is the mean check duration.
+	DurationMs float64
+	// States counts checks by monitor state.
+	States map[string]int
+	// Statuses counts resolver responses by status.
+	Statuses map[string]int
+	// AnswerSets counts "ok" resolver responses by their sorted answers, joined with ", ".
+	AnswerSets map[string]int
+}
+
+// CompactResult counts the rows one compaction changed.
+type CompactResult struct {
+	RawPruned     int64
+	HourlyWritten int64
+	HourlyPruned  int64
+	DailyWritten  int64
+	DailyPruned   int64
+	// ChecksPruned and DeliveriesPruned count rows the pruners set with PruneChecks and
+	// PruneDeliveries removed.
+	ChecksPruned     int64
+	DeliveriesPruned int64
+}
+
+// Pruner deletes rows another store keeps about monitors that are older than before and returns
+// how many it removed.
+type Pruner func(ctx context.Context, before time.Time) (int64, error)
+
+// CompactionStats describes the compaction job started by Manager.StartCompaction.
+type CompactionStats struct {
+	Retention Retention
+	Runs      int64
+	Failures  int64
+	LastRunAt time.Time
+	// LastError is empty when the latest run succeeded.
+	LastError string
+	// Total sums every run so far.
+	Total CompactResult
+}
+
+// StartCompaction compacts stored results under r right away and then every interval until
+// Close, so frequent monitors do not grow the database without bound.
+func (m *Manager) StartCompaction(r Retention, interval time.Duration) {
+	m.statsMu.Lock()
+	m.stats.Retention = r
+	m.statsMu.Unlock()
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			m.compact(m.ctx, r, time.Now())
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// PruneChecks makes compaction also delete, through p, the history checks recorded from monitor
+// checks once they are older than the raw retention. Call it before StartCompaction.
+func (m *Manager) PruneChecks(p Pruner) {
+	m.pruneChecks = p
+}
+
+// PruneDeliveries makes compaction also trim the webhook delivery log to the raw retention through
+// p. Call it before StartCompaction.
+func (m *Manager) PruneDeliveries(p Pruner) {
+	m.pruneDeliveries = p
+}
+
+// Compaction returns the compaction job's counters.
+func (m *Manager) Compaction() CompactionStats {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	return m.stats
+}
+
+// Rollups returns up to limit rollups of a monitor at resolution, newest first.
+func (m *Manager) Rollups(ctx context.Context, id, resolution string, limit int) ([]Rollup, error) {
+	if _, err := m.store.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return m.store.Rollups(ctx, id, resolution, limit)
+}
+
+func (m *Manager) compact(ctx context.Context, r Retention, now time.Time) {
+	res, err := m.store.Compact(ctx, r, now)
+	if m.pruneChecks != nil {
+		n, perr := m.pruneChecks(ctx, now.Add(-r.Raw))
+		res.ChecksPruned = n
+		err = errors.Join(err, perr)
+	}
+	if m.pruneDeliveries != nil {
+		n, perr := m.pruneDeliveries(ctx, now.Add(-r.Raw))
+		res.DeliveriesPruned = n
+		err = errors.Join(err, perr)
+	}
+	m.statsMu.Lock()
+	m.stats.Runs++
+	m.stats.LastRunAt = now.UTC()
+	m.stats.LastError = ""
+	if err != nil {
+		m.stats.Failures++
+		m.stats.LastError = err.Error()
+	}
+	m.stats.Total.add(res)
+	m.statsMu.Unlock()
+
+	if err != nil {
+		slog.WarnContext(ctx, "monitor_compact_failed", slog.String("error", err.Error()))
+	}
+	if res != (CompactResult{}) {
+		slog.InfoContext(ctx, "monitor_results_compacted",
+			slog.Int64("raw_pruned", res.RawPruned),
+			slog.Int64("hourly_written", res.HourlyWritten),
+			slog.Int64("hourly_pruned", res.HourlyPruned),
+			slog.Int64("daily_written", res.DailyWritten),
+			slog.Int64("daily_pruned", res.DailyPruned),
+			slog.Int64("checks_pruned", res.ChecksPruned),
+			slog.Int64("deliveries_pruned", res.DeliveriesPruned))
+	}
+}
+
+func (c *CompactResult) add(o CompactResult) {
+	c.RawPruned += o.RawPruned
+	c.HourlyWritten += o.HourlyWritten
+	c.HourlyPruned += o.HourlyPruned
+	c.DailyWritten += o.DailyWritten
+	c.DailyPruned += o.DailyPruned
+	c.ChecksPruned += o.ChecksPruned
+	c.DeliveriesPruned += o.DeliveriesPruned
+}
+
+func newRollup(monitorID, resolution string, start time.Time) *Rollup {
+	return &Rollup{
+		MonitorID:  monitorID,
+		Resolution: resolution,
+		Start:      start.UTC(),
+		States:     map[string]int{},
+		Statuses:   map[string]int{},
+		AnswerSets: map[string]int{},
+	}
+}
+
+// add counts one raw result into r.
+func (r *Rollup) add(res Result) {
+	r.DurationMs = (r.DurationMs*float64(r.Checks) + res.DurationMs) / float64(r.Checks+1)
+	r.Checks++
+	r.States[res.State]++
+	for _, s := range res.Servers {
+		r.Statuses[s.Status]++
+		if s.Status == "ok" {
+			r.AnswerSets[answerSet(s.Answers)]++
+		}
+	}
+}
+
+// merge adds the counts of o, a rollup of the same monitor, into r.
+func (r *Rollup) merge(o Rollup) {
+	if o.Checks == 0 {
+		return
+	}
+	r.DurationMs = (r.DurationMs*float64(r.Checks) + o.DurationMs*float64(o.Checks)) / float64(r.Checks+o.Checks)
+	r.Checks += o.Checks
+	for k, v := range o.States {
+		r.States[k] += v
+	}
+	for k, v := range o.Statuses {
+		r.Statuses[k] += v
+	}
+	for k, v := range o.AnswerSets {
+		r.AnswerSets[k] += v
+	}
+}
+
+func answerSet(answers []string) string {
+	sorted := append([]string(nil), answers...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
+
+// bucketStart returns the start of the hour or UTC day containing t.
+func bucketStart(t time.Time, resolution string) time.Time {
+	if resolution == ResolutionDay {
+		return t.UTC().Truncate(24 * time.Hour)
+	}
+	return t.UTC().Truncate(time.Hour)
+}
@@ -0,0 +1,98 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestManager_CompactRollsUpAndPrunes(t *testing.T) {
+	m, store := newTestManager(t, 10)
+	ctx := context.Background()
+	mon := Monitor{Spec: Spec{Name: "example.com", Type: "A", Servers: []string{"a", "b"}, Interval: time.Hour}}
+	if err := store.Create(ctx, &mon); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 6, 20, 12, 30, 0, 0, time.UTC)
+	record := func(at time.Time, state string, durationMs float64, servers ...ServerResult) {
+		t.Helper()
+		r := Result{MonitorID: mon.ID, CheckedAt: at, State: state, DurationMs: durationMs, Servers: servers}
+		if err := store.Record(ctx, &r, Status{State: state, CheckedAt: at, Since: at}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ok := func(answers ...string) ServerResult { return ServerResult{Server: "a", Status: "ok", Answers: answers} }
+	timeout := ServerResult{Server: "b", Status: "timeout", Answers: []string{}}
+
+	old := time.Date(2024, 6, 10, 9, 0, 0, 0, time.UTC)
+	record(old.Add(5*time.Minute), StateOK, 10, ok("192.0.2.2", "192.0.2.1"), timeout)
+	record(old.Add(35*time.Minute), StateMismatch, 30, ok("192.0.2.3"), timeout)
+	record(old.Add(time.Hour), StateOK, 20, ok("192.0.2.1", "192.0.2.2"), ok("192.0.2.1", "192.0.2.2"))
+	record(now.Add(-time.Hour), StateOK, 5, ok("192.0.2.1"))
+
+	r := Retention{Raw: 7 * 24 * time.Hour, Hourly: 30 * 24 * time.Hour, Daily: 365 * 24 * time.Hour}
+	m.compact(ctx, r, now)
+
+	if results, _ := m.Results(ctx, mon.ID, 10); len(results) != 1 || !results[0].CheckedAt.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("expected only the recent raw result to remain, got %+v", results)
+	}
+	hours, err := m.Rollups(ctx, mon.ID, ResolutionHour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hours) != 2 || !hours[0].Start.Equal(old.Add(time.Hour)) || !hours[1].Start.Equal(old) {
+		t.Fatalf("expected two hourly rollups, newest first, got %+v", hours)
+	}
+	first := hours[1]
+	if first.Checks != 2 || first.DurationMs != 20 || first.States[StateOK] != 1 || first.States[StateMismatch] != 1 {
+		t.Fatalf("unexpected hourly rollup: %+v", first)
+	}
+	if first.Statuses["ok"] != 2 || first.Statuses["timeout"] != 2 || first.AnswerSets["192.0.2.1, 192.0.2.2"] != 1 || first.AnswerSets["192.0.2.3"] != 1 {
+		t.Fatalf("unexpected hourly counts: %+v %+v", first.Statuses, first.AnswerSets)
+	}
+	stats := m.Compaction()
+	if stats.Runs != 1 || stats.Failures != 0 || stats.Total.RawPruned != 3 || stats.Total.HourlyWritten != 2 || !stats.LastRunAt.Equal(now) {
+		t.Fatalf("unexpected stats after the first run: %+v", stats)
+	}
+
+	// A month on, every hourly rollup (including the recent result's) is rolled up by day.
+	later := now.Add(31 * 24 * time.Hour)
+	m.compact(ctx, r, later)
+	if hours, _ := m.Rollups(ctx, mon.ID, ResolutionHour, 10); len(hours) != 0 {
+		t.Fatalf("expected no hourly rollups, got %+v", hours)
+	}
+	days, err := m.Rollups(ctx, mon.ID, ResolutionDay, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 2 || !days[1].Start.Equal(time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected two daily rollups, got %+v", days)
+	}
+	if day := days[1]; day.Checks != 3 || day.DurationMs != 20 || day.States[StateOK] != 2 || day.AnswerSets["192.0.2.1, 192.0.2.2"] != 3 {
+		t.Fatalf("unexpected daily rollup: %+v", day)
+	}
+
+	// A year on, the daily rollups are gone too.
+	m.compact(ctx, r, later.Add(366*24*time.Hour))
+	if days, _ := m.Rollups(ctx, mon.ID, ResolutionDay, 10); len(days) != 0 {
+		t.Fatalf("expected the daily rollups to be pruned, got %+v", days)
+	}
+	stats = m.Compaction()
+	want := CompactResult{RawPruned: 4, HourlyWritten: 3, HourlyPruned: 3, DailyWritten: 2, DailyPruned: 2}
+	if stats.Runs != 3 || stats.Total != want {
+		t.Fatalf("expected totals %+v, got %+v", want, stats.Total)
+	}
+
+	end := later.Add(366 * 24 * time.Hour)
+	record(end.Add(-8*24*time.Hour), StateOK, 5, ok("192.0.2.1"))
+	m.compact(ctx, r, end)
+	if hours, _ := store.Rollups(ctx, mon.ID, ResolutionHour, 10); len(hours) != 1 {
+		t.Fatalf("expected a new hourly rollup, got %+v", hours)
+	}
+	if err := m.Delete(ctx, mon.ID); err != nil {
+		t.Fatal(err)
+	}
+	if hours, _ := store.Rollups(ctx, mon.ID, ResolutionHour, 10); len(hours) != 0 {
+		t.Fatalf("expected deleting the monitor to remove its rollups, got %+v", hours)
+	}
+}
@@ -0,0 +1,508 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS monitors (
+	id          TEXT PRIMARY KEY,
+	name        TEXT NOT NULL,
+	type        TEXT NOT NULL,
+	servers     TEXT NOT NULL,
+	dnssec      INTEGER NOT NULL,
+	expected    TEXT NOT NULL,
+	interval_ms INTEGER NOT NULL,
+	created_at  INTEGER NOT NULL,
+	updated_at  INTEGER NOT NULL,
+	state       TEXT NOT NULL,
+	state_since INTEGER NOT NULL,
+	checked_at  INTEGER NOT NULL,
+	agreeing    INTEGER NOT NULL,
+	unreachable INTEGER NOT NULL,
+	total       INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS monitor_results (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	monitor_id  TEXT NOT NULL,
+	checked_at  INTEGER NOT NULL,
+	state       TEXT NOT NULL,
+	agreeing    INTEGER NOT NULL,
+	unreachable INTEGER NOT NULL,
+	total       INTEGER NOT NULL,
+	duration_ms REAL NOT NULL,
+	servers     TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS monitor_results_monitor ON monitor_results (monitor_id, checked_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS monitor_results_checked ON monitor_results (checked_at);
+CREATE TABLE IF NOT EXISTS monitor_rollups (
+	monitor_id  TEXT NOT NULL,
+	resolution  TEXT NOT NULL,
+	start       INTEGER NOT NULL,
+	checks      INTEGER NOT NULL,
+	duration_ms REAL NOT NULL,
+	states      TEXT NOT NULL,
+	statuses    TEXT NOT NULL,
+	answer_sets TEXT NOT NULL,
+	PRIMARY KEY (monitor_id, resolution, start)
+);
+`
+
+// compactBatch bounds how many raw results one compaction transaction reads, so a first run over
+// a large backlog does not hold the write lock for long.
+const compactBatch = 5000
+
+const monitorColumns = `id, name, type, servers, dnssec, expected, interval_ms, created_at, updated_at,
+	state, state_since, checked_at, agreeing, unreachable, total`
+
+// SQLiteStore is a Store backed by a SQLite database file. It can share the file used for
+// history.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens (creating if needed) the database at path. ":memory:" gives a private
+// in-memory database, which is useful in tests.
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time, and each connection to ":memory:" is its own database.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("monitor schema: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Create(ctx context.Context, m *Monitor) error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	m.ID, m.CreatedAt, m.UpdatedAt = id, now, now
+	m.Status = Status{State: StatePending}
+	servers, expected, err := marshalSpec(m.Spec)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO monitors (`+monitorColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0, 0, 0, 0, 0)`,
+		m.ID, m.Spec.Name, m.Spec.Type, servers, m.Spec.DNSSEC, expected, m.Spec.Interval.Milliseconds(),
+		m.CreatedAt.UnixNano(), m.UpdatedAt.UnixNano(), m.Status.State)
+	return err
+}
+
+func (s *SQLiteStore) Get(ctx context.Context, id string) (Monitor, error) {
+	m, err := scanMonitor(s.db.QueryRowContext(ctx, `SELECT `+monitorColumns+` FROM monitors WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Monitor{}, ErrNotFound
+	}
+	return m, err
+}
+
+func (s *SQLiteStore) List(ctx context.Context) ([]Monitor, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+monitorColumns+` FROM monitors ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Monitor{}
+	for rows.Next() {
+		m, err := scanMonitor(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) Update(ctx context.Context, m *Monitor) error {
+	servers, expected, err := marshalSpec(m.Spec)
+	if err != nil {
+		return err
+	}
+	m.UpdatedAt = time.Now().UTC()
+	m.Status = Status{State: StatePending}
+	res, err := s.db.ExecContext(ctx, `UPDATE monitors SET
+		name = ?, type = ?, servers = ?, dnssec = ?, expected = ?, interval_ms = ?, updated_at = ?,
+		state = ?, state_since = 0, checked_at = 0, agreeing = 0, unreachable = 0, total = 0
+		WHERE id = ?`,
+		m.Spec.Name, m.Spec.Type, servers, m.Spec.DNSSEC, expected, m.Spec.Interval.Milliseconds(), m.UpdatedAt.UnixNano(),
+		m.Status.State, m.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	// The caller only knows the spec; fill in what the row already had.
+	stored, err := s.Get(ctx, m.ID)
+	if err != nil {
+		return err
+	}
+	m.CreatedAt = stored.CreatedAt
+	return nil
+}
+
+func (s *SQLiteStore) Delete(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `DELETE FROM monitors WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM monitor_results WHERE monitor_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM monitor_rollups WHERE monitor_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Record(ctx context.Context, r *Result, st Status) error {
+	servers, err := json.Marshal(r.Servers)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	upd, err := tx.ExecContext(ctx, `UPDATE monitors SET
+		state = ?, state_since = ?, checked_at = ?, agreeing = ?, unreachable = ?, total = ?
+		WHERE id = ?`,
+		st.State, st.Since.UnixNano(), st.CheckedAt.UnixNano(), st.Agreeing, st.Unreachable, st.Total, r.MonitorID)
+	if err != nil {
+		return err
+	}
+	if n, _ := upd.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	ins, err := tx.ExecContext(ctx, `INSERT INTO monitor_results
+		(monitor_id, checked_at, state, agreeing, unreachable, total, duration_ms, servers)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.MonitorID, r.CheckedAt.UnixNano(), r.State, r.Agreeing, r.Unreachable, r.Total, r.DurationMs, string(servers))
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	r.ID, _ = ins.LastInsertId()
+	return nil
+}
+
+func (s *SQLiteStore) Results(ctx context.Context, monitorID string, limit int) ([]Result, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT
+		id, monitor_id, checked_at, state, agreeing, unreachable, total, duration_ms, servers
+		FROM monitor_results WHERE monitor_id = ? ORDER BY checked_at DESC, id DESC LIMIT ?`, monitorID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Result{}
+	for rows.Next() {
+		var (
+			r       Result
+			checked int64
+			servers string
+		)
+		if err := rows.Scan(&r.ID, &r.MonitorID, &checked, &r.State, &r.Agreeing, &r.Unreachable, &r.Total, &r.DurationMs, &servers); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(servers), &r.Servers); err != nil {
+			return nil, fmt.Errorf("monitor result %d: servers: %w", r.ID, err)
+		}
+		r.CheckedAt = time.Unix(0, checked).UTC()
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// Compact works in whole hours and days: a bucket is only rolled up once all of it is past the
+// retention, and rolling up into a bucket that already exists adds to its counts.
+func (s *SQLiteStore) Compact(ctx context.Context, r Retention, now time.Time) (CompactResult, error) {
+	var out CompactResult
+	rawBefore := bucketStart(now.Add(-r.Raw), ResolutionHour)
+	for {
+		pruned, written, err := s.rollUpResults(ctx, rawBefore)
+		out.RawPruned += pruned
+		out.HourlyWritten += written
+		if err != nil {
+			return out, err
+		}
+		if pruned < compactBatch {
+			break
+		}
+	}
+	pruned, written, err := s.rollUpHourly(ctx, bucketStart(now.Add(-r.Hourly), ResolutionDay))
+	out.HourlyPruned, out.DailyWritten = pruned, written
+	if err != nil {
+		return out, err
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM monitor_rollups WHERE resolution = ? AND start < ?`,
+		ResolutionDay, bucketStart(now.Add(-r.Daily), ResolutionDay).UnixNano())
+	if err != nil {
+		return out, err
+	}
+	out.DailyPruned, _ = res.RowsAffected()
+	return out, nil
+}
+
+func (s *SQLiteStore) Rollups(ctx context.Context, monitorID, resolution string, limit int) ([]Rollup, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+rollupColumns+` FROM monitor_rollups
+		WHERE monitor_id = ? AND resolution = ? ORDER BY start DESC LIMIT ?`, monitorID, resolution, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Rollup{}
+	for rows.Next() {
+		r, err := scanRollup(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+const rollupColumns = `monitor_id, resolution, start, checks, duration_ms, states, statuses, answer_sets`
+
+// rollUpResults rolls up to compactBatch raw results checked before t into hourly rollups and
+// deletes them.
+func (s *SQLiteStore) rollUpResults(ctx context.Context, t time.Time) (pruned, written int64, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, `SELECT id, monitor_id, checked_at, state, duration_ms, servers
+		FROM monitor_results WHERE checked_at < ? ORDER BY id LIMIT ?`, t.UnixNano(), compactBatch)
+	if err != nil {
+		return 0, 0, err
+	}
+	rollups := map[rollupKey]*Rollup{}
+	var lastID int64
+	for rows.Next() {
+		var (
+			r       Result
+			checked int64
+			servers string
+		)
+		if err := rows.Scan(&r.ID, &r.MonitorID, &checked, &r.State, &r.DurationMs, &servers); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		if err := json.Unmarshal([]byte(servers), &r.Servers); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("monitor result %d: servers: %w", r.ID, err)
+		}
+		start := bucketStart(time.Unix(0, checked), ResolutionHour)
+		key := rollupKey{r.MonitorID, start.UnixNano()}
+		if rollups[key] == nil {
+			rollups[key] = newRollup(r.MonitorID, ResolutionHour, start)
+		}
+		rollups[key].add(r)
+		lastID = r.ID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	if len(rollups) == 0 {
+		return 0, 0, nil
+	}
+	if err := saveRollups(ctx, tx, rollups); err != nil {
+		return 0, 0, err
+	}
+	// Selected in id order, so this deletes exactly the rows read above.
+	res, err := tx.ExecContext(ctx, `DELETE FROM monitor_results WHERE checked_at < ? AND id <= ?`, t.UnixNano(), lastID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	pruned, _ = res.RowsAffected()
+	return pruned, int64(len(rollups)), nil
+}
+
+// rollUpHourly rolls hourly rollups starting before t into daily rollups and deletes them.
+func (s *SQLiteStore) rollUpHourly(ctx context.Context, t time.Time) (pruned, written int64, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, `SELECT `+rollupColumns+` FROM monitor_rollups
+		WHERE resolution = ? AND start < ?`, ResolutionHour, t.UnixNano())
+	if err != nil {
+		return 0, 0, err
+	}
+	rollups := map[rollupKey]*Rollup{}
+	for rows.Next() {
+		hour, err := scanRollup(rows)
+		if err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		start := bucketStart(hour.Start, ResolutionDay)
+		key := rollupKey{hour.MonitorID, start.UnixNano()}
+		if rollups[key] == nil {
+			rollups[key] = newRollup(hour.MonitorID, ResolutionDay, start)
+		}
+		rollups[key].merge(hour)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	if len(rollups) == 0 {
+		return 0, 0, nil
+	}
+	if err := saveRollups(ctx, tx, rollups); err != nil {
+		return 0, 0, err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM monitor_rollups WHERE resolution = ? AND start < ?`, ResolutionHour, t.UnixNano())
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	pruned, _ = res.RowsAffected()
+	return pruned, int64(len(rollups)), nil
+}
+
+type rollupKey struct {
+	monitorID string
+	start     int64
+}
+
+// saveRollups adds each rollup to the stored one for its bucket, if any, and writes the sum.
+func saveRollups(ctx context.Context, tx *sql.Tx, rollups map[rollupKey]*Rollup) error {
+	for _, r := range rollups {
+		stored, err := scanRollup(tx.QueryRowContext(ctx, `SELECT `+rollupColumns+` FROM monitor_rollups
+			WHERE monitor_id = ? AND resolution = ? AND start = ?`, r.MonitorID, r.Resolution, r.Start.UnixNano()))
+		switch {
+		case err == nil:
+			r.merge(stored)
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+		states, err := json.Marshal(r.States)
+		if err != nil {
+			return err
+		}
+		statuses, err := json.Marshal(r.Statuses)
+		if err != nil {
+			return err
+		}
+		answers, err := json.Marshal(r.AnswerSets)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO monitor_rollups (`+rollupColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (monitor_id, resolution, start) DO UPDATE SET
+			checks = excluded.checks, duration_ms = excluded.duration_ms, states = excluded.states,
+			statuses = excluded.statuses, answer_sets = excluded.answer_sets`,
+			r.MonitorID, r.Resolution, r.Start.UnixNano(), r.Checks, r.DurationMs, string(states), string(statuses), string(answers))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanRollup(row interface{ Scan(...any) error }) (Rollup, error) {
+	var (
+		r                         Rollup
+		start                     int64
+		states, statuses, answers string
+	)
+	if err := row.Scan(&r.MonitorID, &r.Resolution, &start, &r.Checks, &r.DurationMs, &states, &statuses, &answers); err != nil {
+		return Rollup{}, err
+	}
+	r.Start = time.Unix(0, start).UTC()
+	for _, f := range []struct {
+		raw string
+		dst *map[string]int
+	}{{states, &r.States}, {statuses, &r.Statuses}, {answers, &r.AnswerSets}} {
+		if err := json.Unmarshal([]byte(f.raw), f.dst); err != nil {
+			return Rollup{}, fmt.Errorf("monitor rollup %s %s: %w", r.MonitorID, r.Start.Format(time.RFC3339), err)
+		}
+	}
+	return r, nil
+}
+
+func marshalSpec(spec Spec) (servers, expected string, err error) {
+	b, err := json.Marshal(spec.Servers)
+	if err != nil {
+		return "", "", err
+	}
+	e, err := json.Marshal(spec.Expected)
+	if err != nil {
+		return "", "", err
+	}
+	return string(b), string(e), nil
+}
+
+func scanMonitor(row interface{ Scan(...any) error }) (Monitor, error) {
+	var (
+		m                          Monitor
+		servers, expected          string
+		interval, created, updated int64
+		since, checked             int64
+	)
+	err := row.Scan(&m.ID, &m.Spec.Name, &m.Spec.Type, &servers, &m.Spec.DNSSEC, &expected, &interval, &created, &updated,
+		&m.Status.State, &since, &checked, &m.Status.Agreeing, &m.Status.Unreachable, &m.Status.Total)
+	if err != nil {
+		return Monitor{}, err
+	}
+	if err := json.Unmarshal([]byte(servers), &m.Spec.Servers); err != nil {
+		return Monitor{}, fmt.Errorf("monitor %s: servers: %w", m.ID, err)
+	}
+	if err := json.Unmarshal([]byte(expected), &m.Spec.Expected); err != nil {
+		return Monitor{}, fmt.Errorf("monitor %s: expected: %w", m.ID, err)
+	}
+	m.Spec.Interval = time.Duration(interval) * time.Millisecond
+	m.CreatedAt = time.Unix(0, created).UTC()
+	m.UpdatedAt = time.Unix(0, updated).UTC()
+	m.Status.Since = unixNanoOrZero(since)
+	m.Status.CheckedAt = unixNanoOrZero(checked)
+	return m, nil
+}
+
+// unixNanoOrZero maps the 0 stored for "never" back to the zero time.
+func unixNanoOrZero(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n).UTC()
+}
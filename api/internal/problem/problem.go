@@ -0,0 +1,112 @@
+// Package problem writes RFC 9457 problem details (application/problem+json) error responses.
+// Every response carries a stable machine-readable "code" alongside the human-readable detail.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const ContentType = "application/problem+json"
+
+// Stable error codes that are not produced by input validation. Validation codes live with the
+// validators (see package validation) and reach clients through Coder.
+const (
+	CodeInvalidJSON      = "invalid_json"
+	CodeInvalidRequest   = "invalid_request"
+	CodeInvalidDNSSEC    = "invalid_dnssec"
+	CodeNoResolvers      = "no_resolvers"
+	CodeTooManyItems     = "too_many_items"
+	CodeBatchTooLarge    = "batch_too_large"
+	CodeRateLimited      = "rate_limited"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal"
+)
+
+// Problem is the response body. Type is always "about:blank", so Title is the HTTP status text.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Coder is implemented by errors that carry a stable code.
+type Coder interface {
+	ErrorCode() string
+}
+
+// New builds a problem for r.
+func New(r *http.Request, status int, code, detail string) Problem {
+	p := Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+	if r != nil {
+		p.Instance = r.URL.Path
+		p.RequestID = middleware.GetReqID(r.Context())
+	}
+	return p
+}
+
+// Write sends a problem response.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	h := w.Header()
+	h.Set("content-type", ContentType)
+	h.Set("x-content-type-options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(New(r, status, code, detail))
+}
+
+// Error sends err as a problem, using its code when it implements Coder and otherwise the
+// default code for status.
+func Error(w http.ResponseWriter, r *http.Request, status int, err error) {
+	Write(w, r, status, CodeOf(err, DefaultCode(status)), err.Error())
+}
+
+// CodeOf returns the code carried by err or any error it wraps, or fallback.
+func CodeOf(err error, fallback string) string {
+	var c Coder
+	if errors.As(err, &c) {
+		return c.ErrorCode()
+	}
+	return fallback
+}
+
+// DefaultCode maps a status to the generic code used when no more specific one applies.
+func DefaultCode(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
+
+// NotFound and MethodNotAllowed replace the router's plain-text defaults.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, http.StatusNotFound, CodeNotFound, "no route for "+r.URL.Path)
+}
+
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+}
@@ -0,0 +1,48 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type codedErr struct{}
+
+func (codedErr) Error() string     { return "bad name" }
+func (codedErr) ErrorCode() string { return "invalid_domain" }
+
+func TestError_UsesWrappedCode(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/resolve", nil)
+	w := httptest.NewRecorder()
+	Error(w, r, http.StatusBadRequest, fmt.Errorf("item 2: %w", codedErr{}))
+
+	if ct := w.Header().Get("content-type"); ct != ContentType {
+		t.Fatalf("unexpected content-type %q", ct)
+	}
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := Problem{Type: "about:blank", Title: "Bad Request", Status: 400, Detail: "item 2: bad name", Instance: "/api/resolve", Code: "invalid_domain"}
+	if p != want {
+		t.Fatalf("got %+v, want %+v", p, want)
+	}
+}
+
+func TestDefaultCode(t *testing.T) {
+	cases := map[int]string{
+		http.StatusBadRequest:          CodeInvalidRequest,
+		http.StatusNotFound:            CodeNotFound,
+		http.StatusTooManyRequests:     CodeRateLimited,
+		http.StatusServiceUnavailable:  CodeUnavailable,
+		http.StatusInternalServerError: CodeInternal,
+	}
+	for status, want := range cases {
+		if got := CodeOf(errors.New("x"), DefaultCode(status)); got != want {
+			t.Fatalf("%d: got %q, want %q", status, got, want)
+		}
+	}
+}
@@ -8,20 +8,28 @@ import (
 	"time"
 
 	"golang.org/x/time/rate"
+
+	"github.com/legertom/dnsprop/api/internal/problem"
 )
 
-// LimiterMiddleware returns a per-IP token bucket rate limiting middleware.
-// rps: tokens added per second; burst: bucket capacity; ttl: idle time before a client's limiter is evicted.
-func LimiterMiddleware(rps float64, burst int, ttl time.Duration) func(http.Handler) http.Handler {
-	type client struct {
-		lim      *rate.Limiter
-		lastSeen time.Time
-	}
+// Limiter keeps a token bucket per client IP. It is safe for concurrent use.
+type Limiter struct {
+	rps   float64
+	burst int
+
+	mu      sync.Mutex
+	clients map[string]*client
+}
 
-	var (
-		mu      sync.Mutex
-		clients = make(map[string]*client)
-	)
+type client struct {
+	lim      *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewLimiter creates a per-IP limiter.
+// rps: tokens added per second; burst: bucket capacity; ttl: idle time before a client's limiter is evicted.
+func NewLimiter(rps float64, burst int, ttl time.Duration) *Limiter {
+	l := &Limiter{rps: rps, burst: burst, clients: make(map[string]*client)}
 
 	// background cleanup
 	go func() {
@@ -31,47 +39,79 @@ func LimiterMiddleware(rps float64, burst int, ttl time.Duration) func(http.Hand
 		}
 		for {
 			time.Sleep(cleanupInterval)
-			mu.Lock()
+			l.mu.Lock()
 			cut := time.Now().Add(-ttl)
-			for ip, c := range clients {
+			for ip, c := range l.clients {
 				if c.lastSeen.Before(cut) {
-					delete(clients, ip)
+					delete(l.clients, ip)
 				}
 			}
-			mu.Unlock()
+			l.mu.Unlock()
 		}
 	}()
+	return l
+}
 
-	getLimiter := func(ip string) *rate.Limiter {
-		mu.Lock()
-		defer mu.Unlock()
-		if c, ok := clients[ip]; ok {
-			c.lastSeen = time.Now()
-			return c.lim
-		}
-		lim := rate.NewLimiter(rate.Limit(rps), burst)
-		clients[ip] = &client{lim: lim, lastSeen: time.Now()}
-		return lim
+func (l *Limiter) get(ip string) *rate.Limiter {
+	if ip == "" {
+		ip = "unknown"
 	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.clients[ip]; ok {
+		c.lastSeen = time.Now()
+		return c.lim
+	}
+	lim := rate.NewLimiter(rate.Limit(l.rps), l.burst)
+	l.clients[ip] = &client{lim: lim, lastSeen: time.Now()}
+	return lim
+}
 
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ip := clientIP(r)
-			if ip == "" {
-				ip = "unknown"
-			}
-			lim := getLimiter(ip)
-			if !lim.Allow() {
-				w.Header().Set("Retry-After", "1")
-				http.Error(w, "rate limited", http.StatusTooManyRequests)
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
+// Allow consumes one token for ip and reports whether the request may proceed.
+func (l *Limiter) Allow(ip string) bool {
+	return l.get(ip).Allow()
+}
+
+// ReserveN consumes n tokens for ip at once if the bucket holds them. Otherwise it consumes nothing
+// and returns how long until it will; ok is false when n exceeds the burst size, which can never
+// be satisfied.
+func (l *Limiter) ReserveN(ip string, n int) (wait time.Duration, ok bool) {
+	now := time.Now()
+	res := l.get(ip).ReserveN(now, n)
+	if !res.OK() {
+		return 0, false
+	}
+	if wait = res.DelayFrom(now); wait > 0 {
+		res.CancelAt(now)
 	}
+	return wait, true
+}
+
+// Burst returns the bucket capacity, the most tokens ReserveN can ever grant at once.
+func (l *Limiter) Burst() int {
+	return l.burst
+}
+
+// Middleware rejects requests with 429 once the client's bucket is empty.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.Allow(ClientIP(r)) {
+			w.Header().Set("Retry-After", "1")
+			problem.Write(w, r, http.StatusTooManyRequests, problem.CodeRateLimited, "rate limited")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LimiterMiddleware returns a per-IP token bucket rate limiting middleware.
+// rps: tokens added per second; burst: bucket capacity; ttl: idle time before a client's limiter is evicted.
+func LimiterMiddleware(rps float64, burst int, ttl time.Duration) func(http.Handler) http.Handler {
+	return NewLimiter(rps, burst, ttl).Middleware
 }
 
-func clientIP(r *http.Request) string {
+// ClientIP returns the originating client address, preferring X-Forwarded-For and X-Real-IP.
+func ClientIP(r *http.Request) string {
 	// X-Forwarded-For: first is original client
 	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
 		parts := strings.Split(xff, ",")
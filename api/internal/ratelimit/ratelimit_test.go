@@ -63,4 +63,20 @@ func TestLimiterMiddleware_UsesXForwardedFor(t *testing.T) {
 	if len(seenIPs) != 1 || seenIPs[0] != "198.51.100.7" {
 		t.Fatalf("middleware didn't preserve XFF context")
 	}
-}
\ No newline at end of file
+}
+
+func TestLimiter_ReserveN(t *testing.T) {
+	l := NewLimiter(1, 5, time.Minute)
+	if wait, ok := l.ReserveN("203.0.113.9", 4); !ok || wait != 0 {
+		t.Fatalf("expected 4 of 5 tokens to be granted, got wait=%v ok=%v", wait, ok)
+	}
+	if wait, ok := l.ReserveN("203.0.113.9", 3); !ok || wait < time.Second || wait > 2*time.Second {
+		t.Fatalf("expected ~2s to wait for 3 tokens with 1 left, got wait=%v ok=%v", wait, ok)
+	}
+	if !l.Allow("203.0.113.9") {
+		t.Fatal("a reservation that has to wait must not consume tokens")
+	}
+	if _, ok := l.ReserveN("203.0.113.10", 6); ok {
+		t.Fatal("expected n above burst to be impossible")
+	}
+}
@@ -1,7 +1,6 @@
 package validation
 
 import (
-	"errors"
 	"fmt"
 	"net"
 	"strings"
@@ -9,6 +8,29 @@ import (
 	"golang.org/x/net/idna"
 )
 
+// Stable error codes carried by *Error.
+const (
+	CodeInvalidDomain   = "invalid_domain"
+	CodeUnsupportedType = "unsupported_type"
+	CodeTooManyServers  = "too_many_servers"
+	CodeInvalidServer   = "invalid_server"
+)
+
+// Error is a validation failure with a stable, machine-readable code.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// ErrorCode returns the stable code for API error responses.
+func (e *Error) ErrorCode() string { return e.Code }
+
+func newError(code, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
 var supportedRecordTypes = map[string]bool{
 	"A":     true,
 	"AAAA":  true,
@@ -25,7 +47,7 @@ var supportedRecordTypes = map[string]bool{
 func ValidateDomainName(name string) (string, error) {
 	name = strings.TrimSpace(name)
 	if name == "" {
-		return "", errors.New("domain name cannot be empty")
+		return "", newError(CodeInvalidDomain, "domain name cannot be empty")
 	}
 
 	// Remove trailing dot if present
@@ -34,38 +56,38 @@ func ValidateDomainName(name string) (string, error) {
 	// Convert to ASCII (handles IDNA/punycode for internationalized domains)
 	asciiName, err := idna.ToASCII(name)
 	if err != nil {
-		return "", fmt.Errorf("invalid domain name: %w", err)
+		return "", newError(CodeInvalidDomain, "invalid domain name: %v", err)
 	}
 
 	// Check total length (max 253 characters per RFC 1035)
 	if len(asciiName) > 253 {
-		return "", fmt.Errorf("domain name too long: %d characters (max 253)", len(asciiName))
+		return "", newError(CodeInvalidDomain, "domain name too long: %d characters (max 253)", len(asciiName))
 	}
 
 	// Split into labels and validate each
 	labels := strings.Split(asciiName, ".")
 	if len(labels) == 0 {
-		return "", errors.New("domain name must have at least one label")
+		return "", newError(CodeInvalidDomain, "domain name must have at least one label")
 	}
 
 	for _, label := range labels {
 		if len(label) == 0 {
-			return "", errors.New("domain name cannot have empty labels")
+			return "", newError(CodeInvalidDomain, "domain name cannot have empty labels")
 		}
 		if len(label) > 63 {
-			return "", fmt.Errorf("label '%s' too long: %d characters (max 63)", label, len(label))
+			return "", newError(CodeInvalidDomain, "label '%s' too long: %d characters (max 63)", label, len(label))
 		}
 		// Labels must start and end with alphanumeric
 		if !isAlphanumeric(label[0]) {
-			return "", fmt.Errorf("label '%s' must start with letter or digit", label)
+			return "", newError(CodeInvalidDomain, "label '%s' must start with letter or digit", label)
 		}
 		if !isAlphanumeric(label[len(label)-1]) {
-			return "", fmt.Errorf("label '%s' must end with letter or digit", label)
+			return "", newError(CodeInvalidDomain, "label '%s' must end with letter or digit", label)
 		}
 		// Check all characters are valid (alphanumeric or hyphen)
 		for _, ch := range label {
 			if !isAlphanumeric(byte(ch)) && ch != '-' {
-				return "", fmt.Errorf("label '%s' contains invalid character '%c'", label, ch)
+				return "", newError(CodeInvalidDomain, "label '%s' contains invalid character '%c'", label, ch)
 			}
 		}
 	}
@@ -77,10 +99,10 @@ func ValidateDomainName(name string) (string, error) {
 func ValidateRecordType(rtype string) error {
 	rtype = strings.ToUpper(strings.TrimSpace(rtype))
 	if rtype == "" {
-		return errors.New("record type cannot be empty")
+		return newError(CodeUnsupportedType, "record type cannot be empty")
 	}
 	if !supportedRecordTypes[rtype] {
-		return fmt.Errorf("unsupported record type '%s' (supported: A, AAAA, CNAME, TXT, MX, NS, SOA)", rtype)
+		return newError(CodeUnsupportedType, "unsupported record type '%s' (supported: A, AAAA, CNAME, TXT, MX, NS, SOA)", rtype)
 	}
 	return nil
 }
@@ -90,7 +112,7 @@ func ValidateRecordType(rtype string) error {
 // Returns an error if any server is invalid or if the count exceeds maxCount.
 func ValidateServers(servers []string, maxCount int) error {
 	if len(servers) > maxCount {
-		return fmt.Errorf("too many servers: %d (max %d)", len(servers), maxCount)
+		return newError(CodeTooManyServers, "too many servers: %d (max %d)", len(servers), maxCount)
 	}
 
 	for _, server := range servers {
@@ -108,7 +130,7 @@ func ValidateServers(servers []string, maxCount int) error {
 
 		// Validate it's a valid IP address (not a hostname)
 		if net.ParseIP(host) == nil {
-			return fmt.Errorf("invalid server address '%s': must be a valid IPv4 or IPv6 address", server)
+			return newError(CodeInvalidServer, "invalid server address '%s': must be a valid IPv4 or IPv6 address", server)
 		}
 	}
 
@@ -1,6 +1,7 @@
 package validation
 
 import (
+	"errors"
 	"strings"
 	"testing"
 )
@@ -103,3 +104,22 @@ func TestValidateServers(t *testing.T) {
 		})
 	}
 }
+
+func TestErrorCodes(t *testing.T) {
+	_, domainErr := ValidateDomainName("ex@mple.com")
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{domainErr, CodeInvalidDomain},
+		{ValidateRecordType("PTR"), CodeUnsupportedType},
+		{ValidateServers([]string{"1.1.1.1", "8.8.8.8"}, 1), CodeTooManyServers},
+		{ValidateServers([]string{"dns.google"}, 10), CodeInvalidServer},
+	}
+	for _, tt := range tests {
+		var verr *Error
+		if !errors.As(tt.err, &verr) || verr.Code != tt.code {
+			t.Errorf("error %v: want code %q", tt.err, tt.code)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package watch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+)
+
+// Job states.
+const (
+	StateRunning   = "running"
+	StateConverged = "converged"
+	StateExpired   = "expired"
+	StateCancelled = "cancelled"
+)
+
+// finishedRetention is how long finished jobs stay queryable before being purged.
+const finishedRetention = time.Hour
+
+var ErrTooManyJobs = errors.New("too many active watch jobs")
+
+// Spec describes what a watch job polls for.
+type Spec struct {
+	Name    string
+	Type    string
+	Servers []string
+	DNSSEC  bool
+	// Expected answer values, exactly the set every resolver must return; when empty the job waits for all
+	// resolvers to agree on any answer set.
+	Expected []string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// Snapshot is a point-in-time view of a job.
+type Snapshot struct {
+	ID          string
+	Spec        Spec
+	State       string
+	Iterations  int
+	Agreeing    int
+	Unreachable int
+	Total       int
+	StartedAt   time.Time
+	Deadline    time.Time
+	UpdatedAt   time.Time
+	ConvergedAt time.Time
+	Results     []resolver.Result
+}
+
+// Done reports whether the job has stopped polling.
+func (s Snapshot) Done() bool {
+	return s.State != StateRunning
+}
+
+type resolveFunc func(ctx context.Context, name, qtype string, servers []string, dnssec bool, perQueryTimeout time.Duration) []resolver.Result
+
+// Job polls the resolvers until they converge, the deadline passes or it is cancelled.
+type Job struct {
+	mu     sync.Mutex
+	snap   Snapshot
+	subs   map[chan Snapshot]struct{}
+	cancel context.CancelFunc
+}
+
+// Snapshot returns the job's current state.
+func (j *Job) Snapshot() Snapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.snap
+}
+
+// Subscribe returns a channel that receives a snapshot after every poll and is closed when
+// the job finishes. The current snapshot is delivered first. Call the returned func to unsubscribe.
+func (j *Job) Subscribe() (<-chan Snapshot, func()) {
+	ch := make(chan Snapshot, 1)
+	j.mu.Lock()
+	ch <- j.snap
+	if j.snap.Done() {
+		close(ch)
+		j.mu.Unlock()
+		return ch, func() {}
+	}
+	j.subs[ch] = struct{}{}
+	j.mu.Unlock()
+	return ch, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, ok := j.subs[ch]; ok {
+			delete(j.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish stores snap and fans it out; slow subscribers only ever see the latest snapshot.
+func (j *Job) publish(snap Snapshot) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.snap = snap
+	for ch := range j.subs {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- snap
+		if snap.Done() {
+			delete(j.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Manager owns the set of watch jobs. It is safe for concurrent use.
+type Manager struct {
+	mu              sync.Mutex
+	jobs            map[string]*Job
+	maxJobs         int
+	perQueryTimeout time.Duration
+	resolve         resolveFunc
+	wg              sync.WaitGroup
+}
+
+// NewManager creates a manager that allows at most maxJobs running jobs.
+// Polls bypass the resolver cache so every iteration reflects live resolver state.
+func NewManager(maxJobs int, perQueryTimeout time.Duration) *Manager {
+	return &Manager{
+		jobs:            make(map[string]*Job),
+		maxJobs:         maxJobs,
+		perQueryTimeout: perQueryTimeout,
+		resolve: func(ctx context.Context, name, qtype string, servers []string, dnssec bool, perQueryTimeout time.Duration) []resolver.Result {
+			return resolver.Resolve(ctx, name, qtype, servers, dnssec, perQueryTimeout, nil, 0)
+		},
+	}
+}
+
+// Start launches a job for spec.
+func (m *Manager) Start(spec Spec) (*Job, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+
+	m.mu.Lock()
+	running := 0
+	for jid, j := range m.jobs {
+		s := j.Snapshot()
+		if !s.Done() {
+			running++
+		} else if now.Sub(s.UpdatedAt) > finishedRetention {
+			delete(m.jobs, jid)
+		}
+	}
+	if running >= m.maxJobs {
+		m.mu.Unlock()
+		return nil, ErrTooManyJobs
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(spec.Timeout))
+	job := &Job{
+		subs:   make(map[chan Snapshot]struct{}),
+		cancel: cancel,
+		snap: Snapshot{
+			ID:        id,
+			Spec:      spec,
+			State:     StateRunning,
+			Total:     len(spec.Servers),
+			StartedAt: now,
+			Deadline:  now.Add(spec.Timeout),
+			UpdatedAt: now,
+		},
+	}
+	m.jobs[id] = job
+	m.wg.Add(1)
+	m.mu.Unlock()
+
+	go func() {
+		defer m.wg.Done()
+		m.run(ctx, job)
+	}()
+	return job, nil
+}
+
+// Get returns the job with the given id.
+func (m *Manager) Get(id string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	return j, ok
+}
+
+// Cancel stops a running job. It returns false if the job does not exist.
+func (m *Manager) Cancel(id string) bool {
+	j, ok := m.Get(id)
+	if !ok {
+		return false
+	}
+	j.cancel()
+	return true
+}
+
+// Close cancels all jobs and waits for them to stop.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	for _, j := range m.jobs {
+		j.cancel()
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+func (m *Manager) run(ctx context.Context, job *Job) {
+	defer job.cancel()
+	ticker := time.NewTicker(job.Snapshot().Spec.Interval)
+	defer ticker.Stop()
+
+	for {
+		snap := job.Snapshot()
+		results := m.resolve(ctx, snap.Spec.Name, snap.Spec.Type, snap.Spec.Servers, snap.Spec.DNSSEC, m.perQueryTimeout)
+		now := time.Now().UTC()
+		if ctx.Err() == nil {
+			snap.Iterations++
+			snap.Results = results
+			snap.Agreeing, snap.Unreachable = Agreement(results, snap.Spec.Expected)
+			snap.Total = len(results)
+			if snap.Agreeing > 0 && snap.Agreeing+snap.Unreachable == snap.Total {
+				snap.State = StateConverged
+				snap.ConvergedAt = now
+			}
+		}
+		snap.UpdatedAt = now
+		if snap.State == StateRunning && ctx.Err() != nil {
+			snap.State = StateCancelled
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				snap.State = StateExpired
+			}
+		}
+		job.publish(snap)
+		if snap.Done() {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
+
+// Agreement counts resolvers whose answers are exactly the expected values (or, without an
+// expectation, the most common successful answer set) and resolvers that could not be reached at
+// all. A resolver still returning an old value next to the expected ones has not converged.
+// Unreachable resolvers do not block convergence since they may never answer.
+func Agreement(results []resolver.Result, expected []string) (agreeing, unreachable int) {
+	want := normalize(expected)
+	match := func(r resolver.Result) bool { return sameSet(answerValues(r), want) }
+	if len(expected) == 0 {
+		counts := map[string]int{}
+		common, best := "", 0
+		for _, r := range results {
+			if r.Status != "ok" {
+				continue
+			}
+			key := strings.Join(answerValues(r), "\n")
+			counts[key]++
+			if counts[key] > best {
+				best, common = counts[key], key
+			}
+		}
+		match = func(r resolver.Result) bool { return best > 0 && strings.Join(answerValues(r), "\n") == common }
+	}
+	for _, r := range results {
+		switch {
+		case r.Status == "timeout" || r.Status == "error":
+			unreachable++
+		case r.Status == "ok" && match(r):
+			agreeing++
+		}
+	}
+	return agreeing, unreachable
+}
+
+func answerValues(r resolver.Result) []string {
+	values := make([]string, 0, len(r.Answers))
+	for _, a := range r.Answers {
+		values = append(values, a.Value)
+	}
+	return normalize(values)
+}
+
+// normalize lower-cases, trims trailing dots and sorts values for order-insensitive comparison.
+func normalize(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, strings.TrimSuffix(strings.ToLower(strings.TrimSpace(v)), "."))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// sameSet reports whether two normalized value lists hold the same values, ignoring duplicates.
+func sameSet(a, b []string) bool {
+	return slices.Equal(slices.Compact(a), slices.Compact(slices.Clone(b)))
+}
+
+func newID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
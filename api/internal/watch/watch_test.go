@@ -0,0 +1,98 @@
+package watch
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	resolver "github.com/legertom/dnsprop/api/internal/dnsresolver"
+)
+
+func answer(v string) resolver.Result {
+	return resolver.Result{Status: "ok", Answers: []resolver.Answer{{Value: v}}}
+}
+
+func TestManager_ConvergesOnExpected(t *testing.T) {
+	m := NewManager(10, time.Second)
+	defer m.Close()
+	var calls atomic.Int32
+	m.resolve = func(ctx context.Context, name, qtype string, servers []string, dnssec bool, _ time.Duration) []resolver.Result {
+		if calls.Add(1) < 3 {
+			return []resolver.Result{answer("192.0.2.1"), answer("192.0.2.2"), {Status: "timeout"}}
+		}
+		return []resolver.Result{answer("192.0.2.2"), answer("192.0.2.2"), {Status: "timeout"}}
+	}
+
+	job, err := m.Start(Spec{Name: "example.com", Type: "A", Servers: []string{"a", "b", "c"}, Expected: []string{"192.0.2.2"}, Interval: 5 * time.Millisecond, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	updates, unsubscribe := job.Subscribe()
+	defer unsubscribe()
+	var last Snapshot
+	for s := range updates {
+		last = s
+	}
+	if last.State != StateConverged || last.Iterations != 3 {
+		t.Fatalf("expected convergence on 3rd poll, got state=%s iterations=%d", last.State, last.Iterations)
+	}
+	if last.Agreeing != 2 || last.Unreachable != 1 {
+		t.Fatalf("agreeing=%d unreachable=%d", last.Agreeing, last.Unreachable)
+	}
+	if got, _ := m.Get(last.ID); got != job {
+		t.Fatalf("Get did not return the job")
+	}
+}
+
+func TestAgreement_RequiresExactlyTheExpectedAnswers(t *testing.T) {
+	both := resolver.Result{Status: "ok", Answers: []resolver.Answer{{Value: "192.0.2.1"}, {Value: "192.0.2.2"}}}
+	results := []resolver.Result{both, answer("192.0.2.2"), answer("192.0.2.2."), {Status: "error"}}
+	if agreeing, unreachable := Agreement(results, []string{"192.0.2.2"}); agreeing != 2 || unreachable != 1 {
+		t.Fatalf("expected the resolver still returning the old record not to agree, got agreeing=%d unreachable=%d", agreeing, unreachable)
+	}
+	if agreeing, _ := Agreement(results, []string{"192.0.2.2", "192.0.2.1"}); agreeing != 1 {
+		t.Fatalf("expected only the resolver returning both records to agree, got %d", agreeing)
+	}
+}
+
+func TestManager_Expires(t *testing.T) {
+	m := NewManager(10, time.Second)
+	defer m.Close()
+	m.resolve = func(ctx context.Context, name, qtype string, servers []string, dnssec bool, _ time.Duration) []resolver.Result {
+		return []resolver.Result{answer("192.0.2.1"), answer("192.0.2.2")}
+	}
+	job, err := m.Start(Spec{Name: "example.com", Type: "A", Interval: 5 * time.Millisecond, Timeout: 30 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	updates, _ := job.Subscribe()
+	for range updates {
+	}
+	if s := job.Snapshot(); s.State != StateExpired {
+		t.Fatalf("expected expired, got %s", s.State)
+	}
+}
+
+func TestManager_CancelAndLimit(t *testing.T) {
+	m := NewManager(1, time.Second)
+	defer m.Close()
+	m.resolve = func(ctx context.Context, name, qtype string, servers []string, dnssec bool, _ time.Duration) []resolver.Result {
+		return []resolver.Result{answer("192.0.2.1"), answer("192.0.2.2")}
+	}
+	spec := Spec{Name: "example.com", Type: "A", Interval: time.Hour, Timeout: time.Hour}
+	job, err := m.Start(spec)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := m.Start(spec); err != ErrTooManyJobs {
+		t.Fatalf("expected ErrTooManyJobs, got %v", err)
+	}
+	updates, _ := job.Subscribe()
+	m.Cancel(job.Snapshot().ID)
+	for range updates {
+	}
+	if s := job.Snapshot(); s.State != StateCancelled {
+		t.Fatalf("expected cancelled, got %s", s.State)
+	}
+}
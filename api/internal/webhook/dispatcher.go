@@ -0,0 +1,231 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/legertom/dnsprop/api/internal/monitor"
+)
+
+// Dispatcher turns monitor checks into deliveries to the stored webhooks. Each delivery is sent
+// from its own goroutine and retried with exponential backoff; every attempt updates its entry in
+// the delivery log.
+type Dispatcher struct {
+	store        Store
+	client       *http.Client
+	maxWebhooks  int
+	maxAttempts  int
+	backoff      time.Duration
+	allowPrivate bool
+
+	createMu sync.Mutex // serializes Create so maxWebhooks holds
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher creates a dispatcher that allows at most maxWebhooks webhooks and tries each
+// delivery up to maxAttempts times, waiting backoff, then twice as long, and so on between
+// attempts. timeout bounds a single attempt. Webhooks may only point at public addresses unless
+// allowPrivate is set.
+func NewDispatcher(store Store, maxWebhooks, maxAttempts int, backoff, timeout time.Duration, allowPrivate bool) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		store:        store,
+		client:       newClient(timeout, allowPrivate),
+		maxWebhooks:  maxWebhooks,
+		maxAttempts:  maxAttempts,
+		backoff:      backoff,
+		allowPrivate: allowPrivate,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// Create stores w (see Store.Create), or returns ErrTooManyWebhooks when the limit is reached.
+func (d *Dispatcher) Create(ctx context.Context, w *Webhook) error {
+	d.createMu.Lock()
+	defer d.createMu.Unlock()
+	hooks, err := d.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	if len(hooks) >= d.maxWebhooks {
+		return ErrTooManyWebhooks
+	}
+	return d.store.Create(ctx, w)
+}
+
+func (d *Dispatcher) Get(ctx context.Context, id string) (Webhook, error) {
+	return d.store.Get(ctx, id)
+}
+
+func (d *Dispatcher) List(ctx context.Context) ([]Webhook, error) {
+	return d.store.List(ctx)
+}
+
+// Delete removes a webhook with its delivery log. Deliveries already queued still go out.
+func (d *Dispatcher) Delete(ctx context.Context, id string) error {
+	return d.store.Delete(ctx, id)
+}
+
+// Deliveries returns up to limit deliveries of a webhook, newest first.
+func (d *Dispatcher) Deliveries(ctx context.Context, id string, limit int) ([]Delivery, error) {
+	if _, err := d.store.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return d.store.Deliveries(ctx, id, limit)
+}
+
+// PruneDeliveries is a monitor.Pruner that trims the delivery log; see Store.DeleteDeliveriesBefore.
+func (d *Dispatcher) PruneDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	return d.store.DeleteDeliveriesBefore(ctx, before)
+}
+
+// HandleMonitorEvent is a monitor.Listener. It queues a delivery to every webhook subscribed to
+// an event the check raised.
+func (d *Dispatcher) HandleMonitorEvent(ctx context.Context, e monitor.Event) {
+	hooks, err := d.store.List(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "webhook_list_failed", slog.String("error", err.Error()))
+		return
+	}
+	for _, w := range hooks {
+		for _, event := range eventsFor(e, w.ThresholdPercent) {
+			if !w.Wants(event, e.Monitor.ID) {
+				continue
+			}
+			d.enqueue(w, newPayload(event, e, w.ThresholdPercent))
+		}
+	}
+}
+
+// Test sends a ping to the webhook with id once, without retrying, and returns the logged delivery.
+func (d *Dispatcher) Test(ctx context.Context, id string) (Delivery, error) {
+	w, err := d.store.Get(ctx, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+	del, body, err := d.prepare(ctx, w, pingPayload(time.Now().UTC()))
+	if err != nil {
+		return Delivery{}, err
+	}
+	d.attempt(ctx, w, &del, body)
+	if del.State == DeliveryPending {
+		del.State = DeliveryFailed
+	}
+	if err := d.store.SaveDelivery(ctx, &del); err != nil {
+		return Delivery{}, err
+	}
+	return del, nil
+}
+
+// Close abandons pending retries and waits for attempts in flight to finish.
+func (d *Dispatcher) Close() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) enqueue(w Webhook, p Payload) {
+	del, body, err := d.prepare(d.ctx, w, p)
+	if err != nil {
+		slog.WarnContext(d.ctx, "webhook_prepare_failed", slog.String("webhook", w.ID), slog.String("error", err.Error()))
+		return
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.deliver(w, &del, body)
+	}()
+}
+
+// prepare renders p for w and logs it as a pending delivery. The delivery ID doubles as the
+// payload ID so receivers can drop retried duplicates.
+func (d *Dispatcher) prepare(ctx context.Context, w Webhook, p Payload) (Delivery, []byte, error) {
+	id, err := randomHex(12)
+	if err != nil {
+		return Delivery{}, nil, err
+	}
+	p.ID = id
+	body, err := render(w.Format, p)
+	if err != nil {
+		return Delivery{}, nil, err
+	}
+	del := Delivery{ID: id, WebhookID: w.ID, Event: p.Event, State: DeliveryPending, Payload: body}
+	if err := d.store.SaveDelivery(ctx, &del); err != nil {
+		return Delivery{}, nil, err
+	}
+	return del, body, nil
+}
+
+func (d *Dispatcher) deliver(w Webhook, del *Delivery, body []byte) {
+	wait := d.backoff
+	for {
+		d.attempt(d.ctx, w, del, body)
+		if del.State == DeliveryPending && del.Attempts >= d.maxAttempts {
+			del.State = DeliveryFailed
+		}
+		if err := d.store.SaveDelivery(d.ctx, del); err != nil {
+			slog.WarnContext(d.ctx, "webhook_log_failed", slog.String("delivery", del.ID), slog.String("error", err.Error()))
+		}
+		if del.State != DeliveryPending {
+			if del.State == DeliveryFailed {
+				slog.WarnContext(d.ctx, "webhook_delivery_failed", slog.String("webhook", w.ID), slog.String("delivery", del.ID),
+					slog.Int("attempts", del.Attempts), slog.String("error", del.Error))
+			}
+			return
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-d.ctx.Done():
+			t.Stop()
+			return // left pending in the log
+		case <-t.C:
+		}
+		wait *= 2
+	}
+}
+
+// attempt sends body once and records the outcome on del. del stays pending when the attempt
+// failed in a way worth retrying: a network error, 429 or 5xx.
+func (d *Dispatcher) attempt(ctx context.Context, w Webhook, del *Delivery, body []byte) {
+	del.Attempts++
+	del.StatusCode, del.Error = 0, ""
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		del.State, del.Error = DeliveryFailed, err.Error()
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "dnsprop-webhook")
+	req.Header.Set(HeaderEvent, del.Event)
+	req.Header.Set(HeaderDelivery, del.ID)
+	req.Header.Set(HeaderSignatureTimestamp, ts)
+	req.Header.Set(HeaderSignature, Sign(w.Secret, ts, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		del.Error = err.Error()
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	del.StatusCode = resp.StatusCode
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		del.State = DeliverySucceeded
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		del.Error = fmt.Sprintf("receiver answered %d", resp.StatusCode)
+	default:
+		del.State, del.Error = DeliveryFailed, fmt.Sprintf("receiver answered %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,307 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/legertom/dnsprop/api/internal/monitor"
+)
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is a local webhook endpoint that answers with the given status codes in turn, then 204.
+func receiver(t *testing.T, statuses ...int) (*httptest.Server, func() []received) {
+	t.Helper()
+	var (
+		mu  sync.Mutex
+		got []received
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, received{header: r.Header.Clone(), body: body})
+		n := len(got)
+		mu.Unlock()
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []received {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]received(nil), got...)
+	}
+}
+
+func newTestDispatcher(t *testing.T, maxAttempts int) (*Dispatcher, *SQLiteStore) {
+	t.Helper()
+	store, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(store, 10, maxAttempts, time.Millisecond, time.Second, true)
+	t.Cleanup(func() {
+		d.Close()
+		store.Close()
+	})
+	return d, store
+}
+
+// stateChange is a check that moved a monitor from ok to mismatch with new answers.
+func stateChange(monitorID string) monitor.Event {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	prev := monitor.Result{ID: 1, State: monitor.StateOK, Agreeing: 2, Total: 2, Servers: []monitor.ServerResult{
+		{Server: "a", Status: "ok", Answers: []string{"192.0.2.1"}}, {Server: "b", Status: "ok", Answers: []string{"192.0.2.1"}}}}
+	return monitor.Event{
+		Monitor: monitor.Monitor{
+			ID:     monitorID,
+			Spec:   monitor.Spec{Name: "example.com", Type: "A", Expected: []string{"192.0.2.1"}},
+			Status: monitor.Status{State: monitor.StateMismatch, Agreeing: 1, Total: 2},
+		},
+		Previous:       monitor.Status{State: monitor.StateOK, Agreeing: 2, Total: 2},
+		PreviousResult: &prev,
+		Result: monitor.Result{ID: 2, CheckedAt: now, State: monitor.StateMismatch, Agreeing: 1, Total: 2, Servers: []monitor.ServerResult{
+			{Server: "a", Status: "ok", Answers: []string{"192.0.2.1"}}, {Server: "b", Status: "ok", Answers: []string{"192.0.2.9"}}}},
+	}
+}
+
+func TestDispatcher_SignsAndRetries(t *testing.T) {
+	d, store := newTestDispatcher(t, 3)
+	srv, got := receiver(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	ctx := context.Background()
+	w := Webhook{URL: srv.URL, Format: FormatJSON, Events: []string{EventStateChanged}}
+	if err := store.Create(ctx, &w); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Secret) != 64 {
+		t.Fatalf("expected a generated secret, got %q", w.Secret)
+	}
+
+	d.HandleMonitorEvent(ctx, stateChange("m1"))
+	d.wg.Wait()
+
+	reqs := got()
+	if len(reqs) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(reqs))
+	}
+	for _, r := range reqs {
+		if !Verify(w.Secret, r.header.Get(HeaderSignatureTimestamp), r.body, r.header.Get(HeaderSignature)) {
+			t.Fatalf("bad signature %q", r.header.Get(HeaderSignature))
+		}
+		if r.header.Get(HeaderEvent) != EventStateChanged || r.header.Get(HeaderDelivery) != reqs[0].header.Get(HeaderDelivery) {
+			t.Fatalf("unexpected headers: %v", r.header)
+		}
+	}
+	var p Payload
+	if err := json.Unmarshal(reqs[0].body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != reqs[0].header.Get(HeaderDelivery) || p.State != monitor.StateMismatch || p.PreviousState != monitor.StateOK ||
+		p.Monitor == nil || p.Monitor.ID != "m1" || p.PropagationPercent != 50 || p.Text == "" {
+		t.Fatalf("unexpected payload: %+v", p)
+	}
+
+	log, err := d.Deliveries(ctx, w.ID, 10)
+	if err != nil || len(log) != 1 {
+		t.Fatalf("expected one logged delivery, got %+v, %v", log, err)
+	}
+	if log[0].State != DeliverySucceeded || log[0].Attempts != 3 || log[0].StatusCode != http.StatusNoContent || string(log[0].Payload) != string(reqs[0].body) {
+		t.Fatalf("unexpected delivery: %+v", log[0])
+	}
+}
+
+func TestDispatcher_GivesUp(t *testing.T) {
+	d, store := newTestDispatcher(t, 5)
+	srv, got := receiver(t, http.StatusBadRequest)
+	ctx := context.Background()
+	w := Webhook{URL: srv.URL, Format: FormatSlack}
+	store.Create(ctx, &w)
+
+	d.HandleMonitorEvent(ctx, stateChange("m1"))
+	d.wg.Wait()
+
+	// 400 is not retried; state_changed and answers_changed are two deliveries
+	if n := len(got()); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+	log, _ := d.Deliveries(ctx, w.ID, 10)
+	if len(log) != 2 {
+		t.Fatalf("expected 2 deliveries, got %+v", log)
+	}
+	failed := 0
+	for _, del := range log {
+		if del.State == DeliveryFailed && del.Attempts == 1 && del.StatusCode == http.StatusBadRequest {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Fatalf("expected one failed delivery, got %+v", log)
+	}
+}
+
+func TestDispatcher_Filters(t *testing.T) {
+	d, store := newTestDispatcher(t, 1)
+	srv, got := receiver(t)
+	ctx := context.Background()
+	store.Create(ctx, &Webhook{URL: srv.URL, Format: FormatJSON, MonitorIDs: []string{"other"}})
+	store.Create(ctx, &Webhook{URL: srv.URL, Format: FormatJSON, Events: []string{EventBelowThreshold}, ThresholdPercent: 60})
+
+	first := stateChange("m1")
+	first.Previous, first.PreviousResult = monitor.Status{State: monitor.StatePending}, nil
+	d.HandleMonitorEvent(ctx, first) // a monitor's first check raises nothing
+	d.HandleMonitorEvent(ctx, stateChange("m1"))
+	d.wg.Wait()
+
+	reqs := got()
+	if len(reqs) != 1 || reqs[0].header.Get(HeaderEvent) != EventBelowThreshold {
+		t.Fatalf("expected a single below_threshold delivery, got %d requests", len(reqs))
+	}
+}
+
+func TestDispatcher_Test(t *testing.T) {
+	d, store := newTestDispatcher(t, 5)
+	srv, got := receiver(t, http.StatusServiceUnavailable)
+	ctx := context.Background()
+	w := Webhook{URL: srv.URL, Format: FormatTeams}
+	store.Create(ctx, &w)
+
+	del, err := d.Test(ctx, w.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// pings are not retried
+	if del.State != DeliveryFailed || del.Attempts != 1 || del.StatusCode != http.StatusServiceUnavailable || len(got()) != 1 {
+		t.Fatalf("unexpected ping delivery: %+v", del)
+	}
+	if del, _ = d.Test(ctx, w.ID); del.State != DeliverySucceeded || del.Event != EventPing {
+		t.Fatalf("unexpected ping delivery: %+v", del)
+	}
+	if _, err := d.Test(ctx, "missing"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDispatcher_RefusesPrivateAddresses(t *testing.T) {
+	store, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(store, 10, 1, time.Millisecond, time.Second, false)
+	t.Cleanup(func() {
+		d.Close()
+		store.Close()
+	})
+	srv, got := receiver(t)
+	ctx := context.Background()
+
+	for _, u := range []string{srv.URL, "http://localhost/hook", "http://10.0.0.1/", "http://[fe80::1]/", "http://0.0.0.0/", "http://[::ffff:127.0.0.1]/"} {
+		if err := d.CheckURL(ctx, u); err != ErrForbiddenAddress {
+			t.Fatalf("%s: expected ErrForbiddenAddress, got %v", u, err)
+		}
+	}
+	if err := d.CheckURL(ctx, "https://192.0.2.10/hook"); err != nil {
+		t.Fatalf("expected a public address to pass, got %v", err)
+	}
+
+	// A webhook that got past the check (e.g. its name now resolves elsewhere) is refused when dialing.
+	w := Webhook{URL: srv.URL, Format: FormatJSON}
+	store.Create(ctx, &w)
+	del, err := d.Test(ctx, w.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if del.State != DeliveryFailed || !strings.Contains(del.Error, ErrForbiddenAddress.Error()) || len(got()) != 0 {
+		t.Fatalf("expected the delivery to be refused before connecting, got %+v", del)
+	}
+}
+
+func TestDispatcher_DoesNotFollowRedirects(t *testing.T) {
+	d, store := newTestDispatcher(t, 1)
+	target, got := receiver(t)
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	t.Cleanup(redirect.Close)
+	ctx := context.Background()
+	w := Webhook{URL: redirect.URL, Format: FormatJSON}
+	store.Create(ctx, &w)
+
+	del, err := d.Test(ctx, w.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if del.State != DeliveryFailed || del.StatusCode != http.StatusTemporaryRedirect || len(got()) != 0 {
+		t.Fatalf("expected the redirect to fail the delivery, got %+v", del)
+	}
+}
+
+func TestDispatcher_LimitsWebhooks(t *testing.T) {
+	store, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(store, 2, 1, time.Millisecond, time.Second, true)
+	t.Cleanup(func() {
+		d.Close()
+		store.Close()
+	})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- d.Create(ctx, &Webhook{URL: "https://example.com/hook", Format: FormatJSON})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	created := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			created++
+		case ErrTooManyWebhooks:
+		default:
+			t.Fatal(err)
+		}
+	}
+	if hooks, _ := d.List(ctx); created != 2 || len(hooks) != 2 {
+		t.Fatalf("expected exactly 2 webhooks, created %d, stored %d", created, len(hooks))
+	}
+}
+
+func TestDispatcher_PruneDeliveries(t *testing.T) {
+	d, store := newTestDispatcher(t, 1)
+	ctx := context.Background()
+	w := Webhook{URL: "https://example.com/hook", Format: FormatJSON}
+	store.Create(ctx, &w)
+	for _, state := range []string{DeliverySucceeded, DeliveryFailed, DeliveryPending} {
+		if err := store.SaveDelivery(ctx, &Delivery{WebhookID: w.ID, Event: EventPing, State: state, Payload: json.RawMessage(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := d.PruneDeliveries(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Fatalf("expected recent deliveries to be kept, got %d, %v", n, err)
+	}
+	if n, err := d.PruneDeliveries(ctx, time.Now().Add(time.Hour)); err != nil || n != 2 {
+		t.Fatalf("expected the finished deliveries to be pruned, got %d, %v", n, err)
+	}
+	if log, _ := d.Deliveries(ctx, w.ID, 10); len(log) != 1 || log[0].State != DeliveryPending {
+		t.Fatalf("expected only the pending delivery to remain, got %+v", log)
+	}
+}
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned for webhook URLs that point at this host or its private network.
+// Anyone can register a webhook and read its delivery log, so without this check webhooks could be
+// used to probe internal services.
+var ErrForbiddenAddress = errors.New("webhook url must not resolve to a loopback, private, link-local or unspecified address")
+
+// publicAddr reports whether ip may receive webhook deliveries.
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsValid() && !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast()
+}
+
+// CheckURL resolves the host of rawURL and returns ErrForbiddenAddress if any of its addresses is
+// not public. It runs when a webhook is created; deliveries check the address they actually dial
+// again, so a name that later resolves somewhere else is still refused.
+func (d *Dispatcher) CheckURL(ctx context.Context, rawURL string) error {
+	if d.allowPrivate {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !publicAddr(ip) {
+			return ErrForbiddenAddress
+		}
+		return nil
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("webhook url host %q does not resolve", host)
+	}
+	for _, ip := range ips {
+		if !publicAddr(ip) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// newClient returns the client deliveries are sent with. Unless allowPrivate is set it refuses to
+// connect to non-public addresses, checked at dial time so DNS rebinding cannot get around it. It
+// never follows redirects, which could lead anywhere; a redirect counts as a failed delivery.
+func newClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil || !publicAddr(ap.Addr()) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // the dialer must see the receiver's address, not a proxy's
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,179 @@
+package webhook
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/legertom/dnsprop/api/internal/monitor"
+)
+
+//go:embed templates/message.tmpl
+var templateFS embed.FS
+
+var messages = template.Must(template.New("message.tmpl").
+	Funcs(template.FuncMap{"join": strings.Join}).
+	ParseFS(templateFS, "templates/message.tmpl"))
+
+type PayloadMonitor struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Expected []string `json:"expected,omitempty"`
+}
+
+// Payload is the body of a json-format delivery. Monitor is absent on ping events.
+type Payload struct {
+	ID                 string          `json:"id"`
+	Event              string          `json:"event"`
+	OccurredAt         time.Time       `json:"occurred_at"`
+	Monitor            *PayloadMonitor `json:"monitor,omitempty"`
+	State              string          `json:"state,omitempty"`
+	PreviousState      string          `json:"previous_state,omitempty"`
+	Agreeing           int             `json:"agreeing"`
+	Unreachable        int             `json:"unreachable"`
+	Total              int             `json:"total"`
+	PropagationPercent int             `json:"propagation_percent"`
+	ThresholdPercent   int             `json:"threshold_percent,omitempty"`
+	AnswersBefore      []string        `json:"answers_before,omitempty"`
+	AnswersAfter       []string        `json:"answers_after,omitempty"`
+	Title              string          `json:"title"`
+	Text               string          `json:"text"`
+}
+
+// slackMessage is accepted by Slack (and Mattermost) incoming webhooks.
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// teamsMessage is a legacy MessageCard, accepted by Microsoft Teams incoming webhooks.
+type teamsMessage struct {
+	Type       string `json:"@type"`
+	Context    string `json:"@context"`
+	Summary    string `json:"summary"`
+	ThemeColor string `json:"themeColor"`
+	Title      string `json:"title"`
+	Text       string `json:"text"`
+}
+
+// eventsFor returns the events a monitor check raises for a webhook with the given threshold.
+// Nothing is raised by the first check after a monitor is created or updated, so a new monitor
+// does not announce itself.
+func eventsFor(e monitor.Event, thresholdPercent int) []string {
+	if e.Previous.State == monitor.StatePending || e.PreviousResult == nil {
+		return nil
+	}
+	var out []string
+	if e.Changed() {
+		out = append(out, EventStateChanged)
+	}
+	if !slices.Equal(answerValues(*e.PreviousResult), answerValues(e.Result)) {
+		out = append(out, EventAnswersChanged)
+	}
+	if thresholdPercent > 0 && percent(e.Result) < thresholdPercent && percent(*e.PreviousResult) >= thresholdPercent {
+		out = append(out, EventBelowThreshold)
+	}
+	return out
+}
+
+// newPayload describes e as event; the caller fills in ID.
+func newPayload(event string, e monitor.Event, thresholdPercent int) Payload {
+	p := Payload{
+		Event:      event,
+		OccurredAt: e.Result.CheckedAt,
+		Monitor: &PayloadMonitor{
+			ID:       e.Monitor.ID,
+			Name:     e.Monitor.Spec.Name,
+			Type:     e.Monitor.Spec.Type,
+			Expected: e.Monitor.Spec.Expected,
+		},
+		State:              e.Monitor.Status.State,
+		PreviousState:      e.Previous.State,
+		Agreeing:           e.Result.Agreeing,
+		Unreachable:        e.Result.Unreachable,
+		Total:              e.Result.Total,
+		PropagationPercent: percent(e.Result),
+		AnswersAfter:       answerValues(e.Result),
+	}
+	if event == EventBelowThreshold {
+		p.ThresholdPercent = thresholdPercent
+	}
+	if e.PreviousResult != nil {
+		p.AnswersBefore = answerValues(*e.PreviousResult)
+	}
+	return p
+}
+
+func pingPayload(now time.Time) Payload {
+	return Payload{Event: EventPing, OccurredAt: now}
+}
+
+// render fills in the message and encodes p in format.
+func render(format string, p Payload) ([]byte, error) {
+	var title, text bytes.Buffer
+	if err := messages.ExecuteTemplate(&title, "title."+p.Event, p); err != nil {
+		return nil, err
+	}
+	if err := messages.ExecuteTemplate(&text, "text."+p.Event, p); err != nil {
+		return nil, err
+	}
+	p.Title, p.Text = title.String(), text.String()
+
+	switch format {
+	case FormatSlack:
+		return json.Marshal(slackMessage{Text: "*" + p.Title + "*\n" + p.Text})
+	case FormatTeams:
+		return json.Marshal(teamsMessage{
+			Type:       "MessageCard",
+			Context:    "https://schema.org/extensions",
+			Summary:    p.Title,
+			ThemeColor: themeColor(p.State),
+			Title:      p.Title,
+			Text:       p.Text,
+		})
+	case FormatJSON, "":
+		return json.Marshal(p)
+	}
+	return nil, fmt.Errorf("unknown webhook format %q", format)
+}
+
+func themeColor(state string) string {
+	switch state {
+	case monitor.StateOK:
+		return "2EB886"
+	case monitor.StateMismatch:
+		return "DAA038"
+	case monitor.StateFailing:
+		return "A30200"
+	}
+	return "439FE0"
+}
+
+// answerValues is the sorted set of answer values any resolver returned.
+func answerValues(r monitor.Result) []string {
+	set := map[string]struct{}{}
+	for _, s := range r.Servers {
+		for _, a := range s.Answers {
+			set[strings.TrimSuffix(strings.ToLower(a), ".")] = struct{}{}
+		}
+	}
+	out := make([]string, 0, len(set))
+	for v := range set {
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func percent(r monitor.Result) int {
+	if r.Total == 0 {
+		return 0
+	}
+	return r.Agreeing * 100 / r.Total
+}
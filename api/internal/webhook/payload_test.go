@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRender_Formats(t *testing.T) {
+	p := newPayload(EventStateChanged, stateChange("m1"), 0)
+
+	b, err := render(FormatSlack, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var slack map[string]string
+	json.Unmarshal(b, &slack)
+	if want := "*example.com A is mismatch*\nState changed from ok to mismatch. 1/2 resolvers agree, 0 unreachable."; slack["text"] != want {
+		t.Fatalf("slack text = %q, want %q", slack["text"], want)
+	}
+
+	b, err = render(FormatTeams, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var teams map[string]string
+	json.Unmarshal(b, &teams)
+	if teams["@type"] != "MessageCard" || teams["title"] != "example.com A is mismatch" || teams["themeColor"] != "DAA038" {
+		t.Fatalf("unexpected teams card: %v", teams)
+	}
+
+	answers := newPayload(EventAnswersChanged, stateChange("m1"), 0)
+	b, _ = render(FormatJSON, answers)
+	var out Payload
+	json.Unmarshal(b, &out)
+	if !strings.Contains(out.Text, "192.0.2.1, 192.0.2.9 (was 192.0.2.1)") {
+		t.Fatalf("unexpected answers text: %q", out.Text)
+	}
+
+	if _, err := render("xml", p); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	sig := Sign("s3cret", "1700000000", []byte(`{"a":1}`))
+	if !strings.HasPrefix(sig, "sha256=") || !Verify("s3cret", "1700000000", []byte(`{"a":1}`), sig) {
+		t.Fatalf("signature did not verify: %s", sig)
+	}
+	if Verify("s3cret", "1700000001", []byte(`{"a":1}`), sig) || Verify("other", "1700000000", []byte(`{"a":1}`), sig) {
+		t.Fatal("signature verified with the wrong timestamp or secret")
+	}
+}
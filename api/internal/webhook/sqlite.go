@@ -0,0 +1,220 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS webhooks (
+	id          TEXT PRIMARY KEY,
+	url         TEXT NOT NULL,
+	secret      TEXT NOT NULL,
+	format      TEXT NOT NULL,
+	events      TEXT NOT NULL,
+	monitor_ids TEXT NOT NULL,
+	threshold   INTEGER NOT NULL,
+	created_at  INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id          TEXT PRIMARY KEY,
+	webhook_id  TEXT NOT NULL,
+	event       TEXT NOT NULL,
+	state       TEXT NOT NULL,
+	attempts    INTEGER NOT NULL,
+	status_code INTEGER NOT NULL,
+	error       TEXT NOT NULL,
+	payload     TEXT NOT NULL,
+	created_at  INTEGER NOT NULL,
+	updated_at  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook ON webhook_deliveries (webhook_id, created_at DESC, id DESC);
+`
+
+const webhookColumns = `id, url, secret, format, events, monitor_ids, threshold, created_at`
+
+// SQLiteStore is a Store backed by a SQLite database file. It can share the file used for
+// history.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens (creating if needed) the database at path. ":memory:" gives a private
+// in-memory database, which is useful in tests.
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time, and each connection to ":memory:" is its own database.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("webhook schema: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Create(ctx context.Context, w *Webhook) error {
+	id, err := randomHex(12)
+	if err != nil {
+		return err
+	}
+	if w.Secret == "" {
+		if w.Secret, err = randomHex(32); err != nil {
+			return err
+		}
+	}
+	w.ID, w.CreatedAt = id, time.Now().UTC()
+	events, err := json.Marshal(nonNil(w.Events))
+	if err != nil {
+		return err
+	}
+	monitorIDs, err := json.Marshal(nonNil(w.MonitorIDs))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO webhooks (`+webhookColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.ID, w.URL, w.Secret, w.Format, string(events), string(monitorIDs), w.ThresholdPercent, w.CreatedAt.UnixNano())
+	return err
+}
+
+func (s *SQLiteStore) Get(ctx context.Context, id string) (Webhook, error) {
+	w, err := scanWebhook(s.db.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Webhook{}, ErrNotFound
+	}
+	return w, err
+}
+
+func (s *SQLiteStore) List(ctx context.Context) ([]Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+webhookColumns+` FROM webhooks ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) Delete(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) DeleteDeliveriesBefore(ctx context.Context, t time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE updated_at < ? AND state != ?`,
+		t.UnixNano(), DeliveryPending)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLiteStore) SaveDelivery(ctx context.Context, d *Delivery) error {
+	if d.ID == "" {
+		id, err := randomHex(12)
+		if err != nil {
+			return err
+		}
+		d.ID = id
+	}
+	now := time.Now().UTC()
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = now
+	}
+	d.UpdatedAt = now
+	_, err := s.db.ExecContext(ctx, `INSERT INTO webhook_deliveries
+		(id, webhook_id, event, state, attempts, status_code, error, payload, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			state = excluded.state, attempts = excluded.attempts, status_code = excluded.status_code,
+			error = excluded.error, updated_at = excluded.updated_at`,
+		d.ID, d.WebhookID, d.Event, d.State, d.Attempts, d.StatusCode, d.Error, string(d.Payload),
+		d.CreatedAt.UnixNano(), d.UpdatedAt.UnixNano())
+	return err
+}
+
+func (s *SQLiteStore) Deliveries(ctx context.Context, webhookID string, limit int) ([]Delivery, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT
+		id, webhook_id, event, state, attempts, status_code, error, payload, created_at, updated_at
+		FROM webhook_deliveries WHERE webhook_id = ? ORDER BY created_at DESC, id DESC LIMIT ?`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Delivery{}
+	for rows.Next() {
+		var (
+			d                Delivery
+			payload          string
+			created, updated int64
+		)
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.State, &d.Attempts, &d.StatusCode, &d.Error, &payload, &created, &updated); err != nil {
+			return nil, err
+		}
+		d.Payload = json.RawMessage(payload)
+		d.CreatedAt = time.Unix(0, created).UTC()
+		d.UpdatedAt = time.Unix(0, updated).UTC()
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func scanWebhook(row interface{ Scan(...any) error }) (Webhook, error) {
+	var (
+		w                  Webhook
+		events, monitorIDs string
+		created            int64
+	)
+	if err := row.Scan(&w.ID, &w.URL, &w.Secret, &w.Format, &events, &monitorIDs, &w.ThresholdPercent, &created); err != nil {
+		return Webhook{}, err
+	}
+	if err := json.Unmarshal([]byte(events), &w.Events); err != nil {
+		return Webhook{}, fmt.Errorf("webhook %s: events: %w", w.ID, err)
+	}
+	if err := json.Unmarshal([]byte(monitorIDs), &w.MonitorIDs); err != nil {
+		return Webhook{}, fmt.Errorf("webhook %s: monitor_ids: %w", w.ID, err)
+	}
+	w.CreatedAt = time.Unix(0, created).UTC()
+	return w, nil
+}
+
+// nonNil stores an empty list as [] rather than null.
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
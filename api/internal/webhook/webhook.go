@@ -0,0 +1,135 @@
+// Package webhook delivers HMAC-signed notifications about monitor checks to HTTP endpoints,
+// retrying failed deliveries and keeping a log of every attempt.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+)
+
+// Payload formats. FormatJSON is the full Payload; the others wrap a rendered message in the
+// shape chat incoming webhooks expect.
+const (
+	FormatJSON  = "json"
+	FormatSlack = "slack"
+	FormatTeams = "teams"
+)
+
+// Event kinds.
+const (
+	EventStateChanged   = "state_changed"   // the monitor moved between ok, mismatch and failing
+	EventAnswersChanged = "answers_changed" // the set of answer values returned by resolvers changed
+	EventBelowThreshold = "below_threshold" // the share of agreeing resolvers fell below the threshold
+	EventPing           = "ping"            // sent on request to test a webhook
+)
+
+// Delivery states.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Request headers. The signature is "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)),
+// where timestamp is the SignatureTimestamp header, so receivers can reject replays.
+const (
+	HeaderEvent              = "X-Dnsprop-Event"
+	HeaderDelivery           = "X-Dnsprop-Delivery"
+	HeaderSignatureTimestamp = "X-Dnsprop-Timestamp"
+	HeaderSignature          = "X-Dnsprop-Signature"
+)
+
+var ErrNotFound = errors.New("webhook not found")
+
+// ErrTooManyWebhooks is returned by Dispatcher.Create when the webhook limit is reached.
+var ErrTooManyWebhooks = errors.New("too many webhooks")
+
+// Events lists every event kind a webhook can subscribe to.
+var Events = []string{EventStateChanged, EventAnswersChanged, EventBelowThreshold}
+
+// Formats lists the supported payload formats.
+var Formats = []string{FormatJSON, FormatSlack, FormatTeams}
+
+type Webhook struct {
+	ID     string
+	URL    string
+	Secret string
+	Format string
+	// Events the webhook receives; empty means all of them.
+	Events []string
+	// MonitorIDs restricts the webhook to these monitors; empty means every monitor.
+	MonitorIDs []string
+	// ThresholdPercent enables below_threshold events: one is sent when the share of resolvers
+	// agreeing with the expectation drops below it. Zero disables them.
+	ThresholdPercent int
+	CreatedAt        time.Time
+}
+
+// Wants reports whether w subscribes to event for the given monitor.
+func (w Webhook) Wants(event, monitorID string) bool {
+	return (len(w.Events) == 0 || slices.Contains(w.Events, event)) &&
+		(len(w.MonitorIDs) == 0 || slices.Contains(w.MonitorIDs, monitorID))
+}
+
+// Delivery is the log entry for one notification sent to one webhook.
+type Delivery struct {
+	ID         string
+	WebhookID  string
+	Event      string
+	State      string
+	Attempts   int
+	StatusCode int
+	Error      string
+	Payload    json.RawMessage
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Store persists webhooks and their delivery log. Implementations are safe for concurrent use.
+type Store interface {
+	// Create stores w, assigning its ID and CreatedAt, and a random Secret when it is empty.
+	Create(ctx context.Context, w *Webhook) error
+	Get(ctx context.Context, id string) (Webhook, error)
+	// List returns all webhooks, oldest first.
+	List(ctx context.Context) ([]Webhook, error)
+	// Delete removes a webhook and its deliveries.
+	Delete(ctx context.Context, id string) error
+	// SaveDelivery inserts d, or updates it when a delivery with d.ID exists.
+	SaveDelivery(ctx context.Context, d *Delivery) error
+	// Deliveries returns up to limit deliveries of a webhook, newest first.
+	Deliveries(ctx context.Context, webhookID string, limit int) ([]Delivery, error)
+	// DeleteDeliveriesBefore removes deliveries last updated before t that are no longer pending
+	// and returns how many were removed.
+	DeleteDeliveriesBefore(ctx context.Context, t time.Time) (int64, error)
+	Close() error
+}
+
+// Sign returns the HeaderSignature value for body sent at timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is valid for body and timestamp. Receivers written in Go can
+// use it directly.
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
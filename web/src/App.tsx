@@ -1,5 +1,5 @@
 import React, { useState, useEffect } from 'react'
-import { resolveDNS, type ResolveRequest, type ResolveResponse, type Result } from './api'
+import { resolveDNS, getCheck, checkPermalink, checkExportURL, importCheck, type ResolveRequest, type ResolveResponse, type Result, type StoredCheck } from './api'
 import MapVisualization from './components/MapVisualization'
 
 const recordTypes = ['A', 'AAAA', 'CNAME', 'TXT', 'MX', 'NS', 'SOA'] as const
@@ -142,6 +142,9 @@ export default function App() {
   const [loading, setLoading] = useState(false)
   const [data, setData] = useState<ResolveResponse | null>(null)
   const [error, setError] = useState<string | null>(null)
+  // Set when the page was opened from a permalink (?check=<id>); the check is shown read-only.
+  const [shared, setShared] = useState<StoredCheck | null>(null)
+  const [copied, setCopied] = useState(false)
   const [sortBy, setSortBy] = useState<'server' | 'status' | 'rtt'>('server')
   const [sortAsc, setSortAsc] = useState(true)
   const [darkMode, setDarkMode] = useState(() => {
@@ -161,6 +164,53 @@ export default function App() {
     }
   }, [darkMode])
 
+  useEffect(() => {
+    const id = new URLSearchParams(window.location.search).get('check')
+    if (!id) return
+    setLoading(true)
+    getCheck(id)
+      .then(showShared)
+      .catch((err: any) => setError(err?.message ?? 'Could not load shared check'))
+      .finally(() => setLoading(false))
+  }, [])
+
+  const showShared = (check: StoredCheck) => {
+    setShared(check)
+    setData(check.response)
+    setName(check.name)
+    setType(check.type as RT)
+    setDnssec(check.dnssec)
+  }
+
+  // importBundle loads an exported bundle as a new shared check and switches to its permalink.
+  const importBundle = async (e: React.ChangeEvent<HTMLInputElement>) => {
+    const file = e.target.files?.[0]
+    e.target.value = ''
+    if (!file) return
+    setError(null)
+    try {
+      const check = await importCheck(JSON.parse(await file.text()))
+      window.history.replaceState(null, '', `?check=${check.id}`)
+      showShared(check)
+    } catch (err: any) {
+      setError(err?.message ?? 'Could not import bundle')
+    }
+  }
+
+  const leaveShared = () => {
+    window.history.replaceState(null, '', window.location.pathname)
+    setShared(null)
+    setData(null)
+    setError(null)
+  }
+
+  const copyLink = async () => {
+    if (!data?.check_id) return
+    await navigator.clipboard.writeText(checkPermalink(data.check_id))
+    setCopied(true)
+    setTimeout(() => setCopied(false), 2000)
+  }
+
   const toggleDarkMode = () => {
     setDarkMode(!darkMode)
   }
@@ -292,6 +342,10 @@ export default function App() {
                 </svg>
                 <span>{data ? data.results.length : 30} servers</span>
               </div>
+              <label className="cursor-pointer px-3 py-1.5 rounded-lg bg-slate-100/80 dark:bg-slate-800/80 backdrop-blur-sm text-xs font-medium text-slate-700 dark:text-slate-300 hover:bg-slate-200/80 dark:hover:bg-slate-700/80 transition-all duration-200">
+                Import bundle
+                <input type="file" accept="application/json,.json" onChange={importBundle} className="hidden" />
+              </label>
               <button
                 onClick={toggleDarkMode}
                 className="p-2.5 rounded-xl bg-slate-100/80 dark:bg-slate-800/80 backdrop-blur-sm text-slate-700 dark:text-slate-200 hover:bg-slate-200/80 dark:hover:bg-slate-700/80 transition-all duration-200 hover:scale-105 active:scale-95"
@@ -314,100 +368,117 @@ export default function App() {
 
       {/* Main Content */}
       <main className="relative max-w-7xl mx-auto px-4 sm:px-6 lg:px-8 py-8">
+        {/* Shared check banner */}
+        {shared && (
+          <div className="relative backdrop-blur-xl bg-indigo-50/90 dark:bg-indigo-950/30 border-2 border-indigo-200/50 dark:border-indigo-800/50 rounded-2xl p-5 mb-8 flex items-center justify-between shadow-lg shadow-indigo-500/10">
+            <div>
+              <p className="font-bold text-indigo-900 dark:text-indigo-200">Shared check (read-only)</p>
+              <p className="text-sm font-medium text-indigo-700 dark:text-indigo-300 mt-1">
+                Run {new Date(shared.created_at).toLocaleString()} · link expires {new Date(shared.expires_at).toLocaleDateString()}
+              </p>
+            </div>
+            <button onClick={leaveShared} className="px-4 py-2 text-sm font-semibold backdrop-blur-sm bg-slate-100/80 dark:bg-slate-800/80 text-slate-700 dark:text-slate-300 rounded-xl hover:bg-slate-200/80 dark:hover:bg-slate-700/80 transition-all duration-200 hover:scale-105 active:scale-95 border border-slate-200 dark:border-slate-700">
+              Run a new check
+            </button>
+          </div>
+        )}
+
         {/* Query Form */}
-        <div className="relative backdrop-blur-xl bg-white/80 dark:bg-slate-900/80 rounded-2xl shadow-xl border border-slate-200/50 dark:border-slate-700/50 p-8 mb-8 ring-1 ring-slate-900/5 dark:ring-slate-100/10">
-          <form onSubmit={onSubmit} className="space-y-6">
-            <div className="grid grid-cols-1 md:grid-cols-12 gap-5">
-              <div className="md:col-span-6">
-                <label htmlFor="domain" className="block text-sm font-semibold text-slate-700 dark:text-slate-300 mb-2.5 tracking-tight">
-                  Domain Name
-                </label>
-                <input
-                  id="domain"
-                  type="text"
-                  value={name}
-                  onChange={e => setName(e.target.value)}
-                  placeholder="example.com"
-                  required
-                  className="w-full px-4 py-3 border-2 border-slate-200 dark:border-slate-700 bg-white/50 dark:bg-slate-800/50 backdrop-blur-sm text-slate-900 dark:text-slate-100 rounded-xl focus:ring-2 focus:ring-indigo-500/50 focus:border-indigo-500 dark:focus:border-indigo-400 transition-all duration-200 placeholder:text-slate-400 dark:placeholder:text-slate-500 font-medium"
-                />
-              </div>
+        {!shared && (
+          <div className="relative backdrop-blur-xl bg-white/80 dark:bg-slate-900/80 rounded-2xl shadow-xl border border-slate-200/50 dark:border-slate-700/50 p-8 mb-8 ring-1 ring-slate-900/5 dark:ring-slate-100/10">
+            <form onSubmit={onSubmit} className="space-y-6">
+              <div className="grid grid-cols-1 md:grid-cols-12 gap-5">
+                <div className="md:col-span-6">
+                  <label htmlFor="domain" className="block text-sm font-semibold text-slate-700 dark:text-slate-300 mb-2.5 tracking-tight">
+                    Domain Name
+                  </label>
+                  <input
+                    id="domain"
+                    type="text"
+                    value={name}
+                    onChange={e => setName(e.target.value)}
+                    placeholder="example.com"
+                    required
+                    className="w-full px-4 py-3 border-2 border-slate-200 dark:border-slate-700 bg-white/50 dark:bg-slate-800/50 backdrop-blur-sm text-slate-900 dark:text-slate-100 rounded-xl focus:ring-2 focus:ring-indigo-500/50 focus:border-indigo-500 dark:focus:border-indigo-400 transition-all duration-200 placeholder:text-slate-400 dark:placeholder:text-slate-500 font-medium"
+                  />
+                </div>
 
-              <div className="md:col-span-3">
-                <label htmlFor="recordType" className="block text-sm font-semibold text-slate-700 dark:text-slate-300 mb-2.5 tracking-tight">
-                  Record Type
-                </label>
-                <select
-                  id="recordType"
-                  value={type}
-                  onChange={e => setType(e.target.value as RT)}
-                  className="w-full px-4 py-3 border-2 border-slate-200 dark:border-slate-700 bg-white/50 dark:bg-slate-800/50 backdrop-blur-sm text-slate-900 dark:text-slate-100 rounded-xl focus:ring-2 focus:ring-indigo-500/50 focus:border-indigo-500 dark:focus:border-indigo-400 transition-all duration-200 font-medium cursor-pointer"
-                >
-                  {recordTypes.map(rt => (
-                    <option key={rt} value={rt}>
-                      {rt}
-                    </option>
-                  ))}
-                </select>
-              </div>
+                <div className="md:col-span-3">
+                  <label htmlFor="recordType" className="block text-sm font-semibold text-slate-700 dark:text-slate-300 mb-2.5 tracking-tight">
+                    Record Type
+                  </label>
+                  <select
+                    id="recordType"
+                    value={type}
+                    onChange={e => setType(e.target.value as RT)}
+                    className="w-full px-4 py-3 border-2 border-slate-200 dark:border-slate-700 bg-white/50 dark:bg-slate-800/50 backdrop-blur-sm text-slate-900 dark:text-slate-100 rounded-xl focus:ring-2 focus:ring-indigo-500/50 focus:border-indigo-500 dark:focus:border-indigo-400 transition-all duration-200 font-medium cursor-pointer"
+                  >
+                    {recordTypes.map(rt => (
+                      <option key={rt} value={rt}>
+                        {rt}
+                      </option>
+                    ))}
+                  </select>
+                </div>
 
-              <div className="md:col-span-3 flex items-end">
-                <button
-                  type="submit"
-                  disabled={loading}
-                  className="w-full px-6 py-3 bg-gradient-to-r from-indigo-600 to-purple-600 hover:from-indigo-700 hover:to-purple-700 text-white font-bold rounded-xl shadow-lg shadow-indigo-500/30 dark:shadow-indigo-500/20 focus:outline-none focus:ring-2 focus:ring-indigo-500 focus:ring-offset-2 dark:focus:ring-offset-slate-900 disabled:opacity-50 disabled:cursor-not-allowed transition-all duration-200 hover:scale-[1.02] active:scale-[0.98] disabled:hover:scale-100"
-                >
-                  {loading ? (
-                    <span className="flex items-center justify-center">
-                      <svg className="animate-spin -ml-1 mr-2 h-5 w-5 text-white" fill="none" viewBox="0 0 24 24">
-                        <circle className="opacity-25" cx="12" cy="12" r="10" stroke="currentColor" strokeWidth="4" />
-                        <path className="opacity-75" fill="currentColor" d="M4 12a8 8 0 018-8V0C5.373 0 0 5.373 0 12h4zm2 5.291A7.962 7.962 0 014 12H0c0 3.042 1.135 5.824 3 7.938l3-2.647z" />
-                      </svg>
-                      Checking...
-                    </span>
-                  ) : (
-                    <span className="flex items-center justify-center">
-                      <svg className="w-5 h-5 mr-2" fill="none" stroke="currentColor" viewBox="0 0 24 24">
-                        <path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M21 21l-6-6m2-5a7 7 0 11-14 0 7 7 0 0114 0z" />
-                      </svg>
-                      Check DNS
-                    </span>
-                  )}
-                </button>
+                <div className="md:col-span-3 flex items-end">
+                  <button
+                    type="submit"
+                    disabled={loading}
+                    className="w-full px-6 py-3 bg-gradient-to-r from-indigo-600 to-purple-600 hover:from-indigo-700 hover:to-purple-700 text-white font-bold rounded-xl shadow-lg shadow-indigo-500/30 dark:shadow-indigo-500/20 focus:outline-none focus:ring-2 focus:ring-indigo-500 focus:ring-offset-2 dark:focus:ring-offset-slate-900 disabled:opacity-50 disabled:cursor-not-allowed transition-all duration-200 hover:scale-[1.02] active:scale-[0.98] disabled:hover:scale-100"
+                  >
+                    {loading ? (
+                      <span className="flex items-center justify-center">
+                        <svg className="animate-spin -ml-1 mr-2 h-5 w-5 text-white" fill="none" viewBox="0 0 24 24">
+                          <circle className="opacity-25" cx="12" cy="12" r="10" stroke="currentColor" strokeWidth="4" />
+                          <path className="opacity-75" fill="currentColor" d="M4 12a8 8 0 018-8V0C5.373 0 0 5.373 0 12h4zm2 5.291A7.962 7.962 0 014 12H0c0 3.042 1.135 5.824 3 7.938l3-2.647z" />
+                        </svg>
+                        Checking...
+                      </span>
+                    ) : (
+                      <span className="flex items-center justify-center">
+                        <svg className="w-5 h-5 mr-2" fill="none" stroke="currentColor" viewBox="0 0 24 24">
+                          <path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M21 21l-6-6m2-5a7 7 0 11-14 0 7 7 0 0114 0z" />
+                        </svg>
+                        Check DNS
+                      </span>
+                    )}
+                  </button>
+                </div>
               </div>
-            </div>
 
-            <div className="flex items-center space-x-6 pt-2">
-              <label className="flex items-center space-x-2.5 cursor-pointer group">
-                <input
-                  type="checkbox"
-                  checked={dnssec}
-                  onChange={e => setDnssec(e.target.checked)}
-                  className="w-4 h-4 text-indigo-600 border-2 border-slate-300 dark:border-slate-600 rounded focus:ring-indigo-500 focus:ring-2 transition cursor-pointer"
-                />
-                <span className="text-sm font-medium text-slate-700 dark:text-slate-300">Enable DNSSEC validation</span>
-                <div className="relative inline-block">
-                  <svg 
-                    className="w-4 h-4 text-slate-400 dark:text-slate-500 hover:text-indigo-500 dark:hover:text-indigo-400 transition cursor-help" 
-                    fill="currentColor" 
-                    viewBox="0 0 20 20"
-                    aria-label="DNSSEC information"
-                  >
-                    <path fillRule="evenodd" d="M18 10a8 8 0 11-16 0 8 8 0 0116 0zm-7-4a1 1 0 11-2 0 1 1 0 012 0zM9 9a1 1 0 000 2v3a1 1 0 001 1h1a1 1 0 100-2v-3a1 1 0 00-1-1H9z" clipRule="evenodd" />
-                  </svg>
-                  <div className="absolute left-1/2 -translate-x-1/2 bottom-full mb-2 w-72 p-3 bg-slate-900 dark:bg-slate-800 text-white text-xs rounded-xl shadow-2xl opacity-0 invisible group-hover:opacity-100 group-hover:visible transition-all duration-200 pointer-events-none z-10 border border-slate-700">
-                    <div className="font-semibold mb-1">DNSSEC (DNS Security Extensions)</div>
-                    <p className="text-slate-300">
-                      Adds cryptographic signatures to DNS records to verify authenticity and prevent DNS spoofing attacks. 
-                      When enabled, the query sets the DO (DNSSEC OK) flag and checks for the AD (Authenticated Data) bit in responses.
-                    </p>
-                    <div className="absolute left-1/2 -translate-x-1/2 top-full w-0 h-0 border-l-4 border-r-4 border-t-4 border-transparent border-t-slate-900 dark:border-t-slate-800"></div>
+              <div className="flex items-center space-x-6 pt-2">
+                <label className="flex items-center space-x-2.5 cursor-pointer group">
+                  <input
+                    type="checkbox"
+                    checked={dnssec}
+                    onChange={e => setDnssec(e.target.checked)}
+                    className="w-4 h-4 text-indigo-600 border-2 border-slate-300 dark:border-slate-600 rounded focus:ring-indigo-500 focus:ring-2 transition cursor-pointer"
+                  />
+                  <span className="text-sm font-medium text-slate-700 dark:text-slate-300">Enable DNSSEC validation</span>
+                  <div className="relative inline-block">
+                    <svg 
+                      className="w-4 h-4 text-slate-400 dark:text-slate-500 hover:text-indigo-500 dark:hover:text-indigo-400 transition cursor-help" 
+                      fill="currentColor" 
+                      viewBox="0 0 20 20"
+                      aria-label="DNSSEC information"
+                    >
+                      <path fillRule="evenodd" d="M18 10a8 8 0 11-16 0 8 8 0 0116 0zm-7-4a1 1 0 11-2 0 1 1 0 012 0zM9 9a1 1 0 000 2v3a1 1 0 001 1h1a1 1 0 100-2v-3a1 1 0 00-1-1H9z" clipRule="evenodd" />
+                    </svg>
+                    <div className="absolute left-1/2 -translate-x-1/2 bottom-full mb-2 w-72 p-3 bg-slate-900 dark:bg-slate-800 text-white text-xs rounded-xl shadow-2xl opacity-0 invisible group-hover:opacity-100 group-hover:visible transition-all duration-200 pointer-events-none z-10 border border-slate-700">
+                      <div className="font-semibold mb-1">DNSSEC (DNS Security Extensions)</div>
+                      <p className="text-slate-300">
+                        Adds cryptographic signatures to DNS records to verify authenticity and prevent DNS spoofing attacks. 
+                        When enabled, the query sets the DO (DNSSEC OK) flag and checks for the AD (Authenticated Data) bit in responses.
+                      </p>
+                      <div className="absolute left-1/2 -translate-x-1/2 top-full w-0 h-0 border-l-4 border-r-4 border-t-4 border-transparent border-t-slate-900 dark:border-t-slate-800"></div>
+                    </div>
                   </div>
-                </div>
-              </label>
-            </div>
-          </form>
-        </div>
+                </label>
+              </div>
+            </form>
+          </div>
+        )}
 
         {/* Error Message */}
         {error && (
@@ -442,6 +513,16 @@ export default function App() {
                   </p>
                 </div>
                 <div className="flex space-x-3">
+                  {data.check_id && (
+                    <button onClick={copyLink} className="px-4 py-2 text-sm font-semibold backdrop-blur-sm bg-slate-100/80 dark:bg-slate-800/80 text-slate-700 dark:text-slate-300 rounded-xl hover:bg-slate-200/80 dark:hover:bg-slate-700/80 transition-all duration-200 hover:scale-105 active:scale-95 border border-slate-200 dark:border-slate-700">
+                      {copied ? 'Link copied' : 'Copy link'}
+                    </button>
+                  )}
+                  {data.check_id && (
+                    <a href={checkExportURL(data.check_id)} download className="px-4 py-2 text-sm font-semibold backdrop-blur-sm bg-slate-100/80 dark:bg-slate-800/80 text-slate-700 dark:text-slate-300 rounded-xl hover:bg-slate-200/80 dark:hover:bg-slate-700/80 transition-all duration-200 hover:scale-105 active:scale-95 border border-slate-200 dark:border-slate-700">
+                      Download bundle
+                    </a>
+                  )}
                   <button
                     onClick={exportJSON}
                     className="px-4 py-2 text-sm font-semibold backdrop-blur-sm bg-slate-100/80 dark:bg-slate-800/80 text-slate-700 dark:text-slate-300 rounded-xl hover:bg-slate-200/80 dark:hover:bg-slate-700/80 transition-all duration-200 hover:scale-105 active:scale-95 border border-slate-200 dark:border-slate-700"
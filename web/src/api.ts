@@ -5,38 +5,540 @@ export interface ResolveRequest {
   type: RecordType;
   servers?: string[];
   dnssec?: boolean;
+  eta?: boolean;
 }
 
 export interface Answer { value: string; ttl?: number }
+// Keep these types in sync with api/internal/api/openapi.json. The app uses the frozen /api/v1 shapes.
 export interface Result {
   server: string;
   region?: string;
-  latitude?: number;
-  longitude?: number;
+  latitude: number;
+  longitude: number;
   status: string;
   rtt_ms?: number;
   answers?: Answer[];
   authority?: string[];
   ad?: boolean;
   when: string;
+  stale?: boolean;
+  propagated_by?: string;
+}
+export interface Propagation {
+  authoritative_status: string;
+  authoritative_answers?: Answer[];
+  authoritative_ttl: number;
+  current: number;
+  stale: number;
+  unknown: number;
+  fully_propagated_by: string;
 }
 export interface ResolveResponse {
   name: string;
   type: RecordType;
   results: Result[];
+  propagation?: Propagation;
+  // Permalink ID for getCheck; absent when the server has history disabled.
+  check_id?: string;
 }
 
 const API_BASE = import.meta.env.VITE_API_BASE_URL || ''
 
+// Problem is the RFC 9457 error body returned for every non-2xx response.
+export interface Problem {
+  type: string;
+  title: string;
+  status: number;
+  detail?: string;
+  instance?: string;
+  code: string;
+  request_id?: string;
+}
+
+export class ApiError extends Error {
+  constructor(public status: number, public code: string, public problem?: Problem) {
+    super(problem?.detail || problem?.title || `HTTP ${status}`)
+  }
+}
+
+async function apiError(res: Response): Promise<ApiError> {
+  if (res.headers.get('content-type')?.startsWith('application/problem+json')) {
+    const p: Problem = await res.json()
+    return new ApiError(res.status, p.code, p)
+  }
+  return new ApiError(res.status, 'unknown')
+}
+
 export async function resolveDNS(req: ResolveRequest): Promise<ResolveResponse> {
-  const res = await fetch(`${API_BASE}/api/resolve`, {
+  const res = await fetch(`${API_BASE}/api/v1/resolve`, {
     method: 'POST',
     headers: {'content-type': 'application/json'},
     body: JSON.stringify(req),
   })
-  if (!res.ok) {
-    const text = await res.text()
-    throw new Error(`HTTP ${res.status} ${text}`)
-  }
+  if (!res.ok) throw await apiError(res)
+  return res.json()
+}
+
+export interface ServerHealth {
+  queries: number;
+  responded: number;
+  timeouts: number;
+  errors: number;
+  success_rate: number;
+  mean_rtt_ms: number;
+  last_status: string;
+  last_seen: string;
+}
+
+export interface ResolverInfo {
+  address: string;
+  provider?: string;
+  city?: string;
+  label?: string;
+  latitude: number;
+  longitude: number;
+  family: 'ipv4'|'ipv6';
+  transports: Array<'udp'|'tcp'|'dot'|'doh'|'doq'>;
+  health?: ServerHealth;
+}
+
+export async function listResolvers(): Promise<ResolverInfo[]> {
+  const res = await fetch(`${API_BASE}/api/v1/resolvers`)
+  if (!res.ok) throw await apiError(res)
+  const body = await res.json()
+  return body.resolvers
+}
+
+function resolveQuery(req: ResolveRequest): URLSearchParams {
+  const params = new URLSearchParams({ name: req.name, type: req.type })
+  if (req.servers?.length) params.set('servers', req.servers.join(','))
+  if (req.dnssec) params.set('dnssec', 'true')
+  if (req.eta) params.set('eta', 'true')
+  return params
+}
+
+// resolveURL returns a bookmarkable GET URL for req; the response matches resolveDNS.
+export function resolveURL(req: ResolveRequest): string {
+  return `${API_BASE}/api/v1/resolve?${resolveQuery(req)}`
+}
+
+export type NameserverStatus = 'healthy'|'lame'|'refused'|'timeout'|'no_address'|'inconsistent'
+
+export interface NameserverHealth {
+  host: string;
+  address?: string;
+  status: NameserverStatus;
+  rtt_ms?: number;
+  serial?: number;
+  detail?: string;
+}
+export interface HealthReport {
+  name: string;
+  zone: string;
+  serial?: number;
+  nameservers: NameserverHealth[];
+  counts: Partial<Record<NameserverStatus, number>>;
+  healthy: boolean;
+  problems?: string[];
+}
+
+export async function checkNameservers(name: string): Promise<HealthReport> {
+  const res = await fetch(`${API_BASE}/api/v1/nameservers`, {
+    method: 'POST',
+    headers: {'content-type': 'application/json'},
+    body: JSON.stringify({ name }),
+  })
+  if (!res.ok) throw await apiError(res)
+  return res.json()
+}
+
+export type WatchState = 'running'|'converged'|'expired'|'cancelled'
+
+export interface WatchRequest extends ResolveRequest {
+  expected?: string[];
+  interval_seconds?: number;
+  timeout_seconds?: number;
+}
+export interface WatchStatus {
+  id: string;
+  name: string;
+  type: RecordType;
+  expected?: string[];
+  state: WatchState;
+  iterations: number;
+  agreeing: number;
+  unreachable: number;
+  total: number;
+  started_at: string;
+  deadline: string;
+  updated_at: string;
+  converged_at?: string;
+  results?: Result[];
+}
+
+export async function startWatch(req: WatchRequest): Promise<WatchStatus> {
+  const res = await fetch(`${API_BASE}/api/v1/watch`, {
+    method: 'POST',
+    headers: {'content-type': 'application/json'},
+    body: JSON.stringify(req),
+  })
+  if (!res.ok) throw await apiError(res)
+  return res.json()
+}
+
+export type MonitorState = 'pending'|'ok'|'mismatch'|'failing'
+
+export interface MonitorRequest extends ResolveRequest {
+  expected?: string[];
+  interval_seconds?: number;
+}
+
+export interface Monitor {
+  id: string;
+  name: string;
+  type: RecordType;
+  servers: string[];
+  dnssec: boolean;
+  expected?: string[];
+  interval_seconds: number;
+  created_at: string;
+  updated_at: string;
+  status: {
+    state: MonitorState;
+    since?: string;
+    checked_at?: string;
+    agreeing: number;
+    unreachable: number;
+    total: number;
+  };
+}
+
+export interface MonitorResult {
+  id: number;
+  checked_at: string;
+  state: Exclude<MonitorState, 'pending'>;
+  agreeing: number;
+  unreachable: number;
+  total: number;
+  duration_ms: number;
+  servers: { server: string; status: string; answers: string[]; rtt_ms?: number }[];
+}
+
+export async function listMonitors(): Promise<Monitor[]> {
+  const res = await fetch(`${API_BASE}/api/v1/monitors`)
+  if (!res.ok) throw await apiError(res)
+  return (await res.json()).monitors
+}
+
+// saveMonitor creates a monitor, or replaces the settings of monitor id.
+export async function saveMonitor(req: MonitorRequest, id?: string): Promise<Monitor> {
+  const res = await fetch(`${API_BASE}/api/v1/monitors${id ? `/${id}` : ''}`, {
+    method: id ? 'PUT' : 'POST',
+    headers: {'content-type': 'application/json'},
+    body: JSON.stringify(req),
+  })
+  if (!res.ok) throw await apiError(res)
+  return res.json()
+}
+
+export async function deleteMonitor(id: string): Promise<void> {
+  const res = await fetch(`${API_BASE}/api/v1/monitors/${id}`, { method: 'DELETE' })
+  if (!res.ok) throw await apiError(res)
+}
+
+export async function listMonitorResults(id: string, limit?: number): Promise<MonitorResult[]> {
+  const q = limit ? `?limit=${limit}` : ''
+  const res = await fetch(`${API_BASE}/api/v1/monitors/${id}/results${q}`)
+  if (!res.ok) throw await apiError(res)
+  return (await res.json()).results
+}
+
+export interface MonitorRollup {
+  start: string;
+  checks: number;
+  duration_ms: number;
+  states: Record<string, number>;
+  statuses: Record<string, number>;
+  answer_sets: Record<string, number>;
+}
+
+// listMonitorRollups returns aggregates of a monitor's results past raw retention, newest first.
+export async function listMonitorRollups(id: string, resolution: 'hour'|'day' = 'hour', limit?: number): Promise<MonitorRollup[]> {
+  const q = new URLSearchParams({ resolution })
+  if (limit) q.set('limit', String(limit))
+  const res = await fetch(`${API_BASE}/api/v1/monitors/${id}/rollups?${q}`)
+  if (!res.ok) throw await apiError(res)
+  return (await res.json()).rollups
+}
+
+export type WebhookEvent = 'state_changed'|'answers_changed'|'below_threshold'
+
+export interface WebhookRequest {
+  url: string;
+  format?: 'json'|'slack'|'teams';
+  events?: WebhookEvent[];
+  monitor_ids?: string[];
+  threshold_percent?: number;
+}
+
+export interface Webhook {
+  id: string;
+  url: string;
+  format: 'json'|'slack'|'teams';
+  events: WebhookEvent[];
+  monitor_ids: string[];
+  threshold_percent: number;
+  created_at: string;
+  secret?: string; // only set in the createWebhook response
+}
+
+export interface WebhookDelivery {
+  id: string;
+  event: WebhookEvent|'ping';
+  state: 'pending'|'succeeded'|'failed';
+  attempts: number;
+  status_code?: number;
+  error?: string;
+  payload: unknown;
+  created_at: string;
+  updated_at: string;
+}
+
+export async function listWebhooks(): Promise<Webhook[]> {
+  const res = await fetch(`${API_BASE}/api/v1/webhooks`)
+  if (!res.ok) throw await apiError(res)
+  return (await res.json()).webhooks
+}
+
+export async function createWebhook(req: WebhookRequest): Promise<Webhook> {
+  const res = await fetch(`${API_BASE}/api/v1/webhooks`, {
+    method: 'POST',
+    headers: {'content-type': 'application/json'},
+    body: JSON.stringify(req),
+  })
+  if (!res.ok) throw await apiError(res)
+  return res.json()
+}
+
+export async function deleteWebhook(id: string): Promise<void> {
+  const res = await fetch(`${API_BASE}/api/v1/webhooks/${id}`, { method: 'DELETE' })
+  if (!res.ok) throw await apiError(res)
+}
+
+export async function listWebhookDeliveries(id: string, limit?: number): Promise<WebhookDelivery[]> {
+  const q = limit ? `?limit=${limit}` : ''
+  const res = await fetch(`${API_BASE}/api/v1/webhooks/${id}/deliveries${q}`)
+  if (!res.ok) throw await apiError(res)
+  return (await res.json()).deliveries
+}
+
+export async function testWebhook(id: string): Promise<WebhookDelivery> {
+  const res = await fetch(`${API_BASE}/api/v1/webhooks/${id}/test`, { method: 'POST' })
+  if (!res.ok) throw await apiError(res)
+  return res.json()
+}
+
+// watchEvents subscribes to a watch job; the returned EventSource must be closed by the caller.
+export function watchEvents(id: string, onStatus: (s: WatchStatus) => void): EventSource {
+  const es = new EventSource(`${API_BASE}/api/v1/watch/${id}/events`)
+  const handle = (e: MessageEvent) => onStatus(JSON.parse(e.data))
+  es.addEventListener('progress', handle)
+  es.addEventListener('done', (e) => { handle(e as MessageEvent); es.close() })
+  return es
+}
+
+export type ChangeKind = 'unchanged'|'changed'|'added'|'removed'
+
+export interface ServerDiff {
+  server: string;
+  region?: string;
+  change: ChangeKind;
+  status_before?: string;
+  status_after?: string;
+  answers_added?: string[];
+  answers_removed?: string[];
+  ttl_changes?: { value: string; before: number; after: number }[];
+  rtt_delta_ms: number;
+}
+export interface DiffResponse {
+  name: string;
+  type: RecordType;
+  servers: ServerDiff[];
+  summary: {
+    servers: number;
+    unchanged: number;
+    changed: number;
+    added: number;
+    removed: number;
+    status_changes: number;
+    answer_changes: number;
+    ttl_changes: number;
+    mean_rtt_delta_ms: number;
+    answers_before: Record<string, number>;
+    answers_after: Record<string, number>;
+  };
+}
+
+export async function diffSnapshots(before: ResolveResponse, after: ResolveResponse): Promise<DiffResponse> {
+  const res = await fetch(`${API_BASE}/api/v1/diff`, {
+    method: 'POST',
+    headers: {'content-type': 'application/json'},
+    body: JSON.stringify({ before, after }),
+  })
+  if (!res.ok) throw await apiError(res)
+  return res.json()
+}
+
+export interface Check {
+  id: string;
+  name: string;
+  type: RecordType;
+  servers: string[];
+  dnssec: boolean;
+  source: string;
+  request_id?: string;
+  user_agent?: string;
+  duration_ms: number;
+  created_at: string;
+  response: ResolveResponse;
+}
+
+export interface HistoryPage {
+  name: string;
+  checks: Check[];
+  next_cursor?: string;
+}
+
+export async function listHistory(name: string, opts: { type?: RecordType; limit?: number; cursor?: string } = {}): Promise<HistoryPage> {
+  const q = new URLSearchParams({ name })
+  if (opts.type) q.set('type', opts.type)
+  if (opts.limit) q.set('limit', String(opts.limit))
+  if (opts.cursor) q.set('cursor', opts.cursor)
+  const res = await fetch(`${API_BASE}/api/v1/history?${q}`)
+  if (!res.ok) throw await apiError(res)
+  return res.json()
+}
+
+// A permalinked check, as returned by GET /api/v1/checks/{id}.
+export interface StoredCheck extends Check {
+  expires_at: string;
+}
+
+export async function getCheck(id: string): Promise<StoredCheck> {
+  const res = await fetch(`${API_BASE}/api/v1/checks/${encodeURIComponent(id)}`)
+  if (!res.ok) throw await apiError(res)
+  return res.json()
+}
+
+// checkExportURL downloads check id as a versioned bundle that importCheck accepts.
+export function checkExportURL(id: string): string {
+  return `${API_BASE}/api/v1/checks/${encodeURIComponent(id)}/export`
+}
+
+// importCheck stores an exported bundle as a new check with its own permalink.
+export async function importCheck(bundle: unknown): Promise<StoredCheck> {
+  const res = await fetch(`${API_BASE}/api/v1/checks/import`, {
+    method: 'POST',
+    headers: {'content-type': 'application/json'},
+    body: JSON.stringify(bundle),
+  })
+  if (!res.ok) throw await apiError(res)
+  return res.json()
+}
+
+// checkPermalink is the web app URL that renders check id read-only.
+export function checkPermalink(id: string): string {
+  const url = new URL(window.location.href)
+  url.search = new URLSearchParams({ check: id }).toString()
+  url.hash = ''
+  return url.toString()
+}
+
+// A run of identical observations by one resolver; ended_at is absent for the latest run.
+export interface TimelineInterval {
+  status: string;
+  answers: string[];
+  first_seen: string;
+  last_seen: string;
+  ended_at?: string;
+  observations: number;
+}
+
+export interface TimelineResponse {
+  name: string;
+  type: RecordType;
+  checks: number;
+  truncated?: boolean;
+  answer_sets: { status: string; answers: string[]; first_seen: string; last_seen: string; resolvers: number }[];
+  resolvers: { server: string; region?: string; intervals: TimelineInterval[] }[];
+}
+
+export async function getTimeline(name: string, type: RecordType, opts: { since?: string; until?: string } = {}): Promise<TimelineResponse> {
+  const q = new URLSearchParams({ name, type })
+  if (opts.since) q.set('since', opts.since)
+  if (opts.until) q.set('until', opts.until)
+  const res = await fetch(`${API_BASE}/api/v1/timeline?${q}`)
+  if (!res.ok) throw await apiError(res)
   return res.json()
 }
+
+export interface BatchItem {
+  index: number;
+  name: string;
+  type: RecordType;
+  error?: string;
+  code?: string;
+  results?: Result[];
+  statuses?: Record<string, number>;
+}
+
+export async function resolveBatch(items: ResolveRequest[], servers?: string[]): Promise<BatchItem[]> {
+  const res = await fetch(`${API_BASE}/api/v1/resolve/batch`, {
+    method: 'POST',
+    headers: {'content-type': 'application/json'},
+    body: JSON.stringify({ items, servers }),
+  })
+  if (!res.ok) throw await apiError(res)
+  const body = await res.json()
+  return body.items
+}
+
+export interface StreamSummary {
+  name: string;
+  type: RecordType;
+  total: number;
+  statuses: Record<string, number>;
+  propagation?: Propagation;
+}
+
+// streamResolve opens an SSE stream of results; the returned EventSource must be closed by the caller.
+export function streamResolve(
+  req: ResolveRequest,
+  onResult: (r: Result) => void,
+  onSummary: (s: StreamSummary) => void,
+): EventSource {
+  const es = new EventSource(`${API_BASE}/api/v1/resolve/stream?${resolveQuery(req)}`)
+  es.addEventListener('result', (e) => onResult(JSON.parse((e as MessageEvent).data)))
+  es.addEventListener('summary', (e) => { onSummary(JSON.parse((e as MessageEvent).data)); es.close() })
+  return es
+}
+
+export type WSCommand =
+  | ({ op: 'resolve'; id: string } & ResolveRequest)
+  | { op: 'cancel'; id: string }
+
+export interface WSMessage {
+  event: 'result'|'done'|'cancelled'|'error';
+  id?: string;
+  result?: Result;
+  summary?: StreamSummary;
+  error?: string;
+  code?: string;
+}
+
+export function openResolveSocket(onMessage: (m: WSMessage) => void): WebSocket {
+  const base = API_BASE || window.location.origin
+  const ws = new WebSocket(`${base.replace(/^http/, 'ws')}/api/v1/ws`)
+  ws.onmessage = (e) => onMessage(JSON.parse(e.data))
+  return ws
+}